@@ -3,107 +3,830 @@ package cmd
 import (
 	"backup-agent/internal/adapter/s3"
 	"backup-agent/internal/backup"
+	"backup-agent/internal/catalog"
+	"backup-agent/internal/change"
+	"backup-agent/internal/command"
 	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/checksum"
 	"backup-agent/internal/pkg/encryption"
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/metrics"
+	"backup-agent/internal/pkg/notify"
+	"backup-agent/internal/pkg/tracing"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
+var (
+	dumpOnly          bool
+	verifyUpload      bool
+	backupDryRun      bool
+	incrementalBackup bool
+)
+
 var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Perform database backups",
 	Long:  `Perform backups of configured databases with optional encryption and S3 upload.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		configPath, _ := cmd.Flags().GetString("config")
+	RunE:  ExecuteBackup,
+}
 
-		// Load configuration
-		cfg, err := config.Load(configPath)
-		if err != nil {
-			return fmt.Errorf("error loading configuration: %v", err)
-		}
+func ExecuteBackup(cmd *cobra.Command, args []string) error {
+	return runBackup(cmd, incrementalBackup, nil)
+}
+
+// ExecuteIncrementalBackup copies the binary logs of the MySQL databases with
+// incremental enabled, as the daemon runs it on the incremental schedule
+func ExecuteIncrementalBackup(cmd *cobra.Command, args []string) error {
+	return runBackup(cmd, true, nil)
+}
+
+// runBackup performs a full backup of the configured databases, or with
+// incremental an incremental backup of those supporting it. A non-nil selected
+// limits the run to the databases it returns true for.
+func runBackup(cmd *cobra.Command, incremental bool, selected func(backup.Config) bool) (err error) {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
 
-		// Initialize logger
-		if err := logger.Init(cfg.LogLevel); err != nil {
-			return fmt.Errorf("error initializing logger: %v", err)
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+	)
+	if selected != nil {
+		cfg.DBConfigs = slices.DeleteFunc(cfg.DBConfigs, func(db backup.Config) bool {
+			return !selected(db)
+		})
+		if len(cfg.DBConfigs) == 0 {
+			log.Info("No databases to back up in this run")
+			return nil
 		}
-		defer logger.Sync()
+	}
+	log.Info("Starting backup process", zap.Bool("incremental", incremental))
 
-		log := logger.L().With(
-			zap.String("config_path", configPath),
-		)
-		log.Info("Starting backup process")
+	// Report the outcome of scheduled runs, dump-only runs are interactive
+	start := time.Now()
+	var produced []backup.Result
+	if !dumpOnly && !backupDryRun {
+		defer func() {
+			event := backupEvent(start, produced, err)
+			if err := notify.New(cfg.Notifications, cfg.CatalogPath).Notify(context.Background(), event); err != nil {
+				log.Warn("Error sending notifications", zap.Error(err))
+			}
+		}()
+	}
 
-		// Initialize encryptor
-		encryptor, err := encryption.NewEncryptor(cfg.Encryption)
+	// Trace the run when tracing is enabled, the span is ended before the exporter flushes
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("Error initializing tracing", zap.Error(err))
+		return fmt.Errorf("error initializing tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Warn("Error flushing traces", zap.Error(err))
+		}
+	}()
+	// Serve metrics for the duration of the run, the textfile outlives it.
+	// The daemon serves them for its whole lifetime instead.
+	stopMetrics := func(context.Context) error { return nil }
+	if !serving {
+		stopMetrics, err = metrics.Start(cfg.Metrics)
 		if err != nil {
-			log.Error("Error initializing encryptor", zap.Error(err))
-			return fmt.Errorf("error initializing encryptor: %v", err)
+			log.Error("Error starting metrics server", zap.Error(err))
+			return fmt.Errorf("error starting metrics server: %v", err)
 		}
-		log.Debug("Encryptor initialized", zap.Bool("encryption_enabled", cfg.Encryption.Enabled))
+	}
+	defer func() {
+		if err := metrics.Flush(cfg.Metrics); err != nil {
+			log.Warn("Error writing metrics", zap.Error(err))
+		}
+		if err := stopMetrics(context.Background()); err != nil {
+			log.Warn("Error stopping metrics server", zap.Error(err))
+		}
+	}()
+
+	ctx, span := tracing.Start(cmd.Context(), "backup.run",
+		attribute.Int("backup.database_count", len(cfg.DBConfigs)))
+	defer func() { tracing.End(span, err) }()
+
+	// Initialize encryptor
+	encryptor, err := encryption.New(cfg.Encryption)
+	if err != nil {
+		log.Error("Error initializing encryptor", zap.Error(err))
+		return fmt.Errorf("error initializing encryptor: %v", err)
+	}
+	log.Debug("Encryptor initialized", zap.Bool("encryption_enabled", cfg.Encryption.Enabled))
+
+	log.Info("DBConfigs", zap.Array("DBConfigs", backup.Configs(cfg.DBConfigs)))
 
-		log.Info("DBConfigs", zap.Any("DBConfigs", cfg.DBConfigs))
+	if backupDryRun {
+		return printBackupPlan(ctx, cfg)
+	}
+	if incremental && cfg.Bundle {
+		return fmt.Errorf("incremental backups can't be bundled, disable bundle to take them")
+	}
 
-		// Perform database backups
-		uploadRequests, err := backup.Backup(cfg.DBConfigs, encryptor)
+	// Dump-only runs skip encryption, bundling and upload regardless of the configuration
+	if dumpOnly {
+		log.Info("Dump-only mode, skipping encryption and upload")
+		results, err := backup.Backup(ctx, cfg.DBConfigs, disabledEncryptor(), dumpOptions(cfg))
+		recordFailedBackups(err)
+		failed, err := partialFailure(err, results)
 		if err != nil {
 			log.Error("Error backing up databases", zap.Error(err))
-			return fmt.Errorf("error backing up databases: %v", err)
-		}
-
-		// Handle S3 upload if enabled
-		if cfg.Upload.Enabled {
-			log.Info("S3 upload enabled, initializing S3 adapter")
-			s3Adapter, err := s3.New(s3.Config{
-				AccessKey: cfg.S3.AccessKey,
-				SecretKey: cfg.S3.SecretKey,
-				Endpoint:  cfg.S3.Endpoint,
-				Region:    "default",
-			})
+			return fmt.Errorf("error backing up databases: %w", err)
+		}
+		for _, res := range results {
+			log.Info("Dump written", zap.String("database", res.FolderName), zap.String("file", res.FilePath))
+			fmt.Printf("%s: %s\n", res.FolderName, res.FilePath)
+		}
+		recordBackups(results, nil)
+		if err := pruneLocalBackups(ctx, cfg); err != nil {
+			log.Error("Error applying retention rules to local backups", zap.Error(err))
+			return fmt.Errorf("error applying retention rules to local backups: %v", err)
+		}
+		return finishBackup(failed)
+	}
+
+	// Check S3 reachability before dumping so an unreachable bucket doesn't waste time and disk
+	uploadEnabled := cfg.Upload.Enabled
+	var destinations []destination
+	if uploadEnabled {
+		log.Info("S3 upload enabled, initializing S3 adapters",
+			zap.String("on_unreachable", cfg.Upload.OnUnreachable))
+		destinations, err = reachableDestinations(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		uploadEnabled = len(destinations) > 0
+		if cfg.Upload.AbortIncompleteAfter > 0 {
+			abortIncompleteUploads(ctx, cfg, destinations)
+		}
+	}
+
+	// The catalog keeps the change signals and binary log positions between runs
+	dbConfigs := cfg.DBConfigs
+	var cat *catalog.Catalog
+	var signals map[string]string
+	var binlogStarts map[string]string
+	if usesChangeDetection(cfg.DBConfigs) || usesIncremental(cfg.DBConfigs) {
+		cat, err = catalog.Load(cfg.CatalogPath)
+		if err != nil {
+			log.Error("Error loading catalog", zap.String("catalog_path", cfg.CatalogPath), zap.Error(err))
+			return fmt.Errorf("error loading catalog: %v", err)
+		}
+	}
+	if incremental {
+		// Only the binary logs of databases with incremental enabled are copied
+		dbConfigs, binlogStarts = incrementalDatabases(cfg.DBConfigs, cat)
+		if len(dbConfigs) == 0 {
+			return fmt.Errorf("no enabled %s database has incremental set, nothing to back up incrementally", backup.MySQL)
+		}
+	} else if usesChangeDetection(cfg.DBConfigs) {
+		// Skip databases that haven't changed since the last successful run
+		dbConfigs, signals = changedDatabases(cfg.DBConfigs, cat, cfg.Binaries)
+		if len(dbConfigs) == 0 {
+			log.Info("No database changed since the last backup, nothing to do")
+			return nil
+		}
+	}
+
+	// When bundling, the individual dumps stay plaintext and only the bundle is encrypted
+	dumpEncryptor := encryptor
+	if cfg.Bundle {
+		dumpEncryptor = disabledEncryptor()
+	}
+
+	// Perform database backups
+	opts := dumpOptions(cfg)
+	opts.KeepLocalPlaintext = cfg.Encryption.KeepLocalPlaintext
+	opts.WorkDir = cfg.WorkDir
+	opts.Incremental = incremental
+	opts.BinlogStarts = binlogStarts
+	// Overlap uploads with dumping and encryption when pipelining is enabled
+	if uploadEnabled && !cfg.Bundle && cfg.Upload.PipelineDepth > 0 {
+		log.Info("Starting pipelined backup and upload",
+			zap.Int("pipeline_depth", cfg.Upload.PipelineDepth))
+		results, err := backup.Pipeline(ctx, dbConfigs, encryptor, opts, cfg.Upload.PipelineDepth, func(ctx context.Context, res backup.Result) (err error) {
+			// Each backup is recorded as soon as it's uploaded and verified
+			defer func() { recordBackups([]backup.Result{res}, err) }()
+
+			req, err := uploadRequest(res)
 			if err != nil {
-				log.Error("Error initializing S3 adapter", zap.Error(err))
-				return fmt.Errorf("error initializing S3 adapter: %v", err)
+				return err
 			}
+			defer req.file.Close()
 
-			// Convert upload requests to S3 adapter format
-			s3Requests := make([]s3.UploadRequest, len(uploadRequests))
-			for i, req := range uploadRequests {
-				// Open the file for reading
-				file, err := os.Open(req.FilePath)
-				if err != nil {
-					log.Error("Error opening file for upload",
-						zap.String("file", req.FilePath),
-						zap.Error(err))
-					return fmt.Errorf("error opening file %s: %v", req.FilePath, err)
-				}
-				defer file.Close()
-
-				s3Requests[i] = s3.UploadRequest{
-					FolderName: req.FolderName,
-					FileName:   req.FileName,
-					Content:    file,
-				}
+			return uploadToDestinations(ctx, destinations, []checkedUploadRequest{req})
+		})
+		recordFailedBackups(err)
+		produced = results
+		failed, err := partialFailure(err, results)
+		if err != nil {
+			log.Error("Error in backup pipeline", zap.Error(err))
+			return fmt.Errorf("error backing up databases: %w", err)
+		}
+		log.Info("Successfully uploaded backups to S3", zap.Int("file_count", len(results)))
+		recordCatalog(cat, signals, results, incremental, failed)
+		return finishBackup(failed)
+	}
+
+	uploadRequests, err := backup.Backup(ctx, dbConfigs, dumpEncryptor, opts)
+	recordFailedBackups(err)
+	failed, err := partialFailure(err, uploadRequests)
+	if err != nil {
+		log.Error("Error backing up databases", zap.Error(err))
+		// Dumps waiting to be bundled are unencrypted, a cancelled run doesn't leave them behind
+		if cfg.Bundle {
+			removeResults(uploadRequests)
+		}
+		return fmt.Errorf("error backing up databases: %w", err)
+	}
+	produced = uploadRequests
+
+	// Bundle all dumps into a single archive if enabled
+	if cfg.Bundle {
+		bundle, err := backup.Bundle(ctx, uploadRequests, encryptor, opts)
+		if err != nil {
+			log.Error("Error bundling backups", zap.Error(err))
+			recordBackups(produced, err)
+			return fmt.Errorf("error bundling backups: %v", err)
+		}
+		log.Info("Backups bundled", zap.String("bundle", bundle.FilePath))
+		uploadRequests = []backup.Result{bundle}
+	}
+
+	// Handle S3 upload if enabled
+	if uploadEnabled {
+		// Convert upload requests to S3 adapter format
+		requests := make([]checkedUploadRequest, len(uploadRequests))
+		for i, res := range uploadRequests {
+			req, err := uploadRequest(res)
+			if err != nil {
+				log.Error("Error preparing file for upload",
+					zap.String("file", res.FilePath),
+					zap.Error(err))
+				recordBackups(produced, err)
+				return err
 			}
+			defer req.file.Close()
+
+			requests[i] = req
+		}
+
+		// Upload files to every destination
+		log.Info("Starting S3 upload",
+			zap.Int("file_count", len(requests)),
+			zap.Int("destination_count", len(destinations)))
+		if err := uploadToDestinations(ctx, destinations, requests); err != nil {
+			recordBackups(produced, err)
+			return err
+		}
+		log.Info("Successfully uploaded backups to S3")
+	} else if cfg.Upload.Enabled {
+		log.Info("S3 is unreachable, backups are stored locally only")
+	} else {
+		log.Info("S3 upload is disabled, backups are stored locally only")
+		if err := pruneLocalBackups(ctx, cfg); err != nil {
+			log.Error("Error applying retention rules to local backups", zap.Error(err))
+			return fmt.Errorf("error applying retention rules to local backups: %v", err)
+		}
+	}
+
+	recordBackups(produced, nil)
+	recordCatalog(cat, signals, produced, incremental, failed)
+	return finishBackup(failed)
+}
+
+// recordBackups records the outcome of backups in the metrics once they were
+// stored, uploaded and verified, or failed to be
+func recordBackups(results []backup.Result, err error) {
+	for _, res := range results {
+		metrics.RecordBackup(res.Database, res.Duration, err)
+	}
+}
+
+// recordFailedBackups records the databases whose backup failed in the metrics
+func recordFailedBackups(err error) {
+	var failed *backup.FailedDatabasesError
+	if errors.As(err, &failed) {
+		for _, dbErr := range failed.Errors {
+			metrics.RecordBackup(dbErr.Database, dbErr.Duration, dbErr)
+		}
+		return
+	}
+	var dbErr *backup.DatabaseError
+	if errors.As(err, &dbErr) {
+		metrics.RecordBackup(dbErr.Database, dbErr.Duration, dbErr)
+	}
+}
+
+// partialFailure separates the failed databases of a continue_on_error run
+// that still produced backups from errors that stop the run
+func partialFailure(err error, results []backup.Result) (*backup.FailedDatabasesError, error) {
+	var failed *backup.FailedDatabasesError
+	if errors.As(err, &failed) && len(results) > 0 {
+		logger.L().Error("Some database backups failed, continuing with the successful ones",
+			zap.Strings("failed_databases", failed.Databases()),
+			zap.Error(err))
+		return failed, nil
+	}
+	return nil, err
+}
 
-			// Upload files to S3
-			log.Info("Starting S3 upload", zap.Int("file_count", len(s3Requests)))
-			if err := s3Adapter.UploadMultiple(cfg.S3.Bucket, s3Requests); err != nil {
-				log.Error("Error uploading to S3", zap.Error(err))
-				return fmt.Errorf("error uploading to S3: %v", err)
+// finishBackup ends a run whose backups were stored, failing it when the
+// backups of some databases failed
+func finishBackup(failed *backup.FailedDatabasesError) error {
+	if failed != nil {
+		return fmt.Errorf("error backing up databases: %w", failed)
+	}
+	logger.L().Info("Backup process completed successfully")
+	return nil
+}
+
+// printBackupPlan prints the backup commands and the object keys a run would
+// produce, without dumping or uploading anything
+func printBackupPlan(ctx context.Context, cfg *config.Config) error {
+	opts := dumpOptions(cfg)
+	plans, err := backup.Plan(ctx, cfg.DBConfigs, opts)
+	if err != nil {
+		return err
+	}
+
+	// Object keys are only built, the buckets aren't contacted
+	var adapters []*s3.S3
+	var destinations []config.Destination
+	if cfg.Upload.Enabled && !dumpOnly {
+		destinations = cfg.UploadDestinations()
+		for _, dest := range destinations {
+			adapter, err := s3.New(dest.Config)
+			if err != nil {
+				return fmt.Errorf("error initializing S3 adapter for destination %s: %v", dest.Name, err)
 			}
-			log.Info("Successfully uploaded backups to S3")
-		} else {
-			log.Info("S3 upload is disabled, backups are stored locally only")
+			adapters = append(adapters, adapter)
+		}
+	}
+	printUploads := func(indent, folder, fileName string) {
+		if len(adapters) == 0 {
+			fmt.Printf("%supload:  none, kept locally\n", indent)
+			return
 		}
+		if cfg.Encryption.Enabled && !dumpOnly {
+			fileName += ".enc"
+		}
+		for i, adapter := range adapters {
+			fmt.Printf("%supload:  %s: s3://%s/%s\n", indent, destinations[i].Name, destinations[i].Bucket, adapter.ObjectKey(folder, fileName))
+		}
+	}
 
-		log.Info("Backup process completed successfully")
+	fmt.Println("Dry run, the following backups would be taken:")
+	for _, plan := range plans {
+		fmt.Printf("\n%s (%s)\n", plan.Database, plan.Type)
+		fmt.Printf("  file:    %s\n", plan.FilePath)
+		for _, step := range plan.Steps {
+			fmt.Printf("  command: %s\n", step)
+		}
+		if cfg.Bundle && !dumpOnly {
+			fmt.Println("  upload:  in the bundle")
+			continue
+		}
+		printUploads("  ", plan.Database, plan.FileName)
+	}
+	if cfg.Bundle && !dumpOnly && len(plans) > 0 {
+		fmt.Printf("\nbundle %s\n", backup.BundleFileName(cfg.Naming, time.Now()))
+		printUploads("  ", backup.BundleFolderName, backup.BundleFileName(cfg.Naming, time.Now()))
+	}
+	return nil
+}
+
+// pruneLocalBackups applies the deletion rules to the local backup directories of
+// runs whose backups are kept on disk only
+func pruneLocalBackups(ctx context.Context, cfg *config.Config) error {
+	if !cfg.DeletionRules.Enabled {
 		return nil
-	},
+	}
+	_, err := command.NewLocalDeleteCommand(cfg).Execute(ctx)
+	return err
+}
+
+// backupEvent describes the outcome of a backup run for the notifications
+func backupEvent(start time.Time, results []backup.Result, err error) notify.Event {
+	event := notify.Event{
+		Command:  "backup",
+		Status:   notify.StatusSuccess,
+		Duration: time.Since(start),
+	}
+	for _, res := range results {
+		event.Bytes += res.Size
+		event.Databases = append(event.Databases, notify.DatabaseStats{
+			Name:     res.FolderName,
+			Files:    1,
+			Bytes:    res.Size,
+			Duration: res.Duration,
+		})
+	}
+
+	if err != nil {
+		event.Status = notify.StatusFailure
+		event.Error = err.Error()
+		var dbErr *backup.DatabaseError
+		if errors.As(err, &dbErr) {
+			event.Database = dbErr.Database
+		}
+		var cmdErr *backup.CommandError
+		if errors.As(err, &cmdErr) {
+			event.Output = cmdErr.Stderr
+		}
+	}
+	return event
+}
+
+// usesChangeDetection reports whether any database skips unchanged backups
+func usesChangeDetection(dbConfigs []backup.Config) bool {
+	for _, db := range dbConfigs {
+		if db.SkipUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// changedDatabases drops the databases whose change signal matches the one recorded in
+// the catalog and returns the new signals, to be recorded once the run has succeeded
+func changedDatabases(dbConfigs []backup.Config, cat *catalog.Catalog, bins backup.Binaries) ([]backup.Config, map[string]string) {
+	log := logger.L()
+
+	changed := make([]backup.Config, 0, len(dbConfigs))
+	signals := make(map[string]string)
+	for _, db := range dbConfigs {
+		// Disabled databases are skipped by the backup without querying them
+		if !db.SkipUnchanged || !db.IsEnabled() {
+			changed = append(changed, db)
+			continue
+		}
+
+		signal, err := change.Signal(db, bins)
+		if err != nil {
+			// Failing to detect changes must never cost a backup
+			log.Warn("Error reading change signal, backing up anyway",
+				zap.String("database", db.Name),
+				zap.Error(err))
+			changed = append(changed, db)
+			continue
+		}
+
+		if entry, ok := cat.Get(db.Name); ok && entry.ChangeSignal == signal {
+			log.Info("Database unchanged since the last backup, skipping",
+				zap.String("database", db.Name),
+				zap.Time("last_backup", entry.UpdatedAt))
+			continue
+		}
+
+		log.Debug("Database changed since the last backup",
+			zap.String("database", db.Name),
+			zap.String("signal", signal))
+		signals[db.Name] = signal
+		changed = append(changed, db)
+	}
+	return changed, signals
+}
+
+// usesIncremental reports whether any database records binary log positions for incremental backups
+func usesIncremental(dbConfigs []backup.Config) bool {
+	for _, db := range dbConfigs {
+		if backup.SupportsIncremental(db) {
+			return true
+		}
+	}
+	return false
+}
+
+// incrementalDatabases returns the databases an incremental run backs up with the
+// binary log each one starts at, as recorded by the previous backup
+func incrementalDatabases(dbConfigs []backup.Config, cat *catalog.Catalog) ([]backup.Config, map[string]string) {
+	log := logger.L()
+
+	selected := make([]backup.Config, 0, len(dbConfigs))
+	starts := make(map[string]string)
+	for _, db := range dbConfigs {
+		if !backup.SupportsIncremental(db) || !db.IsEnabled() {
+			log.Info("Skipping database without incremental backups",
+				zap.String("database", db.Name),
+				zap.String("type", db.Type))
+			continue
+		}
+		if entry, ok := cat.Get(db.Name); ok {
+			starts[db.Name] = entry.Binlog
+		}
+		selected = append(selected, db)
+	}
+	return selected, starts
+}
+
+// recordCatalog stores the change signals and binary log positions of a successful
+// run in the catalog, except those of the failed databases which must be backed
+// up next time
+func recordCatalog(cat *catalog.Catalog, signals map[string]string, results []backup.Result, incremental bool, failed *backup.FailedDatabasesError) {
+	if cat == nil {
+		return
+	}
+
+	var skip []string
+	if failed != nil {
+		skip = failed.Databases()
+	}
+	now := time.Now()
+	updated := false
+	for name, signal := range signals {
+		if slices.Contains(skip, name) {
+			continue
+		}
+		entry, _ := cat.Get(name)
+		entry.ChangeSignal = signal
+		entry.UpdatedAt = now
+		cat.Set(name, entry)
+		updated = true
+	}
+	for _, res := range results {
+		if res.Binlog == "" {
+			continue
+		}
+		// Incremental backups are filed under the incremental folder of their database
+		name := res.FolderName
+		if incremental {
+			name = strings.TrimSuffix(name, backup.IncrementalFolderName(""))
+		}
+		entry, _ := cat.Get(name)
+		entry.Binlog = res.Binlog
+		entry.UpdatedAt = now
+		cat.Set(name, entry)
+		updated = true
+	}
+	if !updated {
+		return
+	}
+	if err := cat.Save(); err != nil {
+		// The next run backs up the databases again, which is safe
+		logger.L().Warn("Error saving catalog", zap.Error(err))
+	}
+}
+
+// dumpOptions returns the backup options that control the dump commands
+func dumpOptions(cfg *config.Config) backup.Options {
+	return backup.Options{
+		Binaries:        cfg.Binaries,
+		Naming:          cfg.Naming,
+		DumpTimeout:     cfg.DumpTimeout,
+		DumpRetries:     cfg.DumpRetries,
+		DumpRetryDelay:  cfg.DumpRetryDelay,
+		ContinueOnError: cfg.ContinueOnError,
+	}
+}
+
+// removeResults removes the local files of backups that won't be stored
+func removeResults(results []backup.Result) {
+	for _, res := range results {
+		if err := os.Remove(res.FilePath); err != nil && !os.IsNotExist(err) {
+			logger.L().Warn("Error removing backup file",
+				zap.String("file", res.FilePath),
+				zap.Error(err))
+			continue
+		}
+		logger.L().Info("Removed backup file", zap.String("file", res.FilePath))
+	}
+}
+
+// disabledEncryptor returns an encryptor that leaves files untouched
+func disabledEncryptor() *encryption.Encryptor {
+	// NewEncryptor can't fail when encryption is disabled
+	encryptor, _ := encryption.NewEncryptor(encryption.NewConfig(false, ""))
+	return encryptor
+}
+
+// destination is an upload destination with its S3 adapter
+type destination struct {
+	config.Destination
+	adapter *s3.S3
+}
+
+// reachableDestinations initializes the S3 adapters of the upload destinations and checks
+// that their buckets are reachable. Unreachable optional destinations are skipped, an
+// unreachable required one aborts the backup unless upload.on_unreachable is "local",
+// in which case no destination is returned and the backup is kept locally only.
+func reachableDestinations(ctx context.Context, cfg *config.Config) ([]destination, error) {
+	var destinations []destination
+	for _, dest := range cfg.UploadDestinations() {
+		log := logger.L().With(
+			zap.String("destination", dest.Name),
+			zap.String("bucket", dest.Bucket),
+		)
+
+		adapter, err := s3.New(dest.Config)
+		if err != nil {
+			log.Error("Error initializing S3 adapter", zap.Error(err))
+			return nil, fmt.Errorf("error initializing S3 adapter for destination %s: %v", dest.Name, err)
+		}
+
+		check := adapter.HeadBucket
+		if dest.AutoCreateBucket {
+			check = func(ctx context.Context, bucket string) error {
+				return adapter.EnsureBucket(ctx, bucket, dest.Region)
+			}
+		}
+		if err := check(ctx, dest.Bucket); err != nil {
+			if !dest.IsRequired() {
+				log.Warn("Optional S3 destination is unreachable, skipping it", zap.Error(err))
+				continue
+			}
+			if cfg.Upload.OnUnreachable != config.UnreachableLocal {
+				log.Error("S3 bucket is unreachable, aborting before dumping", zap.Error(err))
+				return nil, fmt.Errorf("S3 bucket of destination %s is unreachable: %v", dest.Name, err)
+			}
+			log.Warn("S3 bucket is unreachable, proceeding with local-only backup", zap.Error(err))
+			return nil, nil
+		}
+		log.Info("S3 bucket is reachable")
+		destinations = append(destinations, destination{Destination: dest, adapter: adapter})
+	}
+	return destinations, nil
+}
+
+// abortIncompleteUploads aborts the multipart uploads left incomplete in the
+// database folders of the destinations by earlier runs. Failures are only logged,
+// the next run tries again.
+func abortIncompleteUploads(ctx context.Context, cfg *config.Config, destinations []destination) {
+	for _, dest := range destinations {
+		log := logger.L().With(
+			zap.String("destination", dest.Name),
+			zap.String("bucket", dest.Bucket),
+		)
+
+		aborted, err := dest.adapter.AbortIncompleteUploads(ctx, dest.Bucket, uploadPrefixes(cfg, dest.adapter), cfg.Upload.AbortIncompleteAfter)
+		if err != nil {
+			log.Warn("Error aborting incomplete multipart uploads", zap.Error(err))
+		}
+		if len(aborted) > 0 {
+			log.Info("Aborted incomplete multipart uploads of earlier runs", zap.Int("upload_count", len(aborted)))
+		}
+	}
+}
+
+// uploadToDestinations uploads the files to every destination and verifies them with
+// --verify. A failed upload to a required destination is returned, failures of optional
+// destinations are only logged.
+func uploadToDestinations(ctx context.Context, destinations []destination, requests []checkedUploadRequest) error {
+	for _, dest := range destinations {
+		log := logger.L().With(
+			zap.String("destination", dest.Name),
+			zap.String("bucket", dest.Bucket),
+		)
+
+		stats, err := uploadToDestination(ctx, dest, requests)
+		logUploadSummary(log, requests, stats)
+		if err == nil {
+			continue
+		}
+		if !dest.IsRequired() {
+			log.Error("Error uploading to optional S3 destination, continuing", zap.Error(err))
+			continue
+		}
+		log.Error("Error uploading to S3", zap.Error(err))
+		return fmt.Errorf("error uploading to S3 destination %s: %w", dest.Name, err)
+	}
+	return nil
+}
+
+// uploadToDestination uploads the files to a single destination, rewinding them first
+// since the previous destination has read them
+func uploadToDestination(ctx context.Context, dest destination, requests []checkedUploadRequest) ([]s3.UploadStats, error) {
+	s3Requests := make([]s3.UploadRequest, len(requests))
+	for i, req := range requests {
+		if _, err := req.file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error rewinding file %s: %v", req.file.Name(), err)
+		}
+		s3Requests[i] = req.UploadRequest
+	}
+
+	stats, err := dest.adapter.UploadMultiple(ctx, dest.Bucket, s3Requests)
+	if err != nil {
+		return stats, err
+	}
+
+	// Compare what landed in the bucket with what was produced locally
+	if !verifyUpload {
+		return stats, nil
+	}
+	var mismatches []error
+	for _, req := range requests {
+		key := dest.adapter.ObjectKey(req.FolderName, req.FileName)
+		if err := dest.adapter.VerifyObject(ctx, dest.Bucket, key, req.Checksum, req.size); err != nil {
+			mismatches = append(mismatches, err)
+		}
+	}
+	if len(mismatches) > 0 {
+		return stats, fmt.Errorf("verification of uploaded backups failed: %w", errors.Join(mismatches...))
+	}
+	logger.L().Info("Uploaded backups verified",
+		zap.String("destination", dest.Name),
+		zap.Int("file_count", len(requests)))
+	return stats, nil
+}
+
+// logUploadSummary logs the size and duration of the uploads to a destination and
+// records the upload durations in the metrics, labelled by database like the backups
+func logUploadSummary(log *zap.Logger, requests []checkedUploadRequest, stats []s3.UploadStats) {
+	databases := make(map[string]string, len(requests))
+	for _, req := range requests {
+		databases[req.FolderName] = req.database
+	}
+
+	var totalBytes int64
+	var totalDuration time.Duration
+	for _, upload := range stats {
+		metrics.RecordUpload(databases[upload.FolderName], upload.Duration)
+		log.Info("Uploaded backup",
+			zap.String("database", databases[upload.FolderName]),
+			zap.String("folder", upload.FolderName),
+			zap.String("key", upload.Key),
+			zap.Int64("bytes", upload.Bytes),
+			zap.Duration("duration", upload.Duration),
+			zap.Float64("bytes_per_second", upload.BytesPerSecond()))
+		totalBytes += upload.Bytes
+		totalDuration += upload.Duration
+	}
+	if len(stats) > 0 {
+		log.Info("Upload summary",
+			zap.Int("file_count", len(stats)),
+			zap.Int64("bytes", totalBytes),
+			zap.Duration("upload_time", totalDuration))
+	}
+}
+
+// checkedUploadRequest is an upload request for a local file with its checksum and size
+type checkedUploadRequest struct {
+	s3.UploadRequest
+	database string
+	file     *os.File
+	size     int64
+}
+
+// uploadRequest opens the backup file for upload after computing its SHA-256,
+// which is stored with the object and used to verify it, and tags it with the
+// database and its type. The caller closes the file.
+func uploadRequest(res backup.Result) (checkedUploadRequest, error) {
+	sum, size, err := checksum.SHA256File(res.FilePath)
+	if err != nil {
+		return checkedUploadRequest{}, err
+	}
+
+	file, err := os.Open(res.FilePath)
+	if err != nil {
+		return checkedUploadRequest{}, fmt.Errorf("error opening file %s: %v", res.FilePath, err)
+	}
+
+	return checkedUploadRequest{
+		UploadRequest: s3.UploadRequest{
+			FolderName: res.FolderName,
+			FileName:   res.FileName,
+			Content:    file,
+			Checksum:   sum,
+			BackupTime: res.CreatedAt,
+			Tags:       map[string]string{"database": res.FolderName, "type": res.Type},
+		},
+		database: res.Database,
+		file:     file,
+		size:     size,
+	}, nil
 }
 
 func init() {
 	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().BoolVar(&dumpOnly, "dump-only", false, "Only dump the databases to local files, skipping encryption and upload")
+	backupCmd.Flags().BoolVar(&backupDryRun, "dry-run", false, "Print the backup commands and object keys without dumping or uploading anything")
+	backupCmd.Flags().BoolVar(&verifyUpload, "verify", false, "Download every uploaded backup and compare its size and SHA-256 with the local file")
+	backupCmd.Flags().Bool("full", false, "Dump the databases, the default")
+	backupCmd.Flags().BoolVar(&incrementalBackup, "incremental", false, "Copy the binary logs written since the previous backup of the MySQL databases with incremental set")
+	backupCmd.MarkFlagsMutuallyExclusive("full", "incremental")
+	backupCmd.MarkFlagsMutuallyExclusive("incremental", "dump-only")
+	backupCmd.MarkFlagsMutuallyExclusive("incremental", "dry-run")
 }
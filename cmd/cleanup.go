@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	cleanupOlderThan   time.Duration
+	cleanupDestination string
+	cleanupDryRun      bool
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Abort incomplete multipart uploads left in the bucket",
+	Long: `Abort the multipart uploads that were started more than --older-than ago and
+never completed, e.g. by backup runs that were killed. Their uploaded parts don't
+show up as objects but are stored and billed until the upload is aborted.
+
+Only uploads below the folders of the configured databases (and the bundle
+folder with bundle enabled) are considered, uploads of other tools sharing the
+bucket are left alone. Keep --older-than above the duration of the longest
+upload so running backups aren't interrupted.
+
+With several destinations configured, --destination selects the bucket that is
+cleaned up, the first destination by default.`,
+	RunE: ExecuteCleanup,
+}
+
+func ExecuteCleanup(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+	if cleanupDestination != "" {
+		if err := cfg.UseDestination(cleanupDestination); err != nil {
+			return err
+		}
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.String("bucket", cfg.S3.Bucket),
+		zap.Duration("older_than", cleanupOlderThan),
+		zap.Bool("dry_run", cleanupDryRun),
+	)
+	log.Info("Starting multipart upload cleanup")
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	prefixes := uploadPrefixes(cfg, s3Client)
+	var uploads []s3.IncompleteUpload
+	if cleanupDryRun {
+		uploads, err = s3Client.ListIncompleteUploads(cmd.Context(), cfg.S3.Bucket, prefixes, time.Now().Add(-cleanupOlderThan))
+	} else {
+		uploads, err = s3Client.AbortIncompleteUploads(cmd.Context(), cfg.S3.Bucket, prefixes, cleanupOlderThan)
+	}
+
+	// Uploads aborted before a failure are printed too
+	if err == nil || len(uploads) > 0 {
+		action := "Aborted"
+		if cleanupDryRun {
+			action = "Would abort"
+		}
+		fmt.Printf("\n%s %d incomplete multipart upload(s) older than %s:\n", action, len(uploads), cleanupOlderThan)
+		for _, upload := range uploads {
+			fmt.Printf("  %s (started %s)\n", upload.Key, upload.Initiated.Format(time.RFC3339))
+		}
+	}
+
+	if err != nil {
+		log.Error("Error cleaning up incomplete multipart uploads", zap.Error(err))
+		return fmt.Errorf("error cleaning up incomplete multipart uploads: %v", err)
+	}
+	log.Info("Multipart upload cleanup completed", zap.Int("upload_count", len(uploads)))
+	return nil
+}
+
+// uploadPrefixes returns the key prefixes of the folders the agent uploads to:
+// the folder of every configured database, its incremental folder and the
+// bundle folder when bundling
+func uploadPrefixes(cfg *config.Config, client *s3.S3) []string {
+	var prefixes []string
+	for _, db := range cfg.DBConfigs {
+		prefixes = append(prefixes, client.KeyComponent(db.Name)+"/")
+		if backup.SupportsIncremental(db) {
+			prefixes = append(prefixes, client.KeyComponent(backup.IncrementalFolderName(db.Name))+"/")
+		}
+	}
+	if cfg.Bundle {
+		prefixes = append(prefixes, backup.BundleFolderName+"/")
+	}
+	return prefixes
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+	cleanupCmd.Flags().DurationVar(&cleanupOlderThan, "older-than", 24*time.Hour, "Only abort uploads started longer ago than this")
+	cleanupCmd.Flags().StringVar(&cleanupDestination, "destination", "", "Name of the destination to clean up, the first one by default")
+	cleanupCmd.Flags().BoolVarP(&cleanupDryRun, "dry-run", "d", false, "List the uploads that would be aborted without aborting them")
+}
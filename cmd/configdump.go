@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"backup-agent/internal/config"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configDumpFormat      string
+	configDumpShowSecrets bool
+)
+
+var configDumpCmd = &cobra.Command{
+	Use:   "config-dump",
+	Short: "Print the effective configuration",
+	Long: `Print the fully resolved configuration after merging the config file with
+BACKUP_ environment variables and applying defaults. Secrets are redacted
+unless --show-secrets is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPaths, _ := cmd.Flags().GetStringArray("config")
+
+		// Load configuration
+		cfg, err := config.Load(configPaths...)
+		if err != nil {
+			return fmt.Errorf("error loading configuration: %v", err)
+		}
+
+		effective := cfg.Redacted()
+		if configDumpShowSecrets {
+			fmt.Fprintln(os.Stderr, "WARNING: the output contains secrets in plain text, don't share or store it")
+			effective = *cfg
+		}
+
+		var out []byte
+		switch configDumpFormat {
+		case "yaml":
+			out, err = yaml.Marshal(effective.Map())
+		case "json":
+			out, err = json.MarshalIndent(effective.Map(), "", "  ")
+			out = append(out, '\n')
+		default:
+			return fmt.Errorf("unsupported output format: %s (use yaml or json)", configDumpFormat)
+		}
+		if err != nil {
+			return fmt.Errorf("error encoding configuration: %v", err)
+		}
+
+		fmt.Print(string(out))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configDumpCmd)
+	configDumpCmd.Flags().StringVarP(&configDumpFormat, "output", "o", "yaml", "Output format: yaml or json")
+	configDumpCmd.Flags().BoolVar(&configDumpShowSecrets, "show-secrets", false, "Print secrets in plain text, for local debugging only")
+}
@@ -5,51 +5,95 @@ import (
 	"backup-agent/internal/pkg/encryption"
 	"backup-agent/internal/pkg/logger"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
+var (
+	decryptLegacy bool
+	decryptStdout bool
+	decryptOutput string
+)
+
 var decryptCmd = &cobra.Command{
 	Use:   "decrypt [file]",
 	Short: "Decrypt an encrypted backup file",
-	Long:  `Decrypt an encrypted backup file using the encryption key from the configuration.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Decrypt an encrypted backup file using the encryption key from the configuration.
+
+With --stdout the plaintext is written to standard output instead of a file, so
+it can be piped into a client without touching the disk:
+
+  backup-agent decrypt shop.sql.enc --stdout | mysql shop`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		configPath, _ := cmd.Flags().GetString("config")
+		configPaths, _ := cmd.Flags().GetStringArray("config")
 		encryptedFile := args[0]
 
 		// Load configuration
-		cfg, err := config.Load(configPath)
+		cfg, err := config.Load(configPaths...)
 		if err != nil {
 			return fmt.Errorf("error loading configuration: %v", err)
 		}
 
-		// Initialize logger
-		if err := logger.Init(cfg.LogLevel); err != nil {
+		// Initialize logger, on stderr when the plaintext goes to stdout
+		initLogger := logger.Init
+		if decryptStdout {
+			initLogger = logger.InitStderr
+		}
+		if err := initLogger(cfg.Logger()); err != nil {
 			return fmt.Errorf("error initializing logger: %v", err)
 		}
 		defer logger.Sync()
 
 		log := logger.L().With(
-			zap.String("config_path", configPath),
+			zap.Strings("config_paths", configPaths),
 			zap.String("encrypted_file", encryptedFile),
 		)
 		log.Info("Starting decryption process")
 
 		// Initialize encryptor
-		encryptor, err := encryption.NewEncryptor(cfg.Encryption)
+		encryptor, err := encryption.New(cfg.Encryption)
 		if err != nil {
 			log.Error("Error initializing encryptor", zap.Error(err))
 			return fmt.Errorf("error initializing encryptor: %v", err)
 		}
 
+		// Headerless files only exist for AES
+		if decryptLegacy {
+			aesEncryptor, ok := encryptor.(*encryption.Encryptor)
+			if !ok {
+				return fmt.Errorf("--legacy is only supported for encryption type %s", encryption.TypeAES)
+			}
+			encryptor = aesEncryptor.WithLegacyFormat(true)
+		}
+
+		if decryptStdout && decryptOutput != "" {
+			return fmt.Errorf("--stdout and --output can't be combined")
+		}
+		if decryptStdout {
+			input, err := os.Open(encryptedFile)
+			if err != nil {
+				log.Error("Error reading encrypted file", zap.Error(err))
+				return fmt.Errorf("error reading encrypted file: %v", err)
+			}
+			defer input.Close()
+
+			if err := encryptor.DecryptStream(input, os.Stdout); err != nil {
+				log.Error("Error decrypting file", zap.Error(err))
+				return fmt.Errorf("error decrypting file: %w", err)
+			}
+			log.Info("File decrypted to stdout")
+			return nil
+		}
+
 		// Decrypt the file
-		decryptedPath, err := encryptor.DecryptFile(encryptedFile)
+		decryptedPath, err := encryptor.DecryptFile(encryptedFile, decryptOutput)
 		if err != nil {
 			log.Error("Error decrypting file", zap.Error(err))
-			return fmt.Errorf("error decrypting file: %v", err)
+			return fmt.Errorf("error decrypting file: %w", err)
 		}
 
 		// Get the output filename without the .enc extension
@@ -69,4 +113,7 @@ var decryptCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().BoolVar(&decryptStdout, "stdout", false, "Write the plaintext to standard output instead of a file")
+	decryptCmd.Flags().StringVarP(&decryptOutput, "output", "o", "", "Write the plaintext to this path instead of next to the file without .enc")
+	decryptCmd.Flags().BoolVar(&decryptLegacy, "legacy", false, "Accept files encrypted by older versions without a format header")
 }
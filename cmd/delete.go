@@ -5,7 +5,9 @@ import (
 	"backup-agent/internal/command"
 	"backup-agent/internal/config"
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/notify"
 	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -16,7 +18,14 @@ import (
 )
 
 var (
-	dryRun bool
+	dryRun            bool
+	summaryOnly       bool
+	pruneEmptyFolders bool
+	deleteLocal       bool
+	deleteDestination string
+	deleteOutput      string
+	deleteDatabase    string
+	deleteOlderThan   time.Duration
 )
 
 var deleteCmd = &cobra.Command{
@@ -26,63 +35,139 @@ var deleteCmd = &cobra.Command{
 The deletion process follows these rules:
 1. MaxAgeDays: Delete backups older than specified days
 2. MaxCount: Keep only the specified number of most recent backups
-3. Both rules can be applied simultaneously
-4. Rules are applied per database folder independently
+3. MaxTotalSizeBytes: Delete the oldest backups until each database fits the size budget
+4. All rules can be applied simultaneously, the size rule runs last
+5. Rules are applied per database folder independently
+
+With --local the rules are applied to the backups on local disk instead of S3,
+the files below the directory of every configured database, dated by their
+modification time.
+
+With several destinations configured, --destination selects the bucket the
+rules are applied to, the first destination by default.
+
+For ad-hoc cleanups, --database limits the deletion to the backups and
+incremental backups of one database and --older-than deletes every backup older
+than the given duration instead of applying the configured rules, even when
+deletion is disabled. Databases exempt from deletion keep their backups. Try
+them with --dry-run first.
 
 Example configuration:
 deletion_rules:
   enabled: true
   max_age_days: 30
-  max_count: 10`,
+  max_count: 10
+  max_total_size_bytes: 10737418240`,
 	RunE: ExecuteDelete,
 }
 
-func ExecuteDelete(cmd *cobra.Command, args []string) error {
-	configPath, _ := cmd.Flags().GetString("config")
+func ExecuteDelete(cmd *cobra.Command, args []string) (err error) {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
 
 	// Load configuration
-	cfg, err := config.Load(configPath)
+	cfg, err := config.Load(configPaths...)
 	if err != nil {
 		return fmt.Errorf("error loading configuration: %v", err)
 	}
 
-	// Initialize logger
-	if err := logger.Init(cfg.LogLevel); err != nil {
+	if deleteOutput != "text" && deleteOutput != "json" {
+		return fmt.Errorf("unsupported output format: %s (use text or json)", deleteOutput)
+	}
+	if deleteLocal && deleteDestination != "" {
+		return fmt.Errorf("--destination only applies to S3 and cannot be used with --local")
+	}
+	if deleteDestination != "" {
+		if err := cfg.UseDestination(deleteDestination); err != nil {
+			return err
+		}
+	}
+	if deleteLocal && pruneEmptyFolders {
+		return fmt.Errorf("--prune-empty-folders only applies to S3 and cannot be used with --local")
+	}
+	if deleteLocal && (deleteDatabase != "" || deleteOlderThan != 0) {
+		return fmt.Errorf("--database and --older-than only apply to S3 and cannot be used with --local")
+	}
+	if deleteOlderThan < 0 {
+		return fmt.Errorf("invalid --older-than %s: must be positive", deleteOlderThan)
+	}
+
+	// Initialize logger, JSON output keeps stdout for the report
+	initLogger := logger.Init
+	if deleteOutput == "json" {
+		initLogger = logger.InitStderr
+	}
+	if err := initLogger(cfg.Logger()); err != nil {
 		return fmt.Errorf("error initializing logger: %v", err)
 	}
 	defer logger.Sync()
 
 	log := logger.L().With(
-		zap.String("config_path", configPath),
+		zap.Strings("config_paths", configPaths),
 		zap.Bool("dry_run", dryRun),
+		zap.Bool("local", deleteLocal),
+		zap.String("destination", deleteDestination),
+		zap.String("database", deleteDatabase),
+		zap.Duration("older_than", deleteOlderThan),
 	)
 	log.Info("Starting backup deletion process")
 
-	if !cfg.DeletionRules.Enabled {
+	// Ad-hoc cleanups with --older-than don't depend on the configured rules
+	if !cfg.DeletionRules.Enabled && deleteOlderThan == 0 {
 		log.Info("Backup deletion is disabled in configuration")
+		if deleteOutput == "json" {
+			return printDeleteJSON(&command.DeleteStats{}, dryRun)
+		}
 		return nil
 	}
 
-	// Initialize S3 client
-	s3Client, err := s3.New(s3.Config{
-		AccessKey: cfg.S3.AccessKey,
-		SecretKey: cfg.S3.SecretKey,
-		Endpoint:  cfg.S3.Endpoint,
-		Region:    cfg.S3.Region,
-	})
-	if err != nil {
-		log.Error("Error initializing S3 client", zap.Error(err))
-		return fmt.Errorf("error initializing S3 client: %v", err)
+	// Report the outcome of real runs, dry runs are interactive
+	start := time.Now()
+	var stats *command.DeleteStats
+	if !dryRun {
+		defer func() {
+			event := deleteEvent(start, stats, err)
+			if err := notify.New(cfg.Notifications, cfg.CatalogPath).Notify(context.Background(), event); err != nil {
+				log.Warn("Error sending notifications", zap.Error(err))
+			}
+		}()
 	}
 
-	// Create and execute delete command
-	deleteCmd := command.NewDeleteCommand(s3Client, cfg).WithDryRun(dryRun)
-	stats, err := deleteCmd.Execute(context.Background())
+	if deleteLocal {
+		stats, err = command.NewLocalDeleteCommand(cfg).
+			WithDryRun(dryRun).
+			WithSummaryOnly(summaryOnly).
+			Execute(cmd.Context())
+	} else {
+		// Initialize S3 client
+		var s3Client *s3.S3
+		s3Client, err = s3.New(cfg.S3)
+		if err != nil {
+			log.Error("Error initializing S3 client", zap.Error(err))
+			return fmt.Errorf("error initializing S3 client: %v", err)
+		}
+
+		// Create and execute delete command
+		deleteCmd := command.NewDeleteCommand(s3Client, cfg).
+			WithDryRun(dryRun).
+			WithSummaryOnly(summaryOnly).
+			WithPruneEmptyFolders(pruneEmptyFolders).
+			WithDatabase(deleteDatabase).
+			WithOlderThan(deleteOlderThan)
+		stats, err = deleteCmd.Execute(cmd.Context())
+	}
 	if err != nil {
 		log.Error("Error executing delete command", zap.Error(err))
 		return fmt.Errorf("error executing delete command: %v", err)
 	}
 
+	if deleteOutput == "json" {
+		if err := printDeleteJSON(stats, dryRun); err != nil {
+			return err
+		}
+		log.Info("Backup deletion process completed successfully")
+		return nil
+	}
+
 	// Print summary to console
 	fmt.Printf("\nOverall Deletion Summary:\n")
 	fmt.Printf("------------------------\n")
@@ -91,6 +176,9 @@ func ExecuteDelete(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Files to Retain: %d\n", stats.RetainedFiles)
 	fmt.Printf("Deleted Size: %s\n", formatBytes(stats.DeletedSize))
 	fmt.Printf("Retained Size: %s\n", formatBytes(stats.RetainedSize))
+	if pruneEmptyFolders {
+		fmt.Printf("Empty Folders Pruned: %d\n", stats.PrunedFolders)
+	}
 	if !stats.OldestRetained.IsZero() {
 		fmt.Printf("Oldest Retained: %s\n", stats.OldestRetained.Format(time.RFC3339))
 		fmt.Printf("Newest Retained: %s\n", stats.NewestRetained.Format(time.RFC3339))
@@ -135,6 +223,107 @@ func ExecuteDelete(cmd *cobra.Command, args []string) error {
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "Perform a dry run without actually deleting files")
+	deleteCmd.Flags().BoolVar(&pruneEmptyFolders, "prune-empty-folders", false, "Remove leftover folder markers of database folders without backups")
+	deleteCmd.Flags().BoolVar(&deleteLocal, "local", false, "Apply the retention rules to the local backup directories instead of S3")
+	deleteCmd.Flags().StringVar(&deleteDestination, "destination", "", "Name of the destination to delete from, the first one by default")
+	deleteCmd.Flags().BoolVar(&summaryOnly, "summary-only", false, "Suppress per-file logs and only print the deletion summaries")
+	deleteCmd.Flags().StringVarP(&deleteOutput, "output", "o", "text", "Output format: text or json")
+	deleteCmd.Flags().StringVar(&deleteDatabase, "database", "", "Only delete backups of this database")
+	deleteCmd.Flags().DurationVar(&deleteOlderThan, "older-than", 0, "Delete every backup older than this instead of applying the deletion rules")
+}
+
+// deleteEvent describes the outcome of a delete run for the notifications
+func deleteEvent(start time.Time, stats *command.DeleteStats, err error) notify.Event {
+	event := notify.Event{
+		Command:  "delete",
+		Status:   notify.StatusSuccess,
+		Duration: time.Since(start),
+	}
+	if stats != nil {
+		event.Bytes = stats.DeletedSize
+		dbNames := make([]string, 0, len(stats.DatabaseStats))
+		for dbName := range stats.DatabaseStats {
+			dbNames = append(dbNames, dbName)
+		}
+		sort.Strings(dbNames)
+		for _, dbName := range dbNames {
+			dbStats := stats.DatabaseStats[dbName]
+			event.Databases = append(event.Databases, notify.DatabaseStats{
+				Name:  dbName,
+				Files: dbStats.DeletedFiles,
+				Bytes: dbStats.DeletedSize,
+			})
+		}
+	}
+	if err != nil {
+		event.Status = notify.StatusFailure
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// deleteJSONStats is the JSON form of the deletion statistics, sizes are raw
+// byte counts and times RFC3339, omitted when nothing was retained
+type deleteJSONStats struct {
+	TotalFiles     int    `json:"total_files"`
+	DeletedFiles   int    `json:"deleted_files"`
+	RetainedFiles  int    `json:"retained_files"`
+	DeletedBytes   int64  `json:"deleted_bytes"`
+	RetainedBytes  int64  `json:"retained_bytes"`
+	OldestRetained string `json:"oldest_retained,omitempty"`
+	NewestRetained string `json:"newest_retained,omitempty"`
+}
+
+// deleteJSONReport is the report printed by delete --output json
+type deleteJSONReport struct {
+	DryRun bool `json:"dry_run"`
+	deleteJSONStats
+	PrunedFolders int                        `json:"pruned_folders"`
+	Databases     map[string]deleteJSONStats `json:"databases"`
+}
+
+// printDeleteJSON prints the deletion statistics as JSON on stdout
+func printDeleteJSON(stats *command.DeleteStats, dryRun bool) error {
+	report := deleteJSONReport{
+		DryRun: dryRun,
+		deleteJSONStats: deleteJSONStats{
+			TotalFiles:     stats.TotalFiles,
+			DeletedFiles:   stats.DeletedFiles,
+			RetainedFiles:  stats.RetainedFiles,
+			DeletedBytes:   stats.DeletedSize,
+			RetainedBytes:  stats.RetainedSize,
+			OldestRetained: formatJSONTime(stats.OldestRetained),
+			NewestRetained: formatJSONTime(stats.NewestRetained),
+		},
+		PrunedFolders: stats.PrunedFolders,
+		Databases:     make(map[string]deleteJSONStats, len(stats.DatabaseStats)),
+	}
+	for dbName, dbStats := range stats.DatabaseStats {
+		report.Databases[dbName] = deleteJSONStats{
+			TotalFiles:     dbStats.TotalFiles,
+			DeletedFiles:   dbStats.DeletedFiles,
+			RetainedFiles:  dbStats.RetainedFiles,
+			DeletedBytes:   dbStats.DeletedSize,
+			RetainedBytes:  dbStats.RetainedSize,
+			OldestRetained: formatJSONTime(dbStats.OldestRetained),
+			NewestRetained: formatJSONTime(dbStats.NewestRetained),
+		}
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding deletion report: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// formatJSONTime formats t as RFC3339, the zero time becomes an empty string
+func formatJSONTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
 }
 
 // formatBytes formats a byte count into a human-readable string
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/notify"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	freshnessMaxAge time.Duration
+	freshnessNotify bool
+)
+
+var freshnessCmd = &cobra.Command{
+	Use:   "check-freshness",
+	Short: "Report databases that are missing recent backups",
+	Long: `Check that every configured database has a backup in S3 newer than --max-age.
+The newest object in each database folder is used as its last successful backup.
+Exits with a non-zero status if any database is stale or has no backups at all.
+With --notify the result is also sent to the configured notification channels.`,
+	RunE: ExecuteFreshness,
+}
+
+func ExecuteFreshness(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.Duration("max_age", freshnessMaxAge),
+	)
+	log.Info("Starting backup freshness check")
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	report, err := command.NewFreshnessCommand(s3Client, cfg).
+		WithMaxAge(freshnessMaxAge).
+		Execute(cmd.Context())
+	if err != nil {
+		log.Error("Error executing freshness check", zap.Error(err))
+		return fmt.Errorf("error executing freshness check: %v", err)
+	}
+
+	// Print report to console
+	fmt.Printf("\nBackup Freshness (max age %s):\n", freshnessMaxAge)
+	fmt.Printf("------------------------------\n")
+	for _, status := range report.Databases {
+		state := "OK"
+		if status.Stale {
+			state = "STALE"
+		}
+		newest := "never"
+		if !status.NewestBackup.IsZero() {
+			newest = fmt.Sprintf("%s (%s ago)", status.NewestBackup.Format(time.RFC3339), status.Age.Round(time.Minute))
+		}
+		fmt.Printf("%-6s %s: %s\n", state, status.Database, newest)
+	}
+
+	if freshnessNotify {
+		if err := notify.New(cfg.Notifications, cfg.CatalogPath).Notify(context.Background(), freshnessEvent(report)); err != nil {
+			log.Warn("Error sending notifications", zap.Error(err))
+		}
+	}
+
+	if report.StaleCount > 0 {
+		log.Warn("Stale backups found", zap.Int("stale_count", report.StaleCount))
+		return fmt.Errorf("%d database(s) have no backup newer than %s", report.StaleCount, freshnessMaxAge)
+	}
+
+	log.Info("All database backups are fresh")
+	return nil
+}
+
+// freshnessEvent reports stale databases as a failed check-freshness run
+func freshnessEvent(report *command.FreshnessReport) notify.Event {
+	event := notify.Event{
+		Command: "check-freshness",
+		Status:  notify.StatusSuccess,
+	}
+	var stale []string
+	for _, status := range report.Databases {
+		if status.Stale {
+			stale = append(stale, status.Database)
+		}
+	}
+	if len(stale) > 0 {
+		event.Status = notify.StatusFailure
+		event.Error = fmt.Sprintf("no backup newer than %s: %s", report.MaxAge, strings.Join(stale, ", "))
+		if len(stale) == 1 {
+			event.Database = stale[0]
+		}
+	}
+	return event
+}
+
+func init() {
+	rootCmd.AddCommand(freshnessCmd)
+	freshnessCmd.Flags().DurationVar(&freshnessMaxAge, "max-age", 24*time.Hour, "Maximum allowed age of the newest backup per database")
+	freshnessCmd.Flags().BoolVar(&freshnessNotify, "notify", false, "Send the result to the configured notification channels")
+}
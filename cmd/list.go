@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	listDatabase string
+	listJSON     bool
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backups stored in S3",
+	Long: `List the backups stored in the configured bucket, grouped by database folder
+and newest first, with their size and age. Use --database to show a single
+database and --json for machine-readable output.`,
+	RunE: ExecuteList,
+}
+
+func ExecuteList(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger, JSON output keeps stdout for the listing
+	initLogger := logger.Init
+	if listJSON {
+		initLogger = logger.InitStderr
+	}
+	if err := initLogger(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.String("database", listDatabase),
+	)
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	report, err := command.NewListCommand(s3Client, cfg).
+		WithDatabase(listDatabase).
+		Execute(cmd.Context())
+	if err != nil {
+		log.Error("Error listing backups", zap.Error(err))
+		return fmt.Errorf("error listing backups: %v", err)
+	}
+
+	if listJSON {
+		return printListJSON(report)
+	}
+
+	if len(report.Folders) == 0 {
+		fmt.Println("No backups found.")
+		return nil
+	}
+
+	now := time.Now()
+	for _, folder := range report.Folders {
+		header := fmt.Sprintf("%s (%d backups, %s)", folder.Folder, len(folder.Files), formatBytes(folder.TotalSize))
+		fmt.Printf("\n%s\n%s\n", header, strings.Repeat("-", len(header)))
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tSIZE\tAGE")
+		for _, file := range folder.Files {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.TrimPrefix(file.Key, folder.Folder+"/"), formatBytes(file.Size), formatAge(now.Sub(file.CreatedAt)))
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+// listJSONFile is the JSON form of a listed backup
+type listJSONFile struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size_bytes"`
+	CreatedAt string `json:"created_at"`
+}
+
+// listJSONFolder is the JSON form of a database folder
+type listJSONFolder struct {
+	Folder    string         `json:"folder"`
+	TotalSize int64          `json:"total_size_bytes"`
+	Files     []listJSONFile `json:"files"`
+}
+
+// printListJSON prints the listing as JSON on stdout
+func printListJSON(report *command.ListReport) error {
+	folders := make([]listJSONFolder, 0, len(report.Folders))
+	for _, folder := range report.Folders {
+		out := listJSONFolder{
+			Folder:    folder.Folder,
+			TotalSize: folder.TotalSize,
+			Files:     make([]listJSONFile, 0, len(folder.Files)),
+		}
+		for _, file := range folder.Files {
+			out.Files = append(out.Files, listJSONFile{
+				Key:       file.Key,
+				Size:      file.Size,
+				CreatedAt: file.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		folders = append(folders, out)
+	}
+
+	out, err := json.MarshalIndent(folders, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding listing: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// formatAge formats a duration as a short age such as "3d 4h" or "25m"
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", int(age.Hours())/24, int(age.Hours())%24)
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(age.Hours()), int(age.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVar(&listDatabase, "database", "", "Only list the backups of this database")
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Print the listing as JSON")
+}
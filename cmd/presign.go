@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var presignTTL time.Duration
+
+var presignCmd = &cobra.Command{
+	Use:   "presign <key>",
+	Short: "Print a time-limited download URL for a backup",
+	Long: `Print a presigned URL that downloads the backup stored under key without
+credentials, for handing a backup to someone without sharing the bucket
+credentials. The URL is valid for --ttl (1h by default, at most 7 days).
+Encrypted backups stay encrypted, the recipient still needs the key.`,
+	Args: cobra.ExactArgs(1),
+	RunE: ExecutePresign,
+}
+
+func ExecutePresign(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+	key := args[0]
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger, stdout is kept for the URL
+	if err := logger.InitStderr(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.String("key", key),
+		zap.Duration("ttl", presignTTL),
+	)
+
+	if presignTTL <= 0 || presignTTL > s3.MaxPresignTTL {
+		return fmt.Errorf("invalid --ttl %s: must be positive and at most %s", presignTTL, s3.MaxPresignTTL)
+	}
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	// Presigning works offline, make sure the link won't point at nothing
+	if _, err := s3Client.HeadObject(cmd.Context(), cfg.S3.Bucket, key); err != nil {
+		log.Error("Error looking up backup", zap.Error(err))
+		return fmt.Errorf("error looking up backup %s: %v", key, err)
+	}
+
+	url, err := s3Client.PresignGet(cfg.S3.Bucket, key, presignTTL)
+	if err != nil {
+		log.Error("Error presigning backup", zap.Error(err))
+		return fmt.Errorf("error presigning backup: %v", err)
+	}
+
+	fmt.Println(url)
+	log.Info("Presigned URL created", zap.Time("expires_at", time.Now().Add(presignTTL)))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(presignCmd)
+	presignCmd.Flags().DurationVar(&presignTTL, "ttl", time.Hour, "How long the URL stays valid, at most 168h")
+}
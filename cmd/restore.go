@@ -0,0 +1,778 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/restore"
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	restoreDryRun      bool
+	restoreTables      []string
+	restoreVerifyQuery string
+	restoreExpect      string
+	restoreYes         bool
+	restoreForce       bool
+	restoreBefore      string
+	restoreUntil       string
+	restoreAll         bool
+	restoreBundle      bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [database] [file]",
+	Short: "Restore a backup into a configured database",
+	Long: `Restore a backup into the database configured under the given name. The file is
+either a local path or an object key in the configured bucket, which is downloaded first.
+Encrypted backups (.enc) are decrypted and bundles are unpacked before restoring.
+Object keys below bundle/ are bundles, pass --bundle for a local bundle file.
+Instead of a file, --before selects the newest backup of the database in the bucket
+taken at or before the given time, bundles included. With --all, the file or the
+newest bundle taken at or before --before is unpacked and every configured database
+it holds a backup of is restored. For MySQL databases with incremental backups,
+--until restores the newest full backup taken before the given time and replays the
+binary logs of the incremental backups up to it.
+MySQL and PostgreSQL dumps are piped into mysql/psql, InfluxDB backups are restored
+with influx restore and SQLite databases with sqlite3 .restore.`,
+	Args: cobra.RangeArgs(0, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPaths, _ := cmd.Flags().GetStringArray("config")
+
+		// With --all the only argument is the bundle
+		var dbName string
+		fileArgs := args
+		switch {
+		case restoreAll && len(args) > 1:
+			return fmt.Errorf("--all restores every database of a bundle, pass only the bundle")
+		case restoreAll && (restoreUntil != "" || len(restoreTables) > 0 || restoreVerifyQuery != ""):
+			return fmt.Errorf("--all can't be combined with --until, --tables or --verify-query")
+		case !restoreAll && len(args) == 0:
+			return fmt.Errorf("a database is required, or --all to restore every database of a bundle")
+		case !restoreAll:
+			dbName, fileArgs = args[0], args[1:]
+		}
+
+		var backupFile string
+		var before, until time.Time
+		switch {
+		case len(fileArgs) == 1 && (restoreBefore != "" || restoreUntil != ""):
+			return fmt.Errorf("pass either a backup file, --before or --until, not several")
+		case restoreBefore != "" && restoreUntil != "":
+			return fmt.Errorf("pass either --before or --until, not both")
+		case len(fileArgs) == 1:
+			backupFile = fileArgs[0]
+		case restoreBefore != "":
+			var err error
+			before, err = parseTime("--before", restoreBefore)
+			if err != nil {
+				return err
+			}
+		case restoreUntil != "":
+			var err error
+			until, err = parseTime("--until", restoreUntil)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("a backup file, --before or --until is required")
+		}
+
+		// Load configuration
+		cfg, err := config.Load(configPaths...)
+		if err != nil {
+			return fmt.Errorf("error loading configuration: %v", err)
+		}
+
+		// Initialize logger
+		if err := logger.Init(cfg.Logger()); err != nil {
+			return fmt.Errorf("error initializing logger: %v", err)
+		}
+		defer logger.Sync()
+
+		log := logger.L().With(
+			zap.Strings("config_paths", configPaths),
+			zap.String("database", dbName),
+		)
+
+		if restoreExpect != "" && restoreVerifyQuery == "" {
+			return fmt.Errorf("--expect requires --verify-query")
+		}
+
+		if restoreAll {
+			return restoreAllFromBundle(cmd.Context(), cfg, backupFile, before)
+		}
+
+		db, ok := findDBConfig(cfg.DBConfigs, dbName)
+		if !ok {
+			log.Error("Database is not configured")
+			return fmt.Errorf("database %s is not configured", dbName)
+		}
+
+		// Unsupported verification queries fail before the database is touched
+		if restoreVerifyQuery != "" {
+			if _, err := restore.NewVerifyQueryCommand(db, restoreVerifyQuery, cfg.Binaries); err != nil {
+				return err
+			}
+		}
+
+		if cfg.IsProtected(db.Name) && !restoreForce && !restoreDryRun {
+			log.Error("Refusing to restore into a protected database")
+			return fmt.Errorf("database %s is protected, pass --force-protected to restore into it", dbName)
+		}
+
+		if !until.IsZero() {
+			return restoreToPointInTime(cmd.Context(), cfg, db, until)
+		}
+
+		// Pick the backup to restore from the bucket by its backup time
+		if backupFile == "" {
+			s3Client, err := s3.New(cfg.S3)
+			if err != nil {
+				log.Error("Error initializing S3 client", zap.Error(err))
+				return fmt.Errorf("error initializing S3 client: %v", err)
+			}
+			selected, err := command.NewSelectCommand(s3Client, cfg, db.Name).
+				WithBefore(before).
+				Execute(cmd.Context())
+			if err != nil {
+				log.Error("Error selecting backup", zap.Error(err))
+				return err
+			}
+			backupFile = selected.Key
+			fmt.Printf("Selected backup %s taken at %s\n", selected.Key, selected.BackupTime.Local().Format(time.RFC3339))
+		}
+		log = log.With(zap.String("file", backupFile))
+
+		// Restoring overwrites the live database, so ask before touching anything
+		if !restoreYes && !restoreDryRun {
+			if !confirmRestore(db, backupFile) {
+				log.Info("Restore cancelled")
+				fmt.Println("Restore cancelled.")
+				return nil
+			}
+		}
+
+		// Temporary files are removed once the restore is done, whatever its outcome
+		var tempPaths []string
+		defer func() { removeTempPaths(tempPaths) }()
+
+		dumpPath, err := fetchDump(cmd.Context(), cfg, db, backupFile, !before.IsZero(), &tempPaths)
+		if err != nil {
+			return err
+		}
+
+		opts := restore.Options{
+			Tables:   restoreTables,
+			Binaries: cfg.Binaries,
+		}
+
+		if restoreDryRun {
+			steps, err := restore.Plan(db, dumpPath, opts)
+			if err != nil {
+				return err
+			}
+			steps, err = withVerifyStep(steps, db, cfg.Binaries)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Dry run, the following commands would be executed:")
+			for _, step := range steps {
+				fmt.Println(step.String())
+			}
+			if len(restoreTables) > 0 {
+				fmt.Printf("with the dump filtered to tables: %s\n", strings.Join(restoreTables, ", "))
+			}
+			return nil
+		}
+
+		log.Info("Starting restore", zap.String("dump", dumpPath))
+		if err := restore.Restore(db, dumpPath, opts); err != nil {
+			return fmt.Errorf("error restoring %s: %v", dbName, err)
+		}
+
+		if err := runVerifyQuery(db, cfg.Binaries); err != nil {
+			return err
+		}
+
+		log.Info("Restore process completed successfully")
+		return nil
+	},
+}
+
+// restoreToPointInTime restores the newest full backup of the database taken at or
+// before until and replays the binary logs of the incremental backups taken since,
+// stopping at until. All backups are downloaded and the chain of binary logs is
+// checked for gaps before the database is touched.
+func restoreToPointInTime(ctx context.Context, cfg *config.Config, db backup.Config, until time.Time) error {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.Time("until", until),
+	)
+
+	if !backup.SupportsIncremental(db) {
+		return fmt.Errorf("--until requires a %s database with incremental set, %s has none", backup.MySQL, db.Name)
+	}
+	if len(restoreTables) > 0 {
+		return fmt.Errorf("--tables is not supported with --until, binary logs can't be filtered")
+	}
+
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+	chain, err := command.NewChainCommand(s3Client, cfg, db.Name).
+		WithUntil(until).
+		Execute(ctx)
+	if err != nil {
+		log.Error("Error selecting restore chain", zap.Error(err))
+		return err
+	}
+
+	fmt.Printf("Selected full backup %s taken at %s\n", chain.Full.Key, chain.Full.BackupTime.Local().Format(time.RFC3339))
+	for _, inc := range chain.Incrementals {
+		fmt.Printf("Selected incremental backup %s taken at %s\n", inc.Key, inc.BackupTime.Local().Format(time.RFC3339))
+	}
+	if !chain.Reaches(until) {
+		newest := chain.Full
+		if len(chain.Incrementals) > 0 {
+			newest = chain.Incrementals[len(chain.Incrementals)-1]
+		}
+		log.Warn("No incremental backup reaches the point in time", zap.Time("newest_backup_time", newest.BackupTime))
+		fmt.Printf("The newest backup was taken at %s, the database can only be restored up to then\n", newest.BackupTime.Local().Format(time.RFC3339))
+	}
+
+	if !restoreYes && !restoreDryRun {
+		target := fmt.Sprintf("%s and %d incremental backup(s) up to %s", chain.Full.Key, len(chain.Incrementals), until.Local().Format(time.RFC3339))
+		if !confirmRestore(db, target) {
+			log.Info("Restore cancelled")
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+	}
+
+	var tempPaths []string
+	defer func() { removeTempPaths(tempPaths) }()
+
+	dumpPath, err := fetchDump(ctx, cfg, db, chain.Full.Key, true, &tempPaths)
+	if err != nil {
+		return err
+	}
+	start, err := backup.DumpBinlogFile(dumpPath)
+	if err != nil {
+		log.Error("Error reading binary log position of full backup", zap.Error(err))
+		return fmt.Errorf("error reading binary log position of %s: %v", chain.Full.Key, err)
+	}
+
+	// Collect the binary logs of all incremental backups in one directory, in order
+	replayDir, err := restoreTempDir(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	tempPaths = append(tempPaths, replayDir)
+	var binlogs []string
+	for _, inc := range chain.Incrementals {
+		path, err := fetchDump(ctx, cfg, db, inc.Key, true, &tempPaths)
+		if err != nil {
+			return err
+		}
+		files, err := backup.BinlogFiles(path)
+		if err != nil {
+			return fmt.Errorf("error reading binary logs of %s: %v", inc.Key, err)
+		}
+		for _, file := range files {
+			name := filepath.Base(file)
+			if err := os.Rename(file, filepath.Join(replayDir, name)); err != nil {
+				return fmt.Errorf("error collecting binary log %s: %v", name, err)
+			}
+			binlogs = append(binlogs, name)
+		}
+	}
+	if err := backup.CheckBinlogChain(start, binlogs); err != nil {
+		log.Error("Incremental backup chain is incomplete", zap.String("start", start), zap.Error(err))
+		return fmt.Errorf("incremental backup chain of %s is incomplete, nothing was restored: %v", db.Name, err)
+	}
+	log.Info("Incremental backup chain is complete",
+		zap.String("start", start),
+		zap.Int("binlog_count", len(binlogs)))
+
+	sqlDir, err := restoreTempDir(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	tempPaths = append(tempPaths, sqlDir)
+	sqlPath := filepath.Join(sqlDir, "replay.sql")
+	opts := restore.Options{Binaries: cfg.Binaries}
+
+	if restoreDryRun {
+		steps, err := restore.Plan(db, dumpPath, opts)
+		if err != nil {
+			return err
+		}
+		if len(binlogs) > 0 {
+			replay, err := restore.PlanBinlogReplay(db, replayDir, binlogs, sqlPath, until, opts)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, replay...)
+		}
+		steps, err = withVerifyStep(steps, db, cfg.Binaries)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Dry run, the following commands would be executed:")
+		for _, step := range steps {
+			fmt.Println(step.String())
+		}
+		return nil
+	}
+
+	log.Info("Restoring full backup", zap.String("dump", dumpPath))
+	if err := restore.Restore(db, dumpPath, opts); err != nil {
+		return fmt.Errorf("error restoring %s: %v", db.Name, err)
+	}
+	if len(binlogs) > 0 {
+		log.Info("Replaying binary logs", zap.Strings("binlogs", binlogs))
+		if err := restore.ReplayBinlogs(db, replayDir, binlogs, sqlPath, until, opts); err != nil {
+			return fmt.Errorf("error replaying binary logs into %s: %v", db.Name, err)
+		}
+	}
+
+	if err := runVerifyQuery(db, cfg.Binaries); err != nil {
+		return err
+	}
+
+	log.Info("Restore process completed successfully")
+	return nil
+}
+
+// withVerifyStep appends the command running --verify-query to the restore steps
+func withVerifyStep(steps []restore.Step, db backup.Config, bins backup.Binaries) ([]restore.Step, error) {
+	if restoreVerifyQuery == "" {
+		return steps, nil
+	}
+	cmd, err := restore.NewVerifyQueryCommand(db, restoreVerifyQuery, bins)
+	if err != nil {
+		return nil, err
+	}
+	return append(steps, restore.Step{Cmd: cmd}), nil
+}
+
+// runVerifyQuery runs --verify-query against the restored database and prints its
+// result, failing if it doesn't match --expect
+func runVerifyQuery(db backup.Config, bins backup.Binaries) error {
+	if restoreVerifyQuery == "" {
+		return nil
+	}
+	result, err := restore.VerifyQuery(db, restoreVerifyQuery, restoreExpect, bins)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Verification query result: %s\n", result)
+	return nil
+}
+
+// restoreAllFromBundle restores every configured database the bundle holds a backup
+// of, or the newest bundle taken at or before before if bundleFile is empty. The
+// bundle is fetched and unpacked first, so the confirmation can name every database
+// and a broken bundle fails before any of them is touched.
+func restoreAllFromBundle(ctx context.Context, cfg *config.Config, bundleFile string, before time.Time) error {
+	log := logger.L()
+
+	if bundleFile == "" {
+		s3Client, err := s3.New(cfg.S3)
+		if err != nil {
+			log.Error("Error initializing S3 client", zap.Error(err))
+			return fmt.Errorf("error initializing S3 client: %v", err)
+		}
+		selected, err := command.NewSelectCommand(s3Client, cfg, backup.BundleFolderName).
+			WithBefore(before).
+			Execute(ctx)
+		if err != nil {
+			log.Error("Error selecting bundle", zap.Error(err))
+			return err
+		}
+		bundleFile = selected.Key
+		fmt.Printf("Selected bundle %s taken at %s\n", selected.Key, selected.BackupTime.Local().Format(time.RFC3339))
+	}
+	log = log.With(zap.String("file", bundleFile))
+
+	var tempPaths []string
+	defer func() { removeTempPaths(tempPaths) }()
+
+	bundlePath, err := fetchBackup(ctx, cfg, bundleFile, !before.IsZero(), &tempPaths)
+	if err != nil {
+		return err
+	}
+	extractDir, err := restoreTempDir(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	tempPaths = append(tempPaths, extractDir)
+
+	log.Info("Extracting bundle", zap.String("directory", extractDir))
+	members, err := bundleMembers(bundlePath, extractDir)
+	if err != nil {
+		log.Error("Error extracting bundle", zap.Error(err))
+		return err
+	}
+
+	// Databases are restored in the order they are configured
+	type target struct {
+		db       backup.Config
+		dumpPath string
+	}
+	var targets []target
+	for _, db := range cfg.DBConfigs {
+		memberPath, ok := members[db.Name]
+		if !ok {
+			continue
+		}
+		delete(members, db.Name)
+
+		if cfg.IsProtected(db.Name) && !restoreForce && !restoreDryRun {
+			log.Error("Refusing to restore into a protected database", zap.String("database", db.Name))
+			return fmt.Errorf("database %s is protected, pass --force-protected to restore into it", db.Name)
+		}
+		dumpPath, err := extractArchivedDump(cfg, db, memberPath, &tempPaths)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target{db: db, dumpPath: dumpPath})
+	}
+	for _, name := range slices.Sorted(maps.Keys(members)) {
+		log.Warn("Skipping backup of a database that is not configured", zap.String("database", name))
+		fmt.Printf("Skipping %s, it is not configured\n", name)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("bundle %s holds no backup of a configured database", bundleFile)
+	}
+
+	if !restoreYes && !restoreDryRun {
+		fmt.Printf("This will restore %s into:\n", bundleFile)
+		for _, t := range targets {
+			fmt.Printf("  %s\n", restoreTarget(t.db))
+		}
+		if !confirm() {
+			log.Info("Restore cancelled")
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+	}
+
+	opts := restore.Options{Binaries: cfg.Binaries}
+	if restoreDryRun {
+		fmt.Println("Dry run, the following commands would be executed:")
+		for _, t := range targets {
+			steps, err := restore.Plan(t.db, t.dumpPath, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("# %s\n", t.db.Name)
+			for _, step := range steps {
+				fmt.Println(step.String())
+			}
+		}
+		return nil
+	}
+
+	var restored []string
+	for _, t := range targets {
+		log.Info("Starting restore", zap.String("database", t.db.Name), zap.String("dump", t.dumpPath))
+		if err := restore.Restore(t.db, t.dumpPath, opts); err != nil {
+			if len(restored) > 0 {
+				return fmt.Errorf("error restoring %s after restoring %s: %v", t.db.Name, strings.Join(restored, ", "), err)
+			}
+			return fmt.Errorf("error restoring %s: %v", t.db.Name, err)
+		}
+		restored = append(restored, t.db.Name)
+		fmt.Printf("Restored %s\n", t.db.Name)
+	}
+
+	log.Info("Restore process completed successfully", zap.Strings("databases", restored))
+	return nil
+}
+
+// fetchDump prepares a backup of the database for restoring and returns the path
+// of the dump: the backup is fetched, the database's dump taken out of bundles
+// and archived dumps extracted. The temporary files it creates are added to
+// tempPaths.
+func fetchDump(ctx context.Context, cfg *config.Config, db backup.Config, backupFile string, download bool, tempPaths *[]string) (string, error) {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.String("file", backupFile),
+	)
+
+	dumpPath, err := fetchBackup(ctx, cfg, backupFile, download, tempPaths)
+	if err != nil {
+		return "", err
+	}
+
+	if isBundle(backupFile) {
+		extractDir, err := restoreTempDir(cfg.WorkDir)
+		if err != nil {
+			return "", err
+		}
+		*tempPaths = append(*tempPaths, extractDir)
+
+		log.Info("Extracting bundle", zap.String("directory", extractDir))
+		members, err := bundleMembers(dumpPath, extractDir)
+		if err != nil {
+			log.Error("Error extracting bundle", zap.Error(err))
+			return "", err
+		}
+		var ok bool
+		if dumpPath, ok = members[db.Name]; !ok {
+			return "", fmt.Errorf("bundle %s contains no backup of %s", backupFile, db.Name)
+		}
+	}
+
+	return extractArchivedDump(cfg, db, dumpPath, tempPaths)
+}
+
+// fetchBackup makes a backup available locally and returns its path: object keys
+// are downloaded (always with download) and encrypted backups decrypted. The
+// temporary files it creates are added to tempPaths.
+func fetchBackup(ctx context.Context, cfg *config.Config, backupFile string, download bool, tempPaths *[]string) (string, error) {
+	log := logger.L().With(zap.String("file", backupFile))
+
+	dumpPath := backupFile
+	if _, err := os.Stat(backupFile); download || os.IsNotExist(err) {
+		// Selected backups and anything that isn't a local file are object keys in the bucket
+		tempDir, err := restoreTempDir(cfg.WorkDir)
+		if err != nil {
+			return "", err
+		}
+		*tempPaths = append(*tempPaths, tempDir)
+
+		dumpPath, err = downloadBackup(ctx, cfg.S3, backupFile, tempDir)
+		if err != nil {
+			log.Error("Error downloading backup", zap.Error(err))
+			return "", err
+		}
+	} else if err != nil {
+		log.Error("Error reading backup file", zap.Error(err))
+		return "", fmt.Errorf("error reading backup file %s: %v", backupFile, err)
+	}
+	if strings.HasSuffix(dumpPath, ".enc") {
+		if !cfg.Encryption.Enabled {
+			return "", fmt.Errorf("backup file %s is encrypted but encryption is disabled in the configuration", backupFile)
+		}
+		encryptor, err := encryption.New(cfg.Encryption)
+		if err != nil {
+			log.Error("Error initializing encryptor", zap.Error(err))
+			return "", fmt.Errorf("error initializing encryptor: %v", err)
+		}
+		// The plaintext is written to the work directory, never next to the backup
+		decryptDir, err := restoreTempDir(cfg.WorkDir)
+		if err != nil {
+			return "", err
+		}
+		*tempPaths = append(*tempPaths, decryptDir)
+
+		log.Info("Decrypting backup file")
+		dumpPath, err = encryptor.DecryptFile(dumpPath, filepath.Join(decryptDir, strings.TrimSuffix(filepath.Base(dumpPath), ".enc")))
+		if err != nil {
+			log.Error("Error decrypting backup file", zap.Error(err))
+			return "", fmt.Errorf("error decrypting backup file: %v", err)
+		}
+	}
+	return dumpPath, nil
+}
+
+// extractArchivedDump returns the path of the dump to restore, extracting archived
+// dumps into a temporary directory that is added to tempPaths
+func extractArchivedDump(cfg *config.Config, db backup.Config, dumpPath string, tempPaths *[]string) (string, error) {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.String("file", dumpPath),
+	)
+
+	// Archived dumps (archive: true, InfluxDB and incremental backups) are restored from the extracted file or tree
+	if backup.IsArchivedDump(dumpPath) {
+		extractDir, err := restoreTempDir(cfg.WorkDir)
+		if err != nil {
+			return "", err
+		}
+		*tempPaths = append(*tempPaths, extractDir)
+
+		log.Info("Extracting dump", zap.String("directory", extractDir))
+		dumpPath, err = backup.ExtractDump(dumpPath, extractDir)
+		if err != nil {
+			log.Error("Error extracting dump", zap.Error(err))
+			return "", err
+		}
+	}
+	return dumpPath, nil
+}
+
+// removeTempPaths removes the temporary files of a restore
+func removeTempPaths(tempPaths []string) {
+	for _, path := range tempPaths {
+		if err := os.RemoveAll(path); err != nil {
+			logger.L().Warn("Error removing temporary restore file",
+				zap.String("path", path),
+				zap.Error(err))
+		}
+	}
+}
+
+// parseTime parses the time given to flag as RFC3339, "2006-01-02 15:04" or a
+// date, the latter two in local time
+func parseTime(flag, value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %s %q: use RFC3339, \"2006-01-02 15:04\" or a date", flag, value)
+}
+
+// findDBConfig returns the database configuration with the given name
+func findDBConfig(dbConfigs []backup.Config, name string) (backup.Config, bool) {
+	for _, db := range dbConfigs {
+		if db.Name == name {
+			return db, true
+		}
+	}
+	return backup.Config{}, false
+}
+
+// confirmRestore asks on the terminal whether the backup should overwrite the database
+func confirmRestore(db backup.Config, backupFile string) bool {
+	fmt.Printf("This will overwrite %s with %s.\n", restoreTarget(db), backupFile)
+	return confirm()
+}
+
+// restoreTarget describes the database a backup is restored into
+func restoreTarget(db backup.Config) string {
+	target := db.Name
+	switch {
+	case db.Type == backup.SQLite:
+		target += " (" + db.DBPath + ")"
+	case db.Host != "":
+		target += fmt.Sprintf(" on %s:%d", db.Host, db.Port)
+	default:
+		target += " on localhost"
+	}
+	if db.Container != "" {
+		target += " in container " + db.Container
+	}
+	return fmt.Sprintf("%s database %s", db.Type, target)
+}
+
+// confirm asks on the terminal whether to continue
+func confirm() bool {
+	fmt.Print("Continue? [y/N]: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// restoreTempDir creates a temporary directory in the work directory, or in the OS temp directory if none is set
+func restoreTempDir(workDir string) (string, error) {
+	if workDir != "" {
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create work directory: %v", err)
+		}
+	}
+	dir, err := os.MkdirTemp(workDir, "restore-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	return dir, nil
+}
+
+// downloadBackup downloads the object stored under key into dir and returns the local path
+func downloadBackup(ctx context.Context, s3Config s3.Config, key, dir string) (string, error) {
+	s3Adapter, err := s3.New(s3Config)
+	if err != nil {
+		return "", fmt.Errorf("error initializing S3 adapter: %v", err)
+	}
+
+	path := filepath.Join(dir, filepath.Base(key))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error creating download file: %v", err)
+	}
+	defer file.Close()
+
+	if err := s3Adapter.Download(ctx, s3Config.Bucket, key, file); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("error writing download file: %v", err)
+	}
+	return path, nil
+}
+
+// isBundle reports whether the backup is a bundle created by the backup command: an
+// object key in the bundle folder, or any file with --bundle. Archived dumps share
+// the .tar.gz suffix of bundles, so the file name can't tell them apart.
+func isBundle(backupFile string) bool {
+	return restoreBundle || strings.HasPrefix(backupFile, backup.BundleFolderName+"/")
+}
+
+// bundleMembers extracts the bundle into dir and returns the path of the dump of
+// every database it holds, by database name
+func bundleMembers(bundlePath, dir string) (map[string]string, error) {
+	files, err := backup.ExtractArchive(bundlePath, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting bundle: %v", err)
+	}
+
+	// Dumps are bundled as <database>/<file name>, file names may nest
+	members := make(map[string]string, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle entry %s: %v", file, err)
+		}
+		dbName, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if !nested {
+			return nil, fmt.Errorf("bundle entry %s is not below a database folder", rel)
+		}
+		if _, ok := members[dbName]; ok {
+			return nil, fmt.Errorf("bundle holds more than one backup of %s", dbName)
+		}
+		members[dbName] = file
+	}
+	return members, nil
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().BoolVarP(&restoreDryRun, "dry-run", "d", false, "Print the restore commands without executing them")
+	restoreCmd.Flags().StringSliceVar(&restoreTables, "tables", nil, "Only restore the given tables (MySQL and PostgreSQL)")
+	restoreCmd.Flags().StringVar(&restoreVerifyQuery, "verify-query", "", "SQL query to run against the database after the restore")
+	restoreCmd.Flags().StringVar(&restoreExpect, "expect", "", "Expected output of --verify-query, the restore fails on a mismatch")
+	restoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "Restore without asking for confirmation")
+	restoreCmd.Flags().BoolVar(&restoreForce, "force-protected", false, "Allow restoring into a database listed in protected_databases")
+	restoreCmd.Flags().StringVar(&restoreBefore, "before", "", "Restore the newest backup taken at or before this time instead of a given file")
+	restoreCmd.Flags().BoolVar(&restoreAll, "all", false, "Restore every configured database of a bundle")
+	restoreCmd.Flags().BoolVar(&restoreBundle, "bundle", false, "Treat a local backup file as a bundle, implied for object keys below bundle/")
+	restoreCmd.Flags().StringVar(&restoreUntil, "until", "", "Restore the newest full backup taken at or before this time and replay the incremental backups up to it (MySQL)")
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -10,12 +13,17 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "backup-agent",
 	Short: "A backup agent for various databases with encryption support",
-	Long: `A backup agent that supports backing up various databases (MySQL, PostgreSQL, InfluxDB)
-with optional encryption and S3 upload capabilities.`,
+	Long: `A backup agent that supports backing up various databases (MySQL, PostgreSQL, InfluxDB, Redis, SQLite,
+or any tool run as a custom command) with optional encryption and S3 upload capabilities.`,
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// SIGINT and SIGTERM cancel the context of the running command, which kills
+	// its dumps and uploads and returns once it has cleaned up
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -23,5 +31,6 @@ func Execute() {
 
 func init() {
 	// Add global flags here if needed
-	rootCmd.PersistentFlags().StringP("config", "c", "config.yaml", "path to config file")
+	rootCmd.PersistentFlags().StringArrayP("config", "c", []string{"config.yaml"},
+		"path to a config file or a directory of *.yaml files, repeat to merge several (later ones override earlier ones)")
 } 
\ No newline at end of file
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	rotateOldKeyFile    string
+	rotateOldKeyEnv     string
+	rotateNewKeyFile    string
+	rotateNewKeyEnv     string
+	rotateNewRecipients []string
+	rotateNewIdentity   string
+	rotateDryRun        bool
+)
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt the backups stored in S3 with a new key",
+	Long: `Re-encrypt every encrypted backup (.enc) of the configured databases with a new key.
+Each object is downloaded, decrypted with the old key, encrypted with the new key
+into the work directory and uploaded under the same key with the SHA-256 of the
+new ciphertext. The plaintext is streamed and never written to disk.
+
+Both keys use the configured encryption type. The old key defaults to the configured
+one, --old-key-file or --old-key-env read an AES key from a file or an environment
+variable instead. The new AES key is read with --new-key-file or --new-key-env, age
+and GPG backups are re-encrypted to the --new-recipient public keys. Keys are never
+passed on the command line, where other users and the shell history can see them.
+
+Every object is replaced in a single upload, so a failure leaves it encrypted with
+the old key. Backups already encrypted with the new key are skipped, so an
+interrupted or partially failed rotation is finished by running the command again.
+Switch the configuration to the new key once every backup has been rotated.`,
+	RunE: ExecuteRotateKey,
+}
+
+func ExecuteRotateKey(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.Bool("dry_run", rotateDryRun),
+	)
+	log.Info("Starting encryption key rotation")
+
+	if rotateNewKeyFile == "" && rotateNewKeyEnv == "" && len(rotateNewRecipients) == 0 {
+		return fmt.Errorf("--new-key-file, --new-key-env or --new-recipient is required")
+	}
+
+	// The old key defaults to the configured one
+	oldConfig := cfg.Encryption
+	if rotateOldKeyFile != "" || rotateOldKeyEnv != "" {
+		oldConfig = rotationConfig(cfg.Encryption, rotateOldKeyFile, rotateOldKeyEnv)
+		oldConfig.Recipients = cfg.Encryption.Recipients
+		oldConfig.IdentityFile = cfg.Encryption.IdentityFile
+	}
+	if !oldConfig.Enabled {
+		return fmt.Errorf("encryption is disabled in the configuration, pass the old key with --old-key-file or --old-key-env")
+	}
+	oldKey, err := encryption.New(oldConfig)
+	if err != nil {
+		log.Error("Error initializing encryptor for the old key", zap.Error(err))
+		return fmt.Errorf("error initializing encryptor for the old key: %v", err)
+	}
+	newConfig := rotationConfig(cfg.Encryption, rotateNewKeyFile, rotateNewKeyEnv)
+	newConfig.Recipients = rotateNewRecipients
+	newConfig.IdentityFile = rotateNewIdentity
+	newKey, err := encryption.New(newConfig)
+	if err != nil {
+		log.Error("Error initializing encryptor for the new key", zap.Error(err))
+		return fmt.Errorf("error initializing encryptor for the new key: %v", err)
+	}
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	report, err := command.NewRotateKeyCommand(s3Client, oldKey, newKey, cfg).
+		WithDryRun(rotateDryRun).
+		Execute(cmd.Context())
+	if err != nil {
+		log.Error("Error executing key rotation", zap.Error(err))
+		return fmt.Errorf("error executing key rotation: %v", err)
+	}
+
+	// Print report to console
+	fmt.Printf("\nKey Rotation:\n")
+	fmt.Printf("-------------\n")
+	for _, file := range report.Files {
+		if file.Err != nil {
+			fmt.Printf("%-15s %s (%d bytes): %v\n", file.Status, file.Key, file.Size, file.Err)
+			continue
+		}
+		fmt.Printf("%-15s %s (%d bytes)\n", file.Status, file.Key, file.Size)
+	}
+
+	if rotateDryRun {
+		fmt.Printf("\n%d file(s) would be re-encrypted\n", report.PendingCount)
+		fmt.Printf("\nNote: This was a dry run - no files were changed\n")
+		return nil
+	}
+	fmt.Printf("\n%d rotated, %d already rotated, %d failed\n", report.RotatedCount, report.SkippedCount, report.FailedCount)
+
+	if report.FailedCount > 0 {
+		log.Warn("Some backups were not rotated", zap.Int("failed_count", report.FailedCount))
+		return fmt.Errorf("%d backup(s) are still encrypted with the old key, run rotate-key again to retry them", report.FailedCount)
+	}
+
+	log.Info("Encryption key rotation completed successfully")
+	return nil
+}
+
+// rotationConfig returns an enabled encryption configuration of the configured
+// type whose AES key is read from keyFile or keyEnv
+func rotationConfig(base *encryption.Config, keyFile, keyEnv string) *encryption.Config {
+	return &encryption.Config{
+		Enabled: true,
+		Type:    base.Type,
+		KeyFile: keyFile,
+		KeyEnv:  keyEnv,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(rotateKeyCmd)
+	rotateKeyCmd.Flags().StringVar(&rotateOldKeyFile, "old-key-file", "", "File holding the base64 encoded key the backups are encrypted with (defaults to the configured key)")
+	rotateKeyCmd.Flags().StringVar(&rotateOldKeyEnv, "old-key-env", "", "Environment variable holding the base64 encoded key the backups are encrypted with")
+	rotateKeyCmd.Flags().StringVar(&rotateNewKeyFile, "new-key-file", "", "File holding the base64 encoded key to re-encrypt the backups with")
+	rotateKeyCmd.Flags().StringVar(&rotateNewKeyEnv, "new-key-env", "", "Environment variable holding the base64 encoded key to re-encrypt the backups with")
+	rotateKeyCmd.Flags().StringArrayVar(&rotateNewRecipients, "new-recipient", nil, "age public key or GPG key ID to re-encrypt the backups to, repeat for several")
+	rotateKeyCmd.Flags().StringVar(&rotateNewIdentity, "new-identity-file", "", "age identity file of the new recipients, used to skip backups that were already rotated")
+	rotateKeyCmd.Flags().BoolVarP(&rotateDryRun, "dry-run", "d", false, "List the backups that would be re-encrypted without changing them")
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/metrics"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// serving is set while the daemon runs, scheduled runs leave the metrics server to it
+var serving bool
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run backups and deletions on a schedule",
+	Long: `Run as a long-lived daemon that performs backups on the cron expression in
+schedule and applies the deletion rules on delete_schedule, if set. Databases
+with a schedule of their own are backed up on it, each on its own, and left out
+of the global schedule. All use the standard five-field cron format, e.g.
+"0 2 * * *" for 02:00 every day.
+
+The configuration is read again for every run, the schedules only when the
+daemon starts. A run is skipped while the previous run of the same kind or of
+the same database is still going, and runs never overlap: they share the
+catalog and the metrics, so one waits for the other. On SIGINT or SIGTERM no
+new runs are started and the daemon exits once the current run has finished, a
+second signal cancels the current run. With metrics enabled the metrics
+endpoint is served for the lifetime of the daemon.`,
+	RunE: ExecuteServe,
+}
+
+func ExecuteServe(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+	)
+
+	// Databases with a schedule of their own are backed up on it, the others on the global schedule
+	ownSchedule := make(map[string]string)
+	for _, db := range cfg.DBConfigs {
+		if db.Schedule != "" {
+			ownSchedule[db.Name] = db.Schedule
+		}
+	}
+	if cfg.Schedule == "" && len(ownSchedule) < len(cfg.DBConfigs) {
+		return fmt.Errorf("schedule must be set to run the daemon, unless every database has a schedule of its own")
+	}
+
+	serving = true
+	stopMetrics, err := metrics.Start(cfg.Metrics)
+	if err != nil {
+		log.Error("Error starting metrics server", zap.Error(err))
+		return fmt.Errorf("error starting metrics server: %v", err)
+	}
+	defer func() {
+		if err := stopMetrics(context.Background()); err != nil {
+			log.Warn("Error stopping metrics server", zap.Error(err))
+		}
+	}()
+
+	// Runs re-initialize the global logger, so the scheduler logs through logger.L()
+	scheduler := cron.New(cron.WithChain(cron.SkipIfStillRunning(cronLogger{})))
+	var runMu sync.Mutex
+	schedule := func(spec, name string, run func(*cobra.Command, []string) error) error {
+		_, err := scheduler.AddFunc(spec, func() {
+			runMu.Lock()
+			defer runMu.Unlock()
+			runScheduled(cmd, name, run)
+		})
+		if err != nil {
+			return fmt.Errorf("error scheduling %s: %v", name, err)
+		}
+		log.Info("Scheduled run", zap.String("command", name), zap.String("schedule", spec))
+		return nil
+	}
+
+	if cfg.Schedule != "" {
+		err := schedule(cfg.Schedule, "backup", func(cmd *cobra.Command, args []string) error {
+			return runBackup(cmd, false, func(db backup.Config) bool {
+				_, own := ownSchedule[db.Name]
+				return !own
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, db := range cfg.DBConfigs {
+		spec, ok := ownSchedule[db.Name]
+		if !ok {
+			continue
+		}
+		name := db.Name
+		err := schedule(spec, "backup of "+name, func(cmd *cobra.Command, args []string) error {
+			return runBackup(cmd, false, func(db backup.Config) bool {
+				return db.Name == name
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.DeleteSchedule != "" {
+		if err := schedule(cfg.DeleteSchedule, "delete", ExecuteDelete); err != nil {
+			return err
+		}
+	}
+	if cfg.IncrementalSchedule != "" {
+		if err := schedule(cfg.IncrementalSchedule, "incremental backup", ExecuteIncrementalBackup); err != nil {
+			return err
+		}
+	}
+
+	// The first SIGINT or SIGTERM cancels the context of the daemon, the runs get
+	// their own so the current one can finish. A second signal cancels it too.
+	signaled := cmd.Context()
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	defer cancelRuns()
+	cmd.SetContext(runCtx)
+
+	scheduler.Start()
+	log.Info("Backup daemon started")
+
+	<-signaled.Done()
+	logger.L().Info("Shutting down, waiting for the current run to finish, signal again to cancel it")
+	again := make(chan os.Signal, 1)
+	signal.Notify(again, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(again)
+	go func() {
+		select {
+		case <-again:
+			logger.L().Warn("Cancelling the current run")
+			cancelRuns()
+		case <-runCtx.Done():
+		}
+	}()
+
+	<-scheduler.Stop().Done()
+	logger.L().Info("Backup daemon stopped")
+	return nil
+}
+
+// runScheduled runs a command and logs its outcome, errors don't stop the daemon
+func runScheduled(cmd *cobra.Command, name string, run func(*cobra.Command, []string) error) {
+	start := time.Now()
+	logger.L().Info("Starting scheduled run", zap.String("command", name))
+
+	err := run(cmd, nil)
+
+	log := logger.L().With(
+		zap.String("command", name),
+		zap.Duration("duration", time.Since(start)),
+	)
+	if err != nil {
+		log.Error("Scheduled run failed", zap.Error(err))
+		return
+	}
+	log.Info("Scheduled run finished")
+}
+
+// cronLogger logs the scheduler's messages through the global logger
+type cronLogger struct{}
+
+func (cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	if msg == "skip" {
+		logger.L().Warn("Skipping scheduled run, the previous one is still going")
+		return
+	}
+	logger.L().Sugar().Debugw(msg, keysAndValues...)
+}
+
+func (cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	logger.L().Sugar().Errorw(msg, append(keysAndValues, "error", err)...)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
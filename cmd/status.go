@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Summarize the backup health of every database",
+	Long: `Print one line per configured database with the age, size and key of its
+newest backup in S3. A database whose newest backup is older than its
+expected_interval (24h by default, set globally or per database), or that has
+no backup at all, is marked STALE.
+Exits with a non-zero status if any database is stale, so it can drive alerts.`,
+	RunE: ExecuteStatus,
+}
+
+func ExecuteStatus(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+	)
+	log.Info("Starting backup status check")
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	report, err := command.NewFreshnessCommand(s3Client, cfg).
+		WithExpectedIntervals(true).
+		Execute(cmd.Context())
+	if err != nil {
+		log.Error("Error checking backup status", zap.Error(err))
+		return fmt.Errorf("error checking backup status: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tDATABASE\tAGE\tEXPECTED\tSIZE\tNEWEST BACKUP")
+	for _, status := range report.Databases {
+		state := "OK"
+		if status.Stale {
+			state = "STALE"
+		}
+		if status.NewestBackup.IsZero() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", state, status.Database, "never", formatAge(status.MaxAge), "-", "-")
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", state, status.Database, formatAge(status.Age),
+			formatAge(status.MaxAge), formatBytes(status.Size), status.NewestKey)
+	}
+	tw.Flush()
+
+	if report.StaleCount > 0 {
+		log.Warn("Stale backups found", zap.Int("stale_count", report.StaleCount))
+		return fmt.Errorf("%d of %d database(s) have no backup within their expected interval", report.StaleCount, len(report.Databases))
+	}
+
+	log.Info("All database backups are within their expected interval")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	verifyLatestOnly bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the backups stored in S3 are intact",
+	Long: `Download every backup of the configured databases and check it end to end.
+Objects uploaded with a SHA-256 checksum are compared against it, and encrypted
+backups (.enc) are decrypted with the configured key so a wrong key or a broken
+GCM tag is detected. Downloads are streamed and nothing is written to disk.
+Exits with a non-zero status if any backup is corrupt or can't be decrypted.`,
+	RunE: ExecuteVerify,
+}
+
+func ExecuteVerify(cmd *cobra.Command, args []string) error {
+	configPaths, _ := cmd.Flags().GetStringArray("config")
+
+	// Load configuration
+	cfg, err := config.Load(configPaths...)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %v", err)
+	}
+
+	// Initialize logger
+	if err := logger.Init(cfg.Logger()); err != nil {
+		return fmt.Errorf("error initializing logger: %v", err)
+	}
+	defer logger.Sync()
+
+	log := logger.L().With(
+		zap.Strings("config_paths", configPaths),
+		zap.Bool("latest_only", verifyLatestOnly),
+	)
+	log.Info("Starting backup verification")
+
+	// Initialize S3 client
+	s3Client, err := s3.New(cfg.S3)
+	if err != nil {
+		log.Error("Error initializing S3 client", zap.Error(err))
+		return fmt.Errorf("error initializing S3 client: %v", err)
+	}
+
+	// Initialize encryptor
+	encryptor, err := encryption.New(cfg.Encryption)
+	if err != nil {
+		log.Error("Error initializing encryptor", zap.Error(err))
+		return fmt.Errorf("error initializing encryptor: %v", err)
+	}
+
+	report, err := command.NewVerifyCommand(s3Client, encryptor, cfg).
+		WithLatestOnly(verifyLatestOnly).
+		Execute(cmd.Context())
+	if err != nil {
+		log.Error("Error executing verification", zap.Error(err))
+		return fmt.Errorf("error executing verification: %v", err)
+	}
+
+	// Print report to console
+	fmt.Printf("\nBackup Verification:\n")
+	fmt.Printf("--------------------\n")
+	for _, file := range report.Files {
+		state := "PASS"
+		detail := verifyDetail(file)
+		if file.Err != nil {
+			state = "FAIL"
+			detail = file.Err.Error()
+		}
+		fmt.Printf("%-4s %s (%d bytes): %s\n", state, file.Key, file.Size, detail)
+	}
+	fmt.Printf("\n%d file(s) checked, %d failed\n", len(report.Files), report.FailedCount)
+
+	if report.FailedCount > 0 {
+		log.Warn("Corrupt backups found", zap.Int("failed_count", report.FailedCount))
+		return fmt.Errorf("%d backup(s) are corrupt or can't be decrypted", report.FailedCount)
+	}
+
+	log.Info("All backups verified")
+	return nil
+}
+
+// verifyDetail describes which checks a passing file went through
+func verifyDetail(file command.VerifyResult) string {
+	switch {
+	case file.ChecksumChecked && file.Decrypted:
+		return "checksum matches, decrypted"
+	case file.ChecksumChecked:
+		return "checksum matches"
+	case file.Decrypted:
+		return "decrypted, no checksum stored"
+	default:
+		return "downloaded, no checksum stored"
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().BoolVar(&verifyLatestOnly, "latest-only", false, "Only verify the newest backup of every database")
+}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+// HeadBucket checks that the bucket exists and is reachable with the configured credentials
+func (s *S3) HeadBucket(ctx context.Context, bucket string) error {
+	s.log.Debug("Checking S3 bucket reachability",
+		zap.String("bucket", bucket))
+
+	svc := s3.New(s.session)
+
+	_, err := svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		s.log.Error("Error reaching S3 bucket",
+			zap.String("bucket", bucket),
+			zap.Error(err))
+		return fmt.Errorf("error reaching bucket %s: %v", bucket, err)
+	}
+
+	s.log.Debug("S3 bucket is reachable",
+		zap.String("bucket", bucket))
+	return nil
+}
+
+// EnsureBucket checks that the bucket exists and creates it in region when it
+// doesn't. A bucket that exists but can't be reached is reported as an error.
+func (s *S3) EnsureBucket(ctx context.Context, bucket, region string) error {
+	log := s.log.With(zap.String("bucket", bucket), zap.String("region", region))
+	svc := s3.New(s.session)
+
+	_, err := svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err == nil {
+		log.Debug("S3 bucket exists")
+		return nil
+	}
+	if !isBucketNotFound(err) {
+		log.Error("Error reaching S3 bucket", zap.Error(err))
+		return fmt.Errorf("error reaching bucket %s: %v", bucket, err)
+	}
+
+	log.Info("S3 bucket does not exist, creating it")
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the default location and must not be set as a constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+	if _, err := svc.CreateBucketWithContext(ctx, input); err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou {
+			log.Debug("S3 bucket was created concurrently")
+			return nil
+		}
+		log.Error("Error creating S3 bucket", zap.Error(err))
+		return fmt.Errorf("error creating bucket %s: %v", bucket, err)
+	}
+
+	log.Info("S3 bucket created")
+	return nil
+}
+
+// isBucketNotFound reports whether a HeadBucket error means the bucket doesn't
+// exist. HEAD responses have no body, so only the status code is reliable.
+func isBucketNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeNoSuchBucket || aerr.Code() == "NotFound")
+}
+
+// validateAccelerate checks that Transfer Acceleration is enabled on the bucket
+func (s *S3) validateAccelerate(bucket string) error {
+	if bucket == "" {
+		return fmt.Errorf("a bucket is required to use transfer acceleration")
+	}
+
+	// The accelerate configuration is read through the regular endpoint
+	svc := s3.New(s.session, aws.NewConfig().WithS3UseAccelerate(false))
+
+	output, err := svc.GetBucketAccelerateConfiguration(&s3.GetBucketAccelerateConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		s.log.Error("Error reading bucket accelerate configuration",
+			zap.String("bucket", bucket),
+			zap.Error(err))
+		return fmt.Errorf("error reading accelerate configuration of bucket %s: %v", bucket, err)
+	}
+
+	if aws.StringValue(output.Status) != s3.BucketAccelerateStatusEnabled {
+		s.log.Error("Transfer acceleration is not enabled on bucket",
+			zap.String("bucket", bucket),
+			zap.String("status", aws.StringValue(output.Status)))
+		return fmt.Errorf("transfer acceleration is not enabled on bucket %s", bucket)
+	}
+
+	s.log.Debug("Transfer acceleration is enabled on bucket",
+		zap.String("bucket", bucket))
+	return nil
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"path"
+	"strings"
+)
+
+const defaultContentType = "application/octet-stream"
+
+// contentTypes maps backup file extensions to their content types
+var contentTypes = map[string]string{
+	".sql":     "application/sql",
+	".gz":      "application/gzip",
+	".tgz":     "application/gzip",
+	".tar":     "application/x-tar",
+	".zip":     "application/zip",
+	".json":    "application/json",
+	".enc":     defaultContentType,
+	".influx":  defaultContentType,
+	".influx1": defaultContentType,
+	".rdb":     defaultContentType,
+	".sqlite":  "application/vnd.sqlite3",
+}
+
+// contentHeaders returns the Content-Type and Content-Encoding for an object key.
+// Explicit overrides from the config win, unknown extensions fall back to
+// application/octet-stream. A gzip-compressed single file (e.g. dump.sql.gz) is
+// served as the inner type with gzip encoding, while archives (.tar.gz) are
+// served as application/gzip.
+func (s *S3) contentHeaders(key string) (contentType, contentEncoding string) {
+	name := strings.ToLower(path.Base(key))
+	ext := path.Ext(name)
+
+	contentType = defaultContentType
+	if ct, ok := contentTypes[ext]; ok {
+		contentType = ct
+	}
+
+	if ext == ".gz" {
+		inner := path.Ext(strings.TrimSuffix(name, ext))
+		if ct, ok := contentTypes[inner]; ok && inner != ".tar" {
+			contentType = ct
+			contentEncoding = "gzip"
+		}
+	}
+
+	if s.config.ContentType != "" {
+		contentType = s.config.ContentType
+	}
+	if s.config.ContentEncoding != "" {
+		contentEncoding = s.config.ContentEncoding
+	}
+	return contentType, contentEncoding
+}
@@ -3,12 +3,48 @@ package s3
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"go.uber.org/zap"
 )
 
+// maxDeleteBatch is the maximum number of keys S3 accepts in a single DeleteObjects request
+const maxDeleteBatch = 1000
+
+// FailedDelete describes a key a batch delete could not remove
+type FailedDelete struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// DeleteError is returned by DeleteMultiple when some keys could not be deleted.
+// The keys not listed in Failed were deleted successfully.
+type DeleteError struct {
+	Failed []FailedDelete
+	Total  int
+}
+
+func (e *DeleteError) Error() string {
+	failed := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		failed[i] = fmt.Sprintf("%s (%s: %s)", f.Key, f.Code, f.Message)
+	}
+	return fmt.Sprintf("failed to delete %d of %d files: %s", len(e.Failed), e.Total, strings.Join(failed, ", "))
+}
+
+// Keys returns the keys that could not be deleted
+func (e *DeleteError) Keys() []string {
+	keys := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		keys[i] = f.Key
+	}
+	return keys
+}
+
 // Delete deletes a file from S3
 func (s *S3) Delete(ctx context.Context, bucket, key string) error {
 	s.log.Info("Deleting file from S3",
@@ -17,9 +53,12 @@ func (s *S3) Delete(ctx context.Context, bucket, key string) error {
 
 	svc := s3.New(s.session)
 
-	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+	err := s.withDeleteRetry(ctx, key, func() error {
+		_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 	if err != nil {
 		s.log.Error("Error deleting file from S3",
@@ -34,3 +73,106 @@ func (s *S3) Delete(ctx context.Context, bucket, key string) error {
 		zap.String("key", key))
 	return nil
 }
+
+// DeleteMultiple deletes files from S3 using batched DeleteObjects requests of up
+// to 1000 keys. Keys S3 fails to delete are reported in a *DeleteError; a request
+// that fails as a whole aborts the remaining batches.
+func (s *S3) DeleteMultiple(ctx context.Context, bucket string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	s.log.Info("Deleting files from S3",
+		zap.String("bucket", bucket),
+		zap.Int("file_count", len(keys)))
+
+	svc := s3.New(s.session)
+
+	var failed []FailedDelete
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		batch := keys[start:min(start+maxDeleteBatch, len(keys))]
+
+		batchFailed, err := s.deleteBatch(ctx, svc, bucket, batch)
+		if err != nil {
+			s.log.Error("Error deleting files from S3",
+				zap.String("bucket", bucket),
+				zap.Int("batch_size", len(batch)),
+				zap.Error(err))
+			return fmt.Errorf("error deleting %d files starting at %s: %v", len(batch), batch[0], err)
+		}
+		failed = append(failed, batchFailed...)
+
+		s.log.Debug("Deleted batch of files from S3",
+			zap.String("bucket", bucket),
+			zap.Int("batch_size", len(batch)),
+			zap.Int("failed", len(batchFailed)))
+	}
+
+	if len(failed) > 0 {
+		for _, f := range failed {
+			s.log.Error("Error deleting file from S3",
+				zap.String("bucket", bucket),
+				zap.String("key", f.Key),
+				zap.String("code", f.Code),
+				zap.String("message", f.Message))
+		}
+		return &DeleteError{Failed: failed, Total: len(keys)}
+	}
+
+	s.log.Info("Files deleted successfully",
+		zap.String("bucket", bucket),
+		zap.Int("file_count", len(keys)))
+	return nil
+}
+
+// deleteBatch deletes up to maxDeleteBatch keys in one DeleteObjects request and
+// returns the keys S3 reported as failed. Keys failing with throttling errors are
+// retried with the same backoff as single deletes.
+func (s *S3) deleteBatch(ctx context.Context, svc *s3.S3, bucket string, keys []string) ([]FailedDelete, error) {
+	pending := keys
+	var failed, throttled []FailedDelete
+	var requestErr error
+
+	err := s.withDeleteRetry(ctx, keys[0], func() error {
+		objects := make([]*s3.ObjectIdentifier, len(pending))
+		for i, key := range pending {
+			objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		output, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if requestErr = err; err != nil {
+			return err
+		}
+
+		// Keep throttled keys pending for the next attempt, other failures are permanent
+		throttled = nil
+		pending = nil
+		for _, e := range output.Errors {
+			f := FailedDelete{
+				Key:     aws.StringValue(e.Key),
+				Code:    aws.StringValue(e.Code),
+				Message: aws.StringValue(e.Message),
+			}
+			if throttlingCodes[f.Code] {
+				throttled = append(throttled, f)
+				pending = append(pending, f.Key)
+				continue
+			}
+			failed = append(failed, f)
+		}
+		if len(throttled) > 0 {
+			return awserr.New(throttled[0].Code, throttled[0].Message, nil)
+		}
+		return nil
+	})
+	if err != nil && (requestErr != nil || len(throttled) == 0) {
+		return nil, err
+	}
+	return append(failed, throttled...), nil
+}
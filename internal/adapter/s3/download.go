@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.uber.org/zap"
+)
+
+// Download fetches the object stored under key and writes its content to w
+func (s *S3) Download(ctx context.Context, bucket, key string, w io.Writer) error {
+	s.log.Info("Starting S3 download",
+		zap.String("bucket", bucket),
+		zap.String("key", key))
+
+	// Parts are fetched one at a time so they arrive in order for a plain io.Writer
+	downloader := s3manager.NewDownloader(s.session, func(d *s3manager.Downloader) {
+		d.Concurrency = 1
+	})
+
+	n, err := downloader.DownloadWithContext(ctx, &sequentialWriterAt{w: w}, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		s.log.Error("Error during S3 download",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return fmt.Errorf("error downloading %s: %v", key, err)
+	}
+
+	s.log.Info("Content downloaded successfully",
+		zap.String("key", key),
+		zap.Int64("size", n))
+	return nil
+}
+
+// sequentialWriterAt adapts an io.Writer for the downloader, which only writes
+// parts in order when its concurrency is 1
+type sequentialWriterAt struct {
+	w      io.Writer
+	offset int64
+}
+
+// WriteAt writes p to the underlying writer, rejecting out of order writes
+func (s *sequentialWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off != s.offset {
+		return 0, fmt.Errorf("out of order write at offset %d, expected %d", off, s.offset)
+	}
+	n, err := s.w.Write(p)
+	s.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,225 @@
+//go:build integration
+
+package s3_test
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/command"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/checksum"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+)
+
+// The integration tests run the S3 adapter against MinIO:
+//
+//	go test -tags integration ./internal/adapter/s3/
+//
+// MinIO is started with testcontainers, which needs Docker. Set
+// BACKUP_TEST_S3_ENDPOINT (and BACKUP_TEST_S3_ACCESS_KEY, BACKUP_TEST_S3_SECRET_KEY,
+// minioadmin by default) to run them against an already running store instead.
+const minioImage = "minio/minio:RELEASE.2024-01-16T16-07-38Z"
+
+// s3Endpoint, s3AccessKey and s3SecretKey address the store the tests run against
+var s3Endpoint, s3AccessKey, s3SecretKey string
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	s3Endpoint = os.Getenv("BACKUP_TEST_S3_ENDPOINT")
+	s3AccessKey = envOr("BACKUP_TEST_S3_ACCESS_KEY", "minioadmin")
+	s3SecretKey = envOr("BACKUP_TEST_S3_SECRET_KEY", "minioadmin")
+	if s3Endpoint != "" {
+		return m.Run()
+	}
+
+	ctx := context.Background()
+	container, err := minio.Run(ctx, minioImage,
+		minio.WithUsername(s3AccessKey),
+		minio.WithPassword(s3SecretKey))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error starting MinIO: %v\n", err)
+		return 1
+	}
+	defer testcontainers.TerminateContainer(container)
+
+	address, err := container.ConnectionString(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading MinIO address: %v\n", err)
+		return 1
+	}
+	s3Endpoint = "http://" + address
+	return m.Run()
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newBucket returns an adapter for a fresh bucket named after the test
+func newBucket(t *testing.T) (*s3.S3, s3.Config) {
+	t.Helper()
+
+	name := strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-"))
+	cfg := s3.Config{
+		AccessKey:      s3AccessKey,
+		SecretKey:      s3SecretKey,
+		Endpoint:       s3Endpoint,
+		Region:         "us-east-1",
+		Bucket:         fmt.Sprintf("it-%.40s-%d", name, time.Now().UnixNano()),
+		ForcePathStyle: true,
+	}
+	client, err := s3.New(cfg)
+	if err != nil {
+		t.Fatalf("error creating S3 adapter: %v", err)
+	}
+	if err := client.EnsureBucket(context.Background(), cfg.Bucket, cfg.Region); err != nil {
+		t.Fatalf("error creating bucket: %v", err)
+	}
+	return client, cfg
+}
+
+// upload stores content under folder/file and returns its object key
+func upload(t *testing.T, client *s3.S3, bucket, folder, file string, content []byte) string {
+	t.Helper()
+
+	sum, _, err := checksum.SHA256(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Upload(context.Background(), bucket, s3.UploadRequest{
+		FolderName: folder,
+		FileName:   file,
+		Content:    bytes.NewReader(content),
+		Checksum:   sum,
+		BackupTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("error uploading %s/%s: %v", folder, file, err)
+	}
+	return client.ObjectKey(folder, file)
+}
+
+// listKeys returns the sorted object keys below prefix
+func listKeys(t *testing.T, client *s3.S3, bucket, prefix string) []string {
+	t.Helper()
+
+	resp, err := client.List(context.Background(), bucket, prefix)
+	if err != nil {
+		t.Fatalf("error listing %s: %v", prefix, err)
+	}
+	keys := make([]string, 0, len(resp.Files))
+	for _, file := range resp.Files {
+		keys = append(keys, file.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUploadListDownloadDelete(t *testing.T) {
+	ctx := context.Background()
+	client, cfg := newBucket(t)
+
+	small := []byte("CREATE TABLE orders (id INT);\n")
+	// Larger than the 5 MB part size, uploaded in parts
+	large := make([]byte, 6<<20)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+	smallKey := upload(t, client, cfg.Bucket, "shop", "shop_2024-06-01-00-00-00.sql", small)
+	largeKey := upload(t, client, cfg.Bucket, "shop", "shop_2024-06-02-00-00-00.sql", large)
+
+	if keys := listKeys(t, client, cfg.Bucket, "shop/"); len(keys) != 2 || keys[0] != smallKey || keys[1] != largeKey {
+		t.Fatalf("listed %v, want %s and %s", keys, smallKey, largeKey)
+	}
+
+	for key, content := range map[string][]byte{smallKey: small, largeKey: large} {
+		var downloaded bytes.Buffer
+		if err := client.Download(ctx, cfg.Bucket, key, &downloaded); err != nil {
+			t.Fatalf("error downloading %s: %v", key, err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), content) {
+			t.Errorf("downloaded %d bytes of %s, want the %d uploaded", downloaded.Len(), key, len(content))
+		}
+		sum, size, err := checksum.SHA256(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.VerifyObject(ctx, cfg.Bucket, key, sum, size); err != nil {
+			t.Errorf("verification of %s failed: %v", key, err)
+		}
+	}
+
+	if err := client.Delete(ctx, cfg.Bucket, smallKey); err != nil {
+		t.Fatalf("error deleting %s: %v", smallKey, err)
+	}
+	if keys := listKeys(t, client, cfg.Bucket, "shop/"); len(keys) != 1 || keys[0] != largeKey {
+		t.Fatalf("listed %v after deleting %s, want only %s", keys, smallKey, largeKey)
+	}
+	if err := client.DeleteMultiple(ctx, cfg.Bucket, []string{largeKey}); err != nil {
+		t.Fatalf("error deleting %s: %v", largeKey, err)
+	}
+	if keys := listKeys(t, client, cfg.Bucket, "shop/"); len(keys) != 0 {
+		t.Fatalf("listed %v after deleting every backup, want none", keys)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	client, s3Config := newBucket(t)
+
+	// Retention orders backups by their LastModified time, a second apart
+	var fulls, incrementals []string
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			time.Sleep(1100 * time.Millisecond)
+		}
+		fulls = append(fulls, upload(t, client, s3Config.Bucket, "shop", fmt.Sprintf("shop_full-%d.sql", i), []byte("full")))
+		incrementals = append(incrementals, upload(t, client, s3Config.Bucket, backup.IncrementalFolderName("shop"),
+			fmt.Sprintf("shop_inc-%d.binlog.tar.gz", i), []byte("incremental")))
+	}
+	other := upload(t, client, s3Config.Bucket, "crm", "crm_full-0.sql", []byte("full"))
+
+	cfg := &config.Config{
+		S3:            s3Config,
+		DeletionRules: config.DeletionRules{Enabled: true, MaxCount: 3},
+		DBConfigs: []backup.Config{
+			{Name: "shop", Type: backup.MySQL, Incremental: true},
+			{Name: "crm", Type: backup.MySQL},
+		},
+	}
+	stats, err := command.NewDeleteCommand(client, cfg).Execute(ctx)
+	if err != nil {
+		t.Fatalf("error applying retention: %v", err)
+	}
+
+	// The newest three full backups and the incremental backups taken since the oldest of them
+	if keys := listKeys(t, client, s3Config.Bucket, "shop/"); strings.Join(keys, ",") != strings.Join(fulls[2:], ",") {
+		t.Errorf("retained full backups %v, want %v", keys, fulls[2:])
+	}
+	if keys := listKeys(t, client, s3Config.Bucket, backup.IncrementalFolderName("shop")+"/"); strings.Join(keys, ",") != strings.Join(incrementals[2:], ",") {
+		t.Errorf("retained incremental backups %v, want %v", keys, incrementals[2:])
+	}
+	if keys := listKeys(t, client, s3Config.Bucket, "crm/"); len(keys) != 1 || keys[0] != other {
+		t.Errorf("retained %v of the other database, want %s", keys, other)
+	}
+	if stats.DeletedFiles != 4 {
+		t.Errorf("deleted %d files, want 4", stats.DeletedFiles)
+	}
+}
@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// corruptingStore is a fake S3 that stores objects and can flip a byte of them,
+// in transit before checking their Content-MD5 or at rest after storing them.
+// Multipart uploads are assembled from their parts on completion.
+type corruptingStore struct {
+	mu             sync.Mutex
+	objects        map[string][]byte
+	parts          map[string]map[int][]byte
+	corruptTransit bool
+	corruptStored  bool
+	// unsigned counts the PUT requests that arrived without a Content-MD5
+	unsigned int
+}
+
+func (f *corruptingStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodPost:
+		if query.Has("uploads") {
+			fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+			return
+		}
+		parts := f.parts[r.URL.Path]
+		var body []byte
+		for number := 1; number <= len(parts); number++ {
+			body = append(body, parts[number]...)
+		}
+		delete(f.parts, r.URL.Path)
+		f.store(r.URL.Path, body)
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if f.corruptTransit {
+			body[0] ^= 0xff
+		}
+		if expected := r.Header.Get("Content-MD5"); expected != "" {
+			sum := md5.Sum(body)
+			if base64.StdEncoding.EncodeToString(sum[:]) != expected {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "<Error><Code>BadDigest</Code><Message>The Content-MD5 you specified did not match what we received.</Message></Error>")
+				return
+			}
+		} else {
+			f.unsigned++
+		}
+		if query.Has("partNumber") {
+			number, _ := strconv.Atoi(query.Get("partNumber"))
+			if f.parts[r.URL.Path] == nil {
+				f.parts[r.URL.Path] = make(map[int][]byte)
+			}
+			f.parts[r.URL.Path][number] = body
+		} else {
+			f.store(r.URL.Path, body)
+		}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodDelete:
+		delete(f.parts, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// store keeps an uploaded object, flipping a byte of it when corruptStored is set
+func (f *corruptingStore) store(path string, body []byte) {
+	if f.corruptStored {
+		body[len(body)/2] ^= 0xff
+	}
+	f.objects[path] = body
+}
+
+func newCorruptingStore(t *testing.T, store *corruptingStore) *S3 {
+	t.Helper()
+
+	store.objects = make(map[string][]byte)
+	store.parts = make(map[string]map[int][]byte)
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+
+	adapter, err := New(Config{
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		Endpoint:       server.URL,
+		Region:         "us-east-1",
+		ForcePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating adapter: %v", err)
+	}
+	return adapter
+}
+
+// TestUploadRejectsBodyCorruptedInTransit guards the integrity check the adapter
+// relies on: the SDK sends a Content-MD5 with every PutObject and UploadPart, for
+// seekable and streamed bodies alike, so S3 rejects bytes flipped on the way
+func TestUploadRejectsBodyCorruptedInTransit(t *testing.T) {
+	small := []byte(strings.Repeat("encrypted backup ", 64))
+	// Two parts of the minimum part size and a short final one
+	large := bytes.Repeat([]byte{0x5a}, 2*int(s3manager.MinUploadPartSize)+100)
+
+	tests := []struct {
+		name    string
+		content func() io.Reader
+		size    int
+	}{
+		{name: "single part", content: func() io.Reader { return bytes.NewReader(small) }, size: len(small)},
+		{name: "multipart", content: func() io.Reader { return bytes.NewReader(large) }, size: len(large)},
+		// io.MultiReader hides the Seek method of the underlying reader
+		{name: "streamed single part", content: func() io.Reader { return io.MultiReader(bytes.NewReader(small)) }, size: len(small)},
+		{name: "streamed multipart", content: func() io.Reader { return io.MultiReader(bytes.NewReader(large)) }, size: len(large)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			intact := &corruptingStore{}
+			adapter := newCorruptingStore(t, intact)
+			if err := adapter.UploadObject(ctx, "bucket", "shop/shop.sql.enc", UploadRequest{Content: tt.content()}); err != nil {
+				t.Fatalf("UploadObject() error = %v", err)
+			}
+			if intact.unsigned > 0 {
+				t.Errorf("%d uploaded bodies had no Content-MD5", intact.unsigned)
+			}
+			if got := len(intact.objects["/bucket/shop/shop.sql.enc"]); got != tt.size {
+				t.Errorf("stored %d bytes, want %d", got, tt.size)
+			}
+
+			adapter = newCorruptingStore(t, &corruptingStore{corruptTransit: true})
+			err := adapter.UploadObject(ctx, "bucket", "shop/shop.sql.enc", UploadRequest{Content: tt.content()})
+			if err == nil || !strings.Contains(err.Error(), "BadDigest") {
+				t.Errorf("UploadObject() error = %v, want the corrupted body rejected with BadDigest", err)
+			}
+		})
+	}
+}
+
+func TestVerifyObjectDetectsFlippedByte(t *testing.T) {
+	content := []byte(strings.Repeat("encrypted backup ", 64))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		corrupt bool
+	}{
+		{name: "intact", corrupt: false},
+		{name: "flipped byte", corrupt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := newCorruptingStore(t, &corruptingStore{corruptStored: tt.corrupt})
+			ctx := context.Background()
+			if err := adapter.UploadObject(ctx, "bucket", "shop/shop.sql.enc", UploadRequest{Content: bytes.NewReader(content)}); err != nil {
+				t.Fatalf("UploadObject() error = %v", err)
+			}
+
+			err := adapter.VerifyObject(ctx, "bucket", "shop/shop.sql.enc", checksum, int64(len(content)))
+			if tt.corrupt && (err == nil || !strings.Contains(err.Error(), "checksum mismatch")) {
+				t.Errorf("VerifyObject() error = %v, want a checksum mismatch", err)
+			}
+			if !tt.corrupt && err != nil {
+				t.Errorf("VerifyObject() error = %v", err)
+			}
+		})
+	}
+}
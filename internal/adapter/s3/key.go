@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// SanitizeKeyComponent makes a folder or file name safe to use in an object key:
+// spaces become underscores, other unsafe characters are stripped and the
+// result is optionally lowercased
+func SanitizeKeyComponent(name string, lowercase bool) string {
+	sanitized := strings.ReplaceAll(name, " ", "_")
+	sanitized = unsafeKeyChars.ReplaceAllString(sanitized, "")
+	if lowercase {
+		sanitized = strings.ToLower(sanitized)
+	}
+	return sanitized
+}
+
+// KeyComponent returns the folder or file name as it appears in object keys,
+// sanitized if key sanitization is enabled
+func (s *S3) KeyComponent(name string) string {
+	if !s.config.SanitizeKeys {
+		return name
+	}
+
+	sanitized := SanitizeKeyComponent(name, s.config.LowercaseKeys)
+	if sanitized != name {
+		s.log.Debug("Sanitized object key component",
+			zap.String("original", name),
+			zap.String("sanitized", sanitized))
+	}
+	return sanitized
+}
+
+// ObjectKey builds the object key for a file in a folder, as used by the upload methods.
+// File names may contain "/" to nest the file below the folder, each part is sanitized on its own.
+func (s *S3) ObjectKey(folderName, fileName string) string {
+	parts := strings.Split(fileName, "/")
+	for i, part := range parts {
+		parts[i] = s.KeyComponent(part)
+	}
+	return fmt.Sprintf("%s/%s", s.KeyComponent(folderName), strings.Join(parts, "/"))
+}
@@ -3,6 +3,9 @@ package s3
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -50,4 +53,77 @@ func (s *S3) List(ctx context.Context, bucket, prefix string) (*ListResponse, er
 	return &ListResponse{
 		Files: files,
 	}, nil
-}
\ No newline at end of file
+}
+
+// MultiListResponse represents the response from listing several prefixes in S3
+type MultiListResponse struct {
+	Files    []FileInfo               // Files of every prefix that was listed successfully
+	Prefixes map[string]*ListResponse // Per-prefix results, failed prefixes carry their Error
+}
+
+// Err returns an error describing every prefix that failed to list, or nil
+func (r *MultiListResponse) Err() error {
+	var failed []string
+	for prefix, resp := range r.Prefixes {
+		if resp.Error != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", prefix, resp.Error))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("error listing %d prefix(es): %s", len(failed), strings.Join(failed, "; "))
+}
+
+// ListMultiple lists several prefixes concurrently with at most concurrency
+// listings in flight and merges their files
+func (s *S3) ListMultiple(ctx context.Context, bucket string, prefixes []string, concurrency int) *MultiListResponse {
+	if concurrency <= 0 {
+		concurrency = s.config.ListConcurrency
+	}
+	s.log.Info("Listing multiple prefixes in S3",
+		zap.String("bucket", bucket),
+		zap.Int("prefix_count", len(prefixes)),
+		zap.Int("concurrency", concurrency))
+
+	result := &MultiListResponse{
+		Prefixes: make(map[string]*ListResponse, len(prefixes)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	seen := make(map[string]bool, len(prefixes))
+	for _, prefix := range prefixes {
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(prefix string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			resp, err := s.List(ctx, bucket, prefix)
+			if err != nil {
+				resp = &ListResponse{Error: err}
+			}
+
+			mu.Lock()
+			result.Prefixes[prefix] = resp
+			result.Files = append(result.Files, resp.Files...)
+			mu.Unlock()
+		}(prefix)
+	}
+	wg.Wait()
+
+	s.log.Info("Multiple prefixes listed",
+		zap.String("bucket", bucket),
+		zap.Int("prefix_count", len(result.Prefixes)),
+		zap.Int("file_count", len(result.Files)))
+	return result
+}
@@ -0,0 +1,154 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.uber.org/zap"
+)
+
+// IncompleteUpload is a multipart upload that was started but neither completed
+// nor aborted, its uploaded parts are stored and billed until it's aborted
+type IncompleteUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// abortTimeout bounds aborting a failed multipart upload, which runs after the
+// upload's context may have been cancelled
+const abortTimeout = 30 * time.Second
+
+// abortFailedUpload aborts the multipart upload behind a failed upload so its
+// uploaded parts aren't left behind and billed. The uploader would abort it with
+// the upload's context, which fails right away when the upload failed because the
+// run was cancelled, so it leaves the parts and they're aborted here instead.
+func (s *S3) abortFailedUpload(ctx context.Context, bucket, key string, uploadErr error) {
+	var failure s3manager.MultiUploadFailure
+	if !errors.As(uploadErr, &failure) || failure.UploadID() == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+
+	if err := s.AbortUpload(ctx, bucket, IncompleteUpload{Key: key, UploadID: failure.UploadID()}); err != nil {
+		s.log.Warn("Error aborting failed multipart upload, its parts are left in the bucket",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.String("upload_id", failure.UploadID()),
+			zap.Error(err))
+		return
+	}
+	s.log.Info("Aborted failed multipart upload",
+		zap.String("bucket", bucket),
+		zap.String("key", key),
+		zap.String("upload_id", failure.UploadID()))
+}
+
+// ListIncompleteUploads lists the multipart uploads below the prefixes of the
+// bucket that were started before cutoff and are still incomplete, oldest first.
+// Uploads of other keys, e.g. of other tools sharing the bucket, are never listed.
+func (s *S3) ListIncompleteUploads(ctx context.Context, bucket string, prefixes []string, cutoff time.Time) ([]IncompleteUpload, error) {
+	s.log.Info("Listing incomplete multipart uploads",
+		zap.String("bucket", bucket),
+		zap.Strings("prefixes", prefixes),
+		zap.Time("cutoff", cutoff))
+
+	svc := s3.New(s.session)
+	var uploads []IncompleteUpload
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		input := &s3.ListMultipartUploadsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}
+		err := svc.ListMultipartUploadsPagesWithContext(ctx, input, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+			for _, upload := range page.Uploads {
+				initiated := aws.TimeValue(upload.Initiated)
+				uploadID := aws.StringValue(upload.UploadId)
+				if !initiated.Before(cutoff) || seen[uploadID] {
+					continue
+				}
+				seen[uploadID] = true
+				uploads = append(uploads, IncompleteUpload{
+					Key:       aws.StringValue(upload.Key),
+					UploadID:  uploadID,
+					Initiated: initiated,
+				})
+			}
+			return !lastPage
+		})
+		if err != nil {
+			s.log.Error("Error listing incomplete multipart uploads",
+				zap.String("bucket", bucket),
+				zap.String("prefix", prefix),
+				zap.Error(err))
+			return nil, fmt.Errorf("error listing incomplete multipart uploads below %s: %v", prefix, err)
+		}
+	}
+
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	s.log.Info("Incomplete multipart uploads listed",
+		zap.String("bucket", bucket),
+		zap.Int("upload_count", len(uploads)))
+	return uploads, nil
+}
+
+// AbortUpload aborts an incomplete multipart upload, removing its uploaded parts
+func (s *S3) AbortUpload(ctx context.Context, bucket string, upload IncompleteUpload) error {
+	svc := s3.New(s.session)
+	_, err := svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(upload.Key),
+		UploadId: aws.String(upload.UploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("error aborting multipart upload %s of %s: %v", upload.UploadID, upload.Key, err)
+	}
+	return nil
+}
+
+// AbortIncompleteUploads aborts the multipart uploads below the prefixes of the
+// bucket that were started more than olderThan ago, e.g. by runs that were killed,
+// and returns the aborted ones. Uploads of running backups are younger and left
+// alone. A failed abort doesn't stop the others, the error lists every upload that was kept.
+func (s *S3) AbortIncompleteUploads(ctx context.Context, bucket string, prefixes []string, olderThan time.Duration) ([]IncompleteUpload, error) {
+	uploads, err := s.ListIncompleteUploads(ctx, bucket, prefixes, time.Now().Add(-olderThan))
+	if err != nil {
+		return nil, err
+	}
+
+	var aborted []IncompleteUpload
+	var failures []error
+	for _, upload := range uploads {
+		if err := s.AbortUpload(ctx, bucket, upload); err != nil {
+			s.log.Warn("Error aborting incomplete multipart upload",
+				zap.String("bucket", bucket),
+				zap.String("key", upload.Key),
+				zap.String("upload_id", upload.UploadID),
+				zap.Error(err))
+			failures = append(failures, err)
+			continue
+		}
+		s.log.Info("Aborted incomplete multipart upload",
+			zap.String("bucket", bucket),
+			zap.String("key", upload.Key),
+			zap.String("upload_id", upload.UploadID),
+			zap.Time("initiated", upload.Initiated))
+		aborted = append(aborted, upload)
+	}
+
+	if len(failures) > 0 {
+		return aborted, fmt.Errorf("failed to abort %d of %d incomplete multipart uploads: %w", len(failures), len(uploads), errors.Join(failures...))
+	}
+	return aborted, nil
+}
@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListIncompleteUploadsOnlyListsPrefixes(t *testing.T) {
+	initiated := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	keys := []string{"shop/shop.sql.enc", "shop-incremental/shop.binlog.tar.gz", "crm/crm.sql", "other-tool/export.csv"}
+
+	var mu sync.Mutex
+	var prefixes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		mu.Lock()
+		prefixes = append(prefixes, prefix)
+		mu.Unlock()
+
+		var body strings.Builder
+		body.WriteString("<ListMultipartUploadsResult><IsTruncated>false</IsTruncated>")
+		for i, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				fmt.Fprintf(&body, "<Upload><Key>%s</Key><UploadId>upload-%d</UploadId><Initiated>%s</Initiated></Upload>", key, i, initiated)
+			}
+		}
+		body.WriteString("</ListMultipartUploadsResult>")
+		fmt.Fprint(w, body.String())
+	}))
+	defer server.Close()
+
+	adapter, err := New(Config{
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		Endpoint:       server.URL,
+		Region:         "us-east-1",
+		ForcePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating adapter: %v", err)
+	}
+
+	uploads, err := adapter.ListIncompleteUploads(context.Background(), "bucket", []string{"shop/", "shop-incremental/"}, time.Now())
+	if err != nil {
+		t.Fatalf("ListIncompleteUploads() error = %v", err)
+	}
+	var listed []string
+	for _, upload := range uploads {
+		listed = append(listed, upload.Key)
+	}
+	sort.Strings(listed)
+	if want := []string{"shop-incremental/shop.binlog.tar.gz", "shop/shop.sql.enc"}; strings.Join(listed, ",") != strings.Join(want, ",") {
+		t.Errorf("listed %v, want %v", listed, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			t.Error("listed the multipart uploads of the whole bucket")
+		}
+	}
+
+	none, err := adapter.ListIncompleteUploads(context.Background(), "bucket", nil, time.Now())
+	if err != nil || len(none) != 0 {
+		t.Errorf("ListIncompleteUploads() without prefixes = %v, %v, want none", none, err)
+	}
+}
@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+// MaxPresignTTL is the longest validity of a presigned URL, the limit of SigV4
+const MaxPresignTTL = 7 * 24 * time.Hour
+
+// PresignGet returns a URL that downloads the object stored under key without
+// credentials until ttl has passed. The URL grants access to the object, so it
+// is only logged at debug level.
+func (s *S3) PresignGet(bucket, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > MaxPresignTTL {
+		return "", fmt.Errorf("invalid presign TTL %s: must be positive and at most %s", ttl, MaxPresignTTL)
+	}
+
+	svc := s3.New(s.session)
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	url, err := req.Presign(ttl)
+	if err != nil {
+		s.log.Error("Error presigning S3 object",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return "", fmt.Errorf("error presigning %s: %v", key, err)
+	}
+
+	s.log.Info("Presigned S3 object",
+		zap.String("bucket", bucket),
+		zap.String("key", key),
+		zap.Duration("ttl", ttl))
+	s.log.Debug("Presigned URL", zap.String("url", url))
+	return url, nil
+}
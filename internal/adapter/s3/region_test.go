@@ -0,0 +1,51 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestRequestsAreSignedForConfiguredRegion(t *testing.T) {
+	for _, region := range []string{"us-east-1", "eu-central-1", "ap-southeast-2"} {
+		t.Run(region, func(t *testing.T) {
+			var mu sync.Mutex
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				authorization = r.Header.Get("Authorization")
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			adapter, err := New(Config{
+				AccessKey:      "access",
+				SecretKey:      "secret",
+				Endpoint:       server.URL,
+				Region:         region,
+				ForcePathStyle: true,
+			})
+			if err != nil {
+				t.Fatalf("error creating adapter: %v", err)
+			}
+			if got := aws.StringValue(adapter.session.Config.Region); got != region {
+				t.Errorf("session region = %q, want %q", got, region)
+			}
+
+			if err := adapter.Delete(context.Background(), "bucket", "shop/shop.sql"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if scope := "/" + region + "/s3/aws4_request"; !strings.Contains(authorization, scope) {
+				t.Errorf("request signed with %q, want the credential scope %s", authorization, scope)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDeleteMaxRetries = 5
+	defaultDeleteRetryDelay = 500 * time.Millisecond
+	maxDeleteRetryDelay     = 30 * time.Second
+	// slowDownMultiplier makes SlowDown responses back off longer than other throttling
+	slowDownMultiplier = 4
+)
+
+// throttlingCodes are S3 error codes that indicate the request was throttled
+var throttlingCodes = map[string]bool{
+	"SlowDown":                 true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"ThrottledException":       true,
+	"RequestThrottled":         true,
+	"RequestLimitExceeded":     true,
+	"TooManyRequests":          true,
+	"TooManyRequestsException": true,
+	"ServiceUnavailable":       true,
+}
+
+// isThrottlingError reports whether err is a transient throttling error worth retrying.
+// Permanent errors such as AccessDenied or NoSuchBucket are never retried.
+func isThrottlingError(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && throttlingCodes[aerr.Code()] {
+		return true
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode() == http.StatusServiceUnavailable ||
+			reqErr.StatusCode() == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+// isSlowDownError reports whether err is an explicit S3 SlowDown response
+func isSlowDownError(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == "SlowDown"
+}
+
+// retryDelay returns the backoff before the given retry attempt (starting at 0)
+func (s *S3) retryDelay(attempt int, err error) time.Duration {
+	delay := s.config.DeleteRetryDelay << attempt
+	if isSlowDownError(err) {
+		delay *= slowDownMultiplier
+	}
+	if delay <= 0 || delay > maxDeleteRetryDelay {
+		delay = maxDeleteRetryDelay
+	}
+	return delay
+}
+
+// withDeleteRetry runs fn and retries it with exponential backoff while it fails with throttling errors
+func (s *S3) withDeleteRetry(ctx context.Context, key string, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !isThrottlingError(err) || attempt >= s.config.DeleteMaxRetries {
+			return err
+		}
+
+		delay := s.retryDelay(attempt, err)
+		s.log.Warn("S3 delete throttled, retrying",
+			zap.String("key", key),
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_retries", s.config.DeleteMaxRetries),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// fakeS3 answers every delete request with the next of its responses, the last
+// one is repeated once they're used up
+type fakeS3 struct {
+	mu        sync.Mutex
+	responses []fakeResponse
+	requests  int
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+
+	f.mu.Lock()
+	response := f.responses[min(f.requests, len(f.responses)-1)]
+	f.requests++
+	f.mu.Unlock()
+
+	w.WriteHeader(response.status)
+	fmt.Fprint(w, response.body)
+}
+
+func (f *fakeS3) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+// errorResponse is an S3 error document with the given status and code
+func errorResponse(status int, code string) fakeResponse {
+	return fakeResponse{status, fmt.Sprintf("<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)}
+}
+
+// deleteResult is a DeleteObjects response reporting the keys as failed with code
+func deleteResult(code string, keys ...string) fakeResponse {
+	var body strings.Builder
+	body.WriteString("<DeleteResult>")
+	for _, key := range keys {
+		fmt.Fprintf(&body, "<Error><Key>%s</Key><Code>%s</Code><Message>%s</Message></Error>", key, code, code)
+	}
+	body.WriteString("</DeleteResult>")
+	return fakeResponse{http.StatusOK, body.String()}
+}
+
+// newFakeAdapter returns an adapter talking to the fake, with the SDK's own
+// retries disabled so only the delete retries are exercised
+func newFakeAdapter(t *testing.T, fake *fakeS3) *S3 {
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	adapter, err := New(Config{
+		AccessKey:        "access",
+		SecretKey:        "secret",
+		Endpoint:         server.URL,
+		Region:           "us-east-1",
+		ForcePathStyle:   true,
+		DeleteMaxRetries: 3,
+		DeleteRetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error creating adapter: %v", err)
+	}
+	adapter.session.Config.MaxRetries = aws.Int(0)
+	return adapter
+}
+
+func TestDeleteRetriesThrottling(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []fakeResponse
+		wantErr   bool
+		requests  int
+	}{
+		{
+			name:      "slow down then success",
+			responses: []fakeResponse{errorResponse(http.StatusServiceUnavailable, "SlowDown"), errorResponse(http.StatusServiceUnavailable, "SlowDown"), {status: http.StatusNoContent}},
+			requests:  3,
+		},
+		{
+			name:      "throttled beyond the retries",
+			responses: []fakeResponse{errorResponse(http.StatusServiceUnavailable, "SlowDown")},
+			wantErr:   true,
+			requests:  4,
+		},
+		{
+			name:      "access denied is not retried",
+			responses: []fakeResponse{errorResponse(http.StatusForbidden, "AccessDenied"), {status: http.StatusNoContent}},
+			wantErr:   true,
+			requests:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{responses: tt.responses}
+			err := newFakeAdapter(t, fake).Delete(context.Background(), "bucket", "shop/shop.sql")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Delete() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := fake.requestCount(); got != tt.requests {
+				t.Errorf("sent %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestDeleteMultipleRetriesThrottledKeys(t *testing.T) {
+	fake := &fakeS3{responses: []fakeResponse{
+		errorResponse(http.StatusServiceUnavailable, "SlowDown"),
+		deleteResult("SlowDown", "shop/b.sql"),
+		deleteResult(""),
+	}}
+	err := newFakeAdapter(t, fake).DeleteMultiple(context.Background(), "bucket", []string{"shop/a.sql", "shop/b.sql"})
+	if err != nil {
+		t.Fatalf("DeleteMultiple() error = %v", err)
+	}
+	if got := fake.requestCount(); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+}
+
+func TestDeleteMultipleReportsPermanentFailures(t *testing.T) {
+	fake := &fakeS3{responses: []fakeResponse{deleteResult("AccessDenied", "shop/b.sql")}}
+	err := newFakeAdapter(t, fake).DeleteMultiple(context.Background(), "bucket", []string{"shop/a.sql", "shop/b.sql"})
+
+	var deleteErr *DeleteError
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("DeleteMultiple() error = %v, want a *DeleteError", err)
+	}
+	if keys := deleteErr.Keys(); len(keys) != 1 || keys[0] != "shop/b.sql" {
+		t.Errorf("failed keys %v, want [shop/b.sql]", keys)
+	}
+	if got := fake.requestCount(); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestRetryDelayBacksOffLongerOnSlowDown(t *testing.T) {
+	adapter := &S3{config: Config{DeleteRetryDelay: 100 * time.Millisecond}}
+	throttled := awserr.New("Throttling", "throttled", nil)
+	slowDown := awserr.New("SlowDown", "slow down", nil)
+
+	tests := []struct {
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{0, throttled, 100 * time.Millisecond},
+		{2, throttled, 400 * time.Millisecond},
+		{0, slowDown, 400 * time.Millisecond},
+		{2, slowDown, 1600 * time.Millisecond},
+		{20, slowDown, maxDeleteRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := adapter.retryDelay(tt.attempt, tt.err); got != tt.want {
+			t.Errorf("retryDelay(%d, %v) = %v, want %v", tt.attempt, tt.err, got, tt.want)
+		}
+	}
+}
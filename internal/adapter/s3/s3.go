@@ -3,24 +3,88 @@ package s3
 import (
 	"backup-agent/internal/pkg/logger"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Config holds the configuration for S3 adapter
 type Config struct {
+	// AccessKey and SecretKey are static credentials. Left empty, credentials are
+	// taken from the default AWS credential chain: environment variables, the
+	// shared config and credentials files, then web identity, container and
+	// instance role credentials.
 	AccessKey string `koanf:"access_key"`
 	SecretKey string `koanf:"secret_key"`
 	Endpoint  string `koanf:"endpoint"`
 	Region    string `koanf:"region"`
 	Bucket    string `koanf:"bucket"`
+	// DeleteMaxRetries is how many times a throttled delete is retried (default 5)
+	DeleteMaxRetries int `koanf:"delete_max_retries"`
+	// DeleteRetryDelay is the initial backoff for throttled deletes (default 500ms)
+	DeleteRetryDelay time.Duration `koanf:"delete_retry_delay"`
+	// ListConcurrency is how many prefixes are listed at once by ListMultiple (default 4)
+	ListConcurrency int `koanf:"list_concurrency"`
+	// ContentType overrides the Content-Type detected from the file extension
+	ContentType string `koanf:"content_type"`
+	// ContentEncoding overrides the Content-Encoding detected from the file extension
+	ContentEncoding string `koanf:"content_encoding"`
+	// ContinueOnUploadError makes UploadMultiple attempt every file instead of
+	// stopping at the first failure
+	ContinueOnUploadError bool `koanf:"continue_on_upload_error"`
+	// UploadConcurrency is how many files UploadMultiple uploads at once (default 4)
+	UploadConcurrency int `koanf:"upload_concurrency"`
+	// UploadPartSizeMB is the part size of multipart uploads in megabytes, at
+	// least 5 (default 5). Files larger than this are uploaded in parts.
+	UploadPartSizeMB int `koanf:"upload_part_size_mb"`
+	// UploadPartConcurrency is how many parts of a single file are uploaded at
+	// once (default 5), on top of UploadConcurrency
+	UploadPartConcurrency int `koanf:"upload_part_concurrency"`
+	// SanitizeKeys replaces spaces and strips unsafe characters from the folder
+	// and file names used in object keys
+	SanitizeKeys bool `koanf:"sanitize_keys"`
+	// LowercaseKeys additionally lowercases sanitized key components
+	LowercaseKeys bool `koanf:"lowercase_keys"`
+	// UseAccelerate sends requests through the S3 Transfer Acceleration
+	// endpoint; acceleration must be enabled on the bucket
+	UseAccelerate bool `koanf:"use_accelerate"`
+	// ForcePathStyle addresses buckets as endpoint/bucket instead of
+	// bucket.endpoint, as required by MinIO, Ceph and similar stores
+	ForcePathStyle bool `koanf:"force_path_style"`
+	// DisableSSL talks plain HTTP to the endpoint, for local test setups only
+	DisableSSL bool `koanf:"disable_ssl"`
+	// StorageClass of uploaded objects, e.g. STANDARD_IA or GLACIER. Empty uses the bucket default.
+	StorageClass string `koanf:"storage_class"`
+	// ServerSideEncryption asks S3 to encrypt objects at rest: "AES256" (SSE-S3) or
+	// "aws:kms" (SSE-KMS). It is independent of the encryption block: client-side
+	// encryption protects the file before it leaves the host, server-side encryption
+	// is applied by S3 on top and transparently removed on download. Both can be combined.
+	ServerSideEncryption string `koanf:"server_side_encryption"`
+	// KMSKeyID is the KMS key used with "aws:kms", empty uses the AWS managed key
+	KMSKeyID string `koanf:"kms_key_id"`
+	// AutoCreateBucket creates the bucket in Region when it doesn't exist yet,
+	// for first runs against fresh self-hosted stores
+	AutoCreateBucket bool `koanf:"auto_create_bucket"`
+	// Tags are set on every uploaded object next to the database and type tags
+	// of the backup, e.g. for lifecycle rules and cost reports
+	Tags map[string]string `koanf:"tags"`
 }
 
+const (
+	defaultListConcurrency   = 4
+	defaultUploadConcurrency = 4
+	// maxUploadPartSizeMB is the largest part S3 accepts, 5 GiB
+	maxUploadPartSizeMB = 5 * 1024
+)
+
 // S3 represents an S3 storage adapter
 type S3 struct {
 	config   Config
@@ -50,10 +114,48 @@ func New(config Config) (*S3, error) {
 	)
 	log.Debug("Initializing S3 adapter")
 
-	sess, err := session.NewSession(&aws.Config{
-		Credentials: credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
-		Region:      aws.String(config.Region),
-		Endpoint:    aws.String(config.Endpoint),
+	if config.DeleteMaxRetries <= 0 {
+		config.DeleteMaxRetries = defaultDeleteMaxRetries
+	}
+	if config.DeleteRetryDelay <= 0 {
+		config.DeleteRetryDelay = defaultDeleteRetryDelay
+	}
+	if config.ListConcurrency <= 0 {
+		config.ListConcurrency = defaultListConcurrency
+	}
+	if config.UploadConcurrency <= 0 {
+		config.UploadConcurrency = defaultUploadConcurrency
+	}
+
+	if config.StorageClass != "" && !isKnownStorageClass(config.StorageClass) {
+		log.Warn("Unknown S3 storage class, passing it through as is",
+			zap.String("storage_class", config.StorageClass),
+			zap.Strings("known_storage_classes", s3.StorageClass_Values()))
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Error("Invalid S3 configuration", zap.Error(err))
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.Region),
+		Endpoint:         aws.String(config.Endpoint),
+		S3UseAccelerate:  aws.Bool(config.UseAccelerate),
+		S3ForcePathStyle: aws.Bool(config.ForcePathStyle),
+		DisableSSL:       aws.Bool(config.DisableSSL),
+	}
+	if config.AccessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+		log.Debug("Using static S3 credentials")
+	} else {
+		log.Info("No access_key configured, using the default AWS credential chain")
+	}
+
+	// The shared config file is read for profiles assuming roles or running a credential_process
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
 		log.Error("Error creating AWS session", zap.Error(err))
@@ -61,10 +163,126 @@ func New(config Config) (*S3, error) {
 	}
 
 	log.Debug("AWS session created successfully")
-	return &S3{
+	// Failed multipart uploads are aborted by abortFailedUpload
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.LeavePartsOnError = true
+		if config.UploadPartSizeMB > 0 {
+			u.PartSize = int64(config.UploadPartSizeMB) * 1024 * 1024
+		}
+		if config.UploadPartConcurrency > 0 {
+			u.Concurrency = config.UploadPartConcurrency
+		}
+	})
+	log.Debug("Configured multipart uploads",
+		zap.Int64("part_size_bytes", uploader.PartSize),
+		zap.Int("part_concurrency", uploader.Concurrency))
+	adapter := &S3{
 		config:   config,
-		uploader: s3manager.NewUploader(sess),
+		uploader: uploader,
 		session:  sess,
 		log:      log,
-	}, nil
-}
\ No newline at end of file
+	}
+
+	if config.DisableSSL {
+		log.Warn("SSL is disabled, S3 requests are sent unencrypted")
+	}
+
+	if config.UseAccelerate {
+		log.Info("S3 Transfer Acceleration enabled", zap.String("bucket", config.Bucket))
+		if err := adapter.validateAccelerate(config.Bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	return adapter, nil
+}
+
+// Validate checks the settings New rejects, so configuration errors surface when
+// the configuration is loaded rather than when the bucket is first used
+func (c Config) Validate() error {
+	if err := validateEndpoint(c.Endpoint); err != nil {
+		return err
+	}
+	if err := validateServerSideEncryption(c); err != nil {
+		return err
+	}
+	if err := validateUploadParts(c); err != nil {
+		return err
+	}
+	if err := validateTags(c.Tags); err != nil {
+		return err
+	}
+	if c.UseAccelerate && c.ForcePathStyle {
+		return fmt.Errorf("use_accelerate can't be combined with force_path_style, acceleration requires virtual-hosted addressing")
+	}
+	if (c.AccessKey == "") != (c.SecretKey == "") {
+		return fmt.Errorf("access_key and secret_key must be set together, leave both empty to use the default AWS credential chain")
+	}
+	return nil
+}
+
+// validateEndpoint checks that a custom endpoint is an HTTP(S) URL with a host,
+// the scheme may be left out as the SDK defaults to HTTPS
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	raw := endpoint
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid endpoint %q: must be an http or https URL such as https://s3.example.com", endpoint)
+	}
+	return nil
+}
+
+// isKnownStorageClass reports whether class is one of the storage classes known to the SDK
+func isKnownStorageClass(class string) bool {
+	for _, known := range s3.StorageClass_Values() {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validateServerSideEncryption checks the server-side encryption mode and its KMS key
+func validateServerSideEncryption(config Config) error {
+	switch config.ServerSideEncryption {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms, s3.ServerSideEncryptionAwsKmsDsse:
+	default:
+		return fmt.Errorf("invalid server_side_encryption %q: must be one of %v",
+			config.ServerSideEncryption, s3.ServerSideEncryption_Values())
+	}
+	if config.KMSKeyID != "" && config.ServerSideEncryption != s3.ServerSideEncryptionAwsKms &&
+		config.ServerSideEncryption != s3.ServerSideEncryptionAwsKmsDsse {
+		return fmt.Errorf("kms_key_id requires server_side_encryption %q", s3.ServerSideEncryptionAwsKms)
+	}
+	return nil
+}
+
+// validateUploadParts checks the multipart upload part size and concurrency
+func validateUploadParts(config Config) error {
+	minPartSizeMB := int(s3manager.MinUploadPartSize / 1024 / 1024)
+	if config.UploadPartSizeMB != 0 && config.UploadPartSizeMB < minPartSizeMB {
+		return fmt.Errorf("invalid upload_part_size_mb %d: must be at least %d, the S3 minimum part size",
+			config.UploadPartSizeMB, minPartSizeMB)
+	}
+	if config.UploadPartSizeMB > maxUploadPartSizeMB {
+		return fmt.Errorf("invalid upload_part_size_mb %d: must be at most %d, the S3 maximum part size",
+			config.UploadPartSizeMB, maxUploadPartSizeMB)
+	}
+	if config.UploadPartConcurrency < 0 {
+		return fmt.Errorf("invalid upload_part_concurrency %d: must not be negative", config.UploadPartConcurrency)
+	}
+	return nil
+}
+
+// WithMinLogLevel returns a copy of the adapter that only logs entries at or above level
+func (s *S3) WithMinLogLevel(level zapcore.Level) *S3 {
+	clone := *s
+	clone.log = s.log.WithOptions(zap.IncreaseLevel(level))
+	return &clone
+}
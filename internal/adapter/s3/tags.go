@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxObjectTags is the number of tags S3 accepts per object
+	maxObjectTags = 10
+	// maxConfigTags leaves room for the database and type tags of every backup
+	maxConfigTags     = maxObjectTags - 2
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// validateTags checks the configured tags against the S3 limits
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxConfigTags {
+		return fmt.Errorf("invalid tags: at most %d tags are allowed, S3 accepts %d per object including the database and type tags",
+			maxConfigTags, maxObjectTags)
+	}
+	for key, value := range tags {
+		if key == "" || utf8.RuneCountInString(key) > maxTagKeyLength {
+			return fmt.Errorf("invalid tag key %q: must be 1 to %d characters", key, maxTagKeyLength)
+		}
+		if utf8.RuneCountInString(value) > maxTagValueLength {
+			return fmt.Errorf("invalid value of tag %s: must be at most %d characters", key, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// objectTagging returns the URL-encoded tag set of an upload: the configured tags
+// overridden by the tags of the request
+func (s *S3) objectTagging(req UploadRequest) string {
+	values := url.Values{}
+	for key, value := range s.config.Tags {
+		values.Set(key, value)
+	}
+	for key, value := range req.Tags {
+		values.Set(key, value)
+	}
+	// Spaces are percent-encoded, a literal "+" is already escaped as %2B
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+// ObjectTags returns the tags of an object
+func (s *S3) ObjectTags(ctx context.Context, bucket, key string) (map[string]string, error) {
+	svc := s3.New(s.session)
+
+	output, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		s.log.Error("Error reading object tags",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return nil, fmt.Errorf("error reading tags of %s: %v", key, err)
+	}
+
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
@@ -1,11 +1,19 @@
 package s3
 
 import (
+	"backup-agent/internal/pkg/metrics"
+	"backup-agent/internal/pkg/tracing"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -14,23 +22,48 @@ type UploadRequest struct {
 	FolderName string    // Name of the folder in S3
 	FileName   string    // File name
 	Content    io.Reader // Content to upload
+	Checksum   string    // Optional hex SHA-256 of the content, stored as x-amz-meta-sha256
+	BackupTime time.Time // Optional time the backup was taken, stored as x-amz-meta-backup-time
+	// Tags are set on the object in addition to the configured tags, which they override
+	Tags map[string]string
+}
+
+// UploadStats describes a completed upload
+type UploadStats struct {
+	FolderName string
+	FileName   string
+	Key        string
+	// Bytes is the size of the uploaded content
+	Bytes int64
+	// Duration is the time the upload took, including retried parts
+	Duration time.Duration
+}
+
+// BytesPerSecond returns the average upload throughput
+func (u UploadStats) BytesPerSecond() float64 {
+	if u.Duration <= 0 {
+		return 0
+	}
+	return float64(u.Bytes) / u.Duration.Seconds()
 }
 
 // Upload uploads content to S3 and returns its URL
-func (s *S3) Upload(bucket string, req UploadRequest) (string, error) {
-	key := fmt.Sprintf("%s/%s", req.FolderName, req.FileName)
+func (s *S3) Upload(ctx context.Context, bucket string, req UploadRequest) (string, error) {
+	key := s.ObjectKey(req.FolderName, req.FileName)
+	ctx, span := tracing.Start(ctx, "s3.upload",
+		attribute.String("s3.bucket", bucket),
+		attribute.String("s3.key", key))
 	s.log.Info("Starting S3 upload process",
 		zap.String("bucket", bucket),
 		zap.String("folder", req.FolderName),
 		zap.String("file", req.FileName),
 		zap.String("key", key))
 
-	output, err := s.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   req.Content,
-	})
+	uploaded := measureContent(&req)
+	output, err := s.uploader.UploadWithContext(ctx, s.uploadInput(bucket, key, req))
+	tracing.End(span, err)
 	if err != nil {
+		s.abortFailedUpload(ctx, bucket, key, err)
 		s.log.Error("Error during S3 upload",
 			zap.String("bucket", bucket),
 			zap.String("key", key),
@@ -41,62 +74,225 @@ func (s *S3) Upload(bucket string, req UploadRequest) (string, error) {
 	s.log.Info("Content uploaded successfully",
 		zap.String("key", key),
 		zap.String("url", output.Location))
-	
+	metrics.AddUploadedBytes(uploaded())
+
 	return output.Location, nil
 }
 
-// Upload uploads multiple files to S3
-func (s *S3) UploadMultiple(bucket string, requests []UploadRequest) error {
+// UploadMultiple uploads multiple files to S3, up to UploadConcurrency at a time,
+// and returns the statistics of the successful uploads in request order.
+// Every request's content is read by exactly one upload. By default no new uploads
+// are started after the first failure; with ContinueOnUploadError every file is
+// attempted. Either way the error lists all failed files.
+func (s *S3) UploadMultiple(ctx context.Context, bucket string, requests []UploadRequest) ([]UploadStats, error) {
 	s.log.Info("Starting S3 upload process",
 		zap.String("bucket", bucket),
-		zap.Int("file_count", len(requests)))
+		zap.Int("file_count", len(requests)),
+		zap.Int("concurrency", s.config.UploadConcurrency),
+		zap.Bool("continue_on_error", s.config.ContinueOnUploadError))
 
-	for _, req := range requests {
-		key := fmt.Sprintf("%s/%s", req.FolderName, req.FileName)
-		s.log.Debug("Processing upload request",
-			zap.String("folder", req.FolderName),
-			zap.String("file", req.FileName),
-			zap.String("key", key))
+	// Failures are kept in request order so the combined error is stable
+	failures := make([]error, len(requests))
+	uploads := make([]*UploadStats, len(requests))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.config.UploadConcurrency)
 
-		if err := s.uploadFile(bucket, req.Content, key); err != nil {
-			s.log.Error("Error uploading file",
+	for i, req := range requests {
+		sem <- struct{}{}
+		if failed.Load() && !s.config.ContinueOnUploadError {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, req UploadRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			key := s.ObjectKey(req.FolderName, req.FileName)
+			s.log.Debug("Processing upload request",
+				zap.String("folder", req.FolderName),
+				zap.String("file", req.FileName),
+				zap.String("key", key))
+
+			stats, err := s.uploadFile(ctx, bucket, key, req)
+			if err != nil {
+				s.log.Error("Error uploading file",
+					zap.String("file", req.FileName),
+					zap.String("key", key),
+					zap.Error(err))
+				failures[i] = fmt.Errorf("error uploading %s: %v", req.FileName, err)
+				failed.Store(true)
+				return
+			}
+			uploads[i] = &stats
+			s.log.Info("File uploaded successfully",
 				zap.String("file", req.FileName),
 				zap.String("key", key),
-				zap.Error(err))
-			return fmt.Errorf("error uploading %s: %v", req.FileName, err)
+				zap.Int64("bytes", stats.Bytes),
+				zap.Duration("duration", stats.Duration),
+				zap.Float64("bytes_per_second", stats.BytesPerSecond()))
+		}(i, req)
+	}
+	wg.Wait()
+
+	var stats []UploadStats
+	var totalBytes int64
+	for _, upload := range uploads {
+		if upload != nil {
+			stats = append(stats, *upload)
+			totalBytes += upload.Bytes
 		}
-		s.log.Info("File uploaded successfully",
-			zap.String("file", req.FileName),
-			zap.String("key", key))
+	}
+
+	if err := errors.Join(failures...); err != nil {
+		failedCount := 0
+		for _, failure := range failures {
+			if failure != nil {
+				failedCount++
+			}
+		}
+		s.log.Error("Some files failed to upload",
+			zap.String("bucket", bucket),
+			zap.Int("failed_count", failedCount),
+			zap.Int("file_count", len(requests)))
+		return stats, fmt.Errorf("%d of %d uploads failed: %w", failedCount, len(requests), err)
 	}
 
 	s.log.Info("All files uploaded successfully",
 		zap.String("bucket", bucket),
-		zap.Int("file_count", len(requests)))
+		zap.Int("file_count", len(requests)),
+		zap.Int64("bytes", totalBytes))
+	return stats, nil
+}
+
+// UploadObject uploads content under an existing object key, replacing the object.
+// FolderName and FileName of the request are ignored. A failed upload leaves the
+// previous object in place.
+func (s *S3) UploadObject(ctx context.Context, bucket, key string, req UploadRequest) error {
+	if _, err := s.uploadFile(ctx, bucket, key, req); err != nil {
+		return fmt.Errorf("error uploading %s: %v", key, err)
+	}
 	return nil
 }
 
-// uploadFile uploads a single file to S3
-func (s *S3) uploadFile(bucket string, content io.Reader, key string) error {
+// uploadFile uploads a single file to S3 and returns how much was uploaded and how long it took
+func (s *S3) uploadFile(ctx context.Context, bucket, key string, req UploadRequest) (stats UploadStats, err error) {
 	s.log.Debug("Starting S3 upload",
 		zap.String("bucket", bucket),
 		zap.String("key", key))
 
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   content,
-	})
+	ctx, span := tracing.Start(ctx, "s3.upload",
+		attribute.String("s3.bucket", bucket),
+		attribute.String("s3.key", key))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	uploaded := measureContent(&req)
+	_, err = s.uploader.UploadWithContext(ctx, s.uploadInput(bucket, key, req))
 	if err != nil {
+		s.abortFailedUpload(ctx, bucket, key, err)
 		s.log.Error("Error during S3 upload",
 			zap.String("bucket", bucket),
 			zap.String("key", key),
 			zap.Error(err))
-		return err
+		return UploadStats{}, err
+	}
+	stats = UploadStats{
+		FolderName: req.FolderName,
+		FileName:   req.FileName,
+		Key:        key,
+		Bytes:      uploaded(),
+		Duration:   time.Since(start),
 	}
+	metrics.AddUploadedBytes(stats.Bytes)
+	span.SetAttributes(attribute.Int64("s3.uploaded_bytes", stats.Bytes))
 
 	s.log.Debug("S3 upload completed",
 		zap.String("bucket", bucket),
 		zap.String("key", key))
-	return nil
-}
\ No newline at end of file
+	return stats, nil
+}
+
+// measureContent returns a function reporting the size of the request's content
+// once it has been uploaded. Seekable content is measured up front, other readers
+// are wrapped to count the bytes read.
+func measureContent(req *UploadRequest) func() int64 {
+	if body, ok := req.Content.(io.Seeker); ok {
+		if size, err := remainingSize(body); err == nil {
+			return func() int64 { return size }
+		}
+	}
+
+	counter := &countingReader{r: req.Content}
+	req.Content = counter
+	return func() int64 { return counter.n }
+}
+
+// remainingSize returns the number of bytes between the current position and the end
+func remainingSize(body io.Seeker) (int64, error) {
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := body.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - start, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// uploadInput builds the upload input for an object, including its content headers
+func (s *S3) uploadInput(bucket, key string, req UploadRequest) *s3manager.UploadInput {
+	contentType, contentEncoding := s.contentHeaders(key)
+	s.log.Debug("Resolved content headers",
+		zap.String("key", key),
+		zap.String("content_type", contentType),
+		zap.String("content_encoding", contentEncoding))
+
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        req.Content,
+		ContentType: aws.String(contentType),
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	input.Metadata = make(map[string]*string)
+	if req.Checksum != "" {
+		input.Metadata[checksumMetadataKey] = aws.String(req.Checksum)
+	}
+	if !req.BackupTime.IsZero() {
+		input.Metadata[backupTimeMetadataKey] = aws.String(req.BackupTime.UTC().Format(time.RFC3339))
+	}
+	if tagging := s.objectTagging(req); tagging != "" {
+		input.Tagging = aws.String(tagging)
+	}
+	if s.config.StorageClass != "" {
+		input.StorageClass = aws.String(s.config.StorageClass)
+	}
+	if s.config.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(s.config.ServerSideEncryption)
+	}
+	if s.config.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.config.KMSKeyID)
+	}
+	return input
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+const (
+	// checksumMetadataKey is the user metadata entry holding the SHA-256 of an object (x-amz-meta-sha256)
+	checksumMetadataKey = "sha256"
+	// backupTimeMetadataKey is the user metadata entry holding the RFC3339 time the backup was taken
+	backupTimeMetadataKey = "backup-time"
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size int64
+	ETag string
+	// Checksum is the hex SHA-256 recorded in the object metadata at upload, empty if none was recorded
+	Checksum string
+	// BackupTime is the time the backup was taken as recorded at upload, zero if none was recorded
+	BackupTime time.Time
+}
+
+// HeadObject returns the size, ETag and recorded metadata of an object without downloading it
+func (s *S3) HeadObject(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	svc := s3.New(s.session)
+
+	output, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		s.log.Error("Error reading object metadata",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return ObjectInfo{}, fmt.Errorf("error reading metadata of %s: %v", key, err)
+	}
+
+	info := ObjectInfo{
+		Size: aws.Int64Value(output.ContentLength),
+		ETag: strings.Trim(aws.StringValue(output.ETag), `"`),
+	}
+	// Metadata keys come back in canonical header form, e.g. "Sha256"
+	for name, value := range output.Metadata {
+		switch {
+		case strings.EqualFold(name, checksumMetadataKey):
+			info.Checksum = aws.StringValue(value)
+		case strings.EqualFold(name, backupTimeMetadataKey):
+			if t, err := time.Parse(time.RFC3339, aws.StringValue(value)); err == nil {
+				info.BackupTime = t
+			}
+		}
+	}
+	return info, nil
+}
+
+// VerifyObject checks that the stored object has the expected size and SHA-256.
+// The object is downloaded and hashed, so the check covers its actual content;
+// a checksum recorded in its metadata must match as well.
+func (s *S3) VerifyObject(ctx context.Context, bucket, key, checksum string, size int64) error {
+	s.log.Info("Verifying uploaded object",
+		zap.String("bucket", bucket),
+		zap.String("key", key))
+
+	info, err := s.HeadObject(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	if info.Size != size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", key, size, info.Size)
+	}
+	if info.Checksum != "" && info.Checksum != checksum {
+		return fmt.Errorf("checksum metadata mismatch for %s: expected %s, got %s", key, checksum, info.Checksum)
+	}
+
+	hash := sha256.New()
+	if err := s.Download(ctx, bucket, key, hash); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		s.log.Error("Checksum mismatch for uploaded object",
+			zap.String("key", key),
+			zap.String("expected", checksum),
+			zap.String("actual", actual))
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", key, checksum, actual)
+	}
+
+	s.log.Info("Uploaded object verified",
+		zap.String("key", key),
+		zap.String("sha256", checksum))
+	return nil
+}
@@ -0,0 +1,206 @@
+package backup
+
+import (
+	"archive/tar"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/stream"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ArchiveEntry represents a local file to be added to an archive
+type ArchiveEntry struct {
+	Name string // Name of the entry inside the archive
+	Path string // Local file path
+}
+
+// CreateArchive bundles the given files into a gzip-compressed tar archive at dest
+func CreateArchive(dest string, entries []ArchiveEntry) error {
+	log := logger.L().With(zap.String("archive", dest))
+
+	out, err := os.Create(dest)
+	if err != nil {
+		log.Error("Error creating archive file", zap.Error(err))
+		return fmt.Errorf("error creating archive file: %v", err)
+	}
+	defer out.Close()
+
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+
+	for _, entry := range entries {
+		if err := addToArchive(tw, entry); err != nil {
+			log.Error("Error adding file to archive",
+				zap.String("file", entry.Path),
+				zap.Error(err))
+			return fmt.Errorf("error adding %s to archive: %v", entry.Path, err)
+		}
+		log.Debug("Added file to archive",
+			zap.String("file", entry.Path),
+			zap.String("entry", entry.Name))
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error closing tar writer: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return fmt.Errorf("error closing gzip writer: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error closing archive file: %v", err)
+	}
+
+	log.Info("Archive created successfully", zap.Int("file_count", len(entries)))
+	return nil
+}
+
+// ArchiveDirectory bundles the files below dir into a gzip-compressed tar archive
+// at dest, named by their path relative to dir
+func ArchiveDirectory(dest, dir string) error {
+	var entries []ArchiveEntry
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ArchiveEntry{Name: name, Path: path})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %v", dir, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("directory %s contains no files to archive", dir)
+	}
+	return CreateArchive(dest, entries)
+}
+
+// IsArchivedDump reports whether the backup file is an archived dump, which
+// must be extracted before it can be restored
+func IsArchivedDump(path string) bool {
+	return strings.HasSuffix(path, archiveSuffix)
+}
+
+// ExtractDump extracts an archived dump into dir and returns the path of the
+// dump: the file of single-file dumps, dir for directory trees
+func ExtractDump(path, dir string) (string, error) {
+	files, err := ExtractArchive(path, dir)
+	if err != nil {
+		return "", fmt.Errorf("error extracting dump: %v", err)
+	}
+	if len(files) == 1 && filepath.Dir(files[0]) == filepath.Clean(dir) {
+		return files[0], nil
+	}
+	return dir, nil
+}
+
+func addToArchive(tw *tar.Writer, entry ArchiveEntry) error {
+	file, err := os.Open(entry.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(entry.Name)
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = stream.Copy(tw, file)
+	return err
+}
+
+// ExtractArchive extracts a gzip-compressed tar archive into destDir and returns the extracted file paths
+func ExtractArchive(src, destDir string) ([]string, error) {
+	log := logger.L().With(
+		zap.String("archive", src),
+		zap.String("destination", destDir),
+	)
+
+	in, err := os.Open(src)
+	if err != nil {
+		log.Error("Error opening archive", zap.Error(err))
+		return nil, fmt.Errorf("error opening archive: %v", err)
+	}
+	defer in.Close()
+
+	gzr, err := gzip.NewReader(in)
+	if err != nil {
+		log.Error("Error reading gzip stream", zap.Error(err))
+		return nil, fmt.Errorf("error reading gzip stream: %v", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	var extracted []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+
+		// Reject entries that would escape the destination directory
+		target := filepath.Join(destDir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(destDir)+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("invalid archive entry: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("error creating directory %s: %v", target, err)
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, os.FileMode(header.Mode)); err != nil {
+				return nil, fmt.Errorf("error extracting %s: %v", header.Name, err)
+			}
+			extracted = append(extracted, target)
+			log.Debug("Extracted file from archive", zap.String("file", target))
+		}
+	}
+
+	log.Info("Archive extracted successfully", zap.Int("file_count", len(extracted)))
+	return extracted, nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := stream.Copy(file, r); err != nil {
+		return err
+	}
+	return file.Close()
+}
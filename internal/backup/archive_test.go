@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestInfluxDumpIsArchived(t *testing.T) {
+	// Writes the files of a portable backup into the directory given last
+	influxd := filepath.Join(t.TempDir(), "influxd")
+	script := "#!/bin/sh\nfor dir; do :; done\nmkdir -p \"$dir/shards\"\n" +
+		"echo manifest > \"$dir/20240601T000000Z.manifest\"\necho meta > \"$dir/20240601T000000Z.meta\"\n" +
+		"echo shard > \"$dir/shards/20240601T000000Z.s1.tar.gz\"\n"
+	if err := os.WriteFile(influxd, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	db := Config{Name: "metrics", Type: InfluxDB, InfluxVersion: 1, Host: "localhost", Port: 8088}
+	backupFilePath := filepath.Join(dir, "metrics_2024-06-01-00-00-00.influx1.tar.gz")
+	if err := runDump(context.Background(), db, backupFilePath, Binaries{Influxd: influxd}, 0); err != nil {
+		t.Fatalf("runDump() error = %v", err)
+	}
+
+	// Only the archive is left to be uploaded, the dump directory is removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(backupFilePath) || !entries[0].Type().IsRegular() {
+		t.Fatalf("backup directory holds %v, want only the archive", entries)
+	}
+
+	extractDir := t.TempDir()
+	files, err := ExtractArchive(backupFilePath, extractDir)
+	if err != nil {
+		t.Fatalf("ExtractArchive() error = %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		name, _ := filepath.Rel(extractDir, file)
+		names = append(names, filepath.ToSlash(name))
+	}
+	sort.Strings(names)
+	want := []string{"20240601T000000Z.manifest", "20240601T000000Z.meta", "shards/20240601T000000Z.s1.tar.gz"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("archive holds %v, want %v", names, want)
+	}
+	restoreDir := t.TempDir()
+	if path, err := ExtractDump(backupFilePath, restoreDir); err != nil || path != restoreDir {
+		t.Errorf("ExtractDump() = %q, %v, want the directory %s", path, err, restoreDir)
+	}
+}
+
+func TestArchiveDirectoryRejectsEmptyDirectory(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "empty.tar.gz")
+	if err := ArchiveDirectory(dest, t.TempDir()); err == nil {
+		t.Error("ArchiveDirectory() archived an empty directory")
+	}
+}
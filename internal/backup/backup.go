@@ -3,100 +3,502 @@ package backup
 import (
 	"backup-agent/internal/pkg/encryption"
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/paths"
+	"backup-agent/internal/pkg/tracing"
+	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Result represents a request for uploading a file to S3
 type Result struct {
+	Database   string // Name of the database, the folder name for bundles
 	FolderName string // Name of the folder in S3
+	Type       string // Database type, or "bundle" for bundles
 	FilePath   string // Local file path
 	FileName   string // File name
+	Size       int64  // Size of the local file in bytes
+	// CreatedAt is the time the backup was taken, as used in its file name
+	CreatedAt time.Time
+	// Duration is the time taken to dump and encrypt the database
+	Duration time.Duration
+	// Binlog is the binary log the next incremental backup of the database
+	// starts at, set for MySQL databases with incremental enabled
+	Binlog string
 }
 
-// Backup performs the backup operation for all configured databases
-func Backup(dbConfigs []Config, encryptor *encryption.Encryptor) ([]Result, error) {
-	log := logger.L()
+// DatabaseError is returned when the backup of a single database fails
+type DatabaseError struct {
+	Database string
+	// Duration is the time spent on the database until it failed
+	Duration time.Duration
+	Err      error
+}
+
+func (e *DatabaseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+// FailedDatabasesError is returned by runs with ContinueOnError when the backups
+// of some databases failed, the results of the others are returned with it
+type FailedDatabasesError struct {
+	Errors []*DatabaseError
+}
+
+func (e *FailedDatabasesError) Error() string {
+	return fmt.Sprintf("backup of %d database(s) failed: %s", len(e.Errors), strings.Join(e.Databases(), ", "))
+}
+
+func (e *FailedDatabasesError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Databases returns the names of the databases whose backup failed
+func (e *FailedDatabasesError) Databases() []string {
+	names := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		names[i] = err.Database
+	}
+	return names
+}
+
+// collect records the failed backup of a database, the error must be a *DatabaseError
+func (e *FailedDatabasesError) collect(err error) {
+	var dbErr *DatabaseError
+	if errors.As(err, &dbErr) {
+		e.Errors = append(e.Errors, dbErr)
+	}
+}
+
+// errorOrNil returns e when a backup failed
+func (e *FailedDatabasesError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Options controls how a backup run handles its local files
+type Options struct {
+	// KeepLocalPlaintext retains the unencrypted local file after encryption
+	KeepLocalPlaintext bool
+	// Clock returns the time used for backup file names, defaults to time.Now
+	Clock func() time.Time
+	// WorkDir holds intermediate files such as bundle archives, defaults to
+	// the directory of the first database
+	WorkDir string
+	// Binaries overrides the paths of the database client binaries
+	Binaries Binaries
+	// Naming controls the backup file names
+	Naming Naming
+	// DumpTimeout kills dump commands running longer, zero disables it. The
+	// timeout of a database overrides it.
+	DumpTimeout time.Duration
+	// DumpRetries is how often a failed dump command is retried
+	DumpRetries int
+	// DumpRetryDelay is the pause between dump attempts
+	DumpRetryDelay time.Duration
+	// ContinueOnError backs up the remaining databases after a failure and
+	// returns a *FailedDatabasesError with the results of the others
+	ContinueOnError bool
+	// Incremental copies the binary logs written since the previous backup
+	// instead of dumping the databases, which must all support it
+	Incremental bool
+	// BinlogStarts holds the binary log each database's incremental backup starts at
+	BinlogStarts map[string]string
+}
+
+// now returns the current time from the configured clock
+func (o Options) now() time.Time {
+	if o.Clock == nil {
+		return time.Now()
+	}
+	return o.Clock()
+}
+
+// Backup performs the backup operation for all configured databases. A cancelled
+// run returns the backups produced before it was cancelled along with the error.
+func Backup(ctx context.Context, dbConfigs []Config, encryptor encryption.Provider, opts Options) ([]Result, error) {
 	uploadRequests := make([]Result, 0)
+	failed := &FailedDatabasesError{}
 
 	// Execute database backups
 	for _, db := range dbConfigs {
-		log.Info("Starting backup for database",
-			zap.String("database", db.Name),
-			zap.String("type", db.Type),
-			zap.String("container", db.Container))
+		// A cancelled run stops, even with ContinueOnError
+		if err := ctx.Err(); err != nil {
+			return uploadRequests, fmt.Errorf("backup cancelled: %w", err)
+		}
+		if !db.IsEnabled() {
+			logSkippedDisabled(db)
+			continue
+		}
+		result, err := backupDatabase(ctx, db, encryptor, opts)
+		if err != nil {
+			// A dump interrupted by the cancellation isn't a failed database
+			if cerr := ctx.Err(); cerr != nil {
+				return uploadRequests, fmt.Errorf("backup cancelled: %w", cerr)
+			}
+			if !opts.ContinueOnError {
+				return nil, err
+			}
+			logger.L().Warn("Continuing with the remaining databases", zap.String("failed_database", db.Name))
+			failed.collect(err)
+			continue
+		}
+		uploadRequests = append(uploadRequests, result)
+	}
+
+	return uploadRequests, failed.errorOrNil()
+}
 
-		backupFileName, err := backup(db)
+// Pipeline performs the backup operation like Backup, but hands every result to
+// upload as soon as it is ready so uploading one database overlaps with dumping
+// and encrypting the next. At most depth results wait between the two stages.
+// The first failure of either stage stops the run, failed backups don't with
+// opts.ContinueOnError.
+func Pipeline(ctx context.Context, dbConfigs []Config, encryptor encryption.Provider, opts Options, depth int, upload func(context.Context, Result) error) ([]Result, error) {
+	log := logger.L().With(zap.Int("pipeline_depth", depth))
+
+	pending := make(chan Result, depth)
+	uploadFailed := make(chan struct{})
+	uploadErr := make(chan error, 1)
+
+	// Upload stage
+	go func() {
+		var err error
+		for result := range pending {
+			if err != nil {
+				// Drain the remaining results after a failure
+				continue
+			}
+			if uerr := upload(ctx, result); uerr != nil {
+				log.Error("Error uploading backup",
+					zap.String("database", result.FolderName),
+					zap.String("file", result.FilePath),
+					zap.Error(uerr))
+				err = fmt.Errorf("error uploading backup of %s: %v", result.FolderName, uerr)
+				close(uploadFailed)
+			}
+		}
+		uploadErr <- err
+	}()
+
+	// Dump and encrypt stage
+	results := make([]Result, 0, len(dbConfigs))
+	var backupErr error
+	failed := &FailedDatabasesError{}
+loop:
+	for _, db := range dbConfigs {
+		// Stop dumping as soon as an upload has failed or the run is cancelled
+		select {
+		case <-uploadFailed:
+			break loop
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			backupErr = fmt.Errorf("backup cancelled: %w", err)
+			break
+		}
+
+		if !db.IsEnabled() {
+			logSkippedDisabled(db)
+			continue
+		}
+		result, err := backupDatabase(ctx, db, encryptor, opts)
 		if err != nil {
-			log.Error("Error backing up database",
-				zap.String("database", db.Name),
-				zap.Error(err))
-			return nil, fmt.Errorf("error backing up %s: %v", db.Name, err)
+			if opts.ContinueOnError && ctx.Err() == nil {
+				log.Warn("Continuing with the remaining databases", zap.String("failed_database", db.Name))
+				failed.collect(err)
+				continue
+			}
+			backupErr = err
+			break
+		}
+		results = append(results, result)
+		pending <- result
+	}
+	close(pending)
+	if backupErr == nil {
+		backupErr = failed.errorOrNil()
+	}
+
+	if err := <-uploadErr; err != nil {
+		return results, err
+	}
+	if backupErr != nil {
+		return results, backupErr
+	}
+	return results, nil
+}
+
+// logSkippedDisabled logs that the database is skipped because it is disabled
+func logSkippedDisabled(db Config) {
+	logger.L().Info("Skipping disabled database",
+		zap.String("database", db.Name),
+		zap.String("type", db.Type))
+}
+
+// backupDatabase dumps a single database and encrypts the dump if encryption is enabled.
+// The work is traced as a backup.database span with dump and encrypt child spans.
+func backupDatabase(ctx context.Context, db Config, encryptor encryption.Provider, opts Options) (result Result, err error) {
+	log := logger.L()
+
+	start := time.Now()
+
+	ctx, span := tracing.Start(ctx, "backup.database",
+		attribute.String("db.name", db.Name),
+		attribute.String("db.type", db.Type))
+	defer func() { tracing.End(span, err) }()
+
+	defer func() {
+		if err != nil {
+			err = &DatabaseError{Database: db.Name, Duration: time.Since(start), Err: err}
 		}
-		log.Info("Backup completed for database",
+	}()
+
+	log.Info("Starting backup for database",
+		zap.String("database", db.Name),
+		zap.String("type", db.Type),
+		zap.String("container", db.Container))
+
+	// Incremental backups copy the binary logs into their own folder
+	folderName := db.Name
+	if opts.Incremental {
+		folderName = IncrementalFolderName(db.Name)
+	}
+
+	dumpCtx, dumpSpan := tracing.Start(ctx, "backup.dump")
+	createdAt := opts.now()
+	var backupFileName, binlog string
+	if opts.Incremental {
+		backupFileName, binlog, err = backupBinlogs(dumpCtx, db, opts, createdAt, opts.BinlogStarts[db.Name])
+	} else {
+		backupFileName, err = backup(dumpCtx, db, opts, createdAt)
+	}
+	tracing.End(dumpSpan, err)
+	if err != nil {
+		log.Error("Error backing up database",
+			zap.String("database", db.Name),
+			zap.Error(err))
+		return Result{}, fmt.Errorf("error backing up %s: %w", db.Name, err)
+	}
+	log.Info("Backup completed for database",
+		zap.String("database", db.Name),
+		zap.String("backup_file", backupFileName))
+
+	// Resolve the directory path, including handling "~" as the home directory
+	absoluteDir, err := paths.Resolve(db.Directory)
+	if err != nil {
+		log.Error("Error resolving directory path",
 			zap.String("database", db.Name),
-			zap.String("backup_file", backupFileName))
+			zap.String("directory", db.Directory),
+			zap.Error(err))
+		return Result{}, fmt.Errorf("error resolving directory path: %v", err)
+	}
+	log.Debug("Resolved directory path",
+		zap.String("database", db.Name),
+		zap.String("original_path", db.Directory),
+		zap.String("absolute_path", absoluteDir))
+
+	backupFilePath := filepath.Join(absoluteDir, folderName, backupFileName)
 
-		// Resolve the directory path, including handling "~" as the home directory
-		absoluteDir, err := resolvePath(db.Directory)
+	// Full backups start the chain of incremental backups at the binary log in their header
+	if SupportsIncremental(db) && !opts.Incremental {
+		binlog, err = DumpBinlogFile(backupFilePath)
 		if err != nil {
-			log.Error("Error resolving directory path",
+			log.Error("Error reading binary log position of dump",
 				zap.String("database", db.Name),
-				zap.String("directory", db.Directory),
 				zap.Error(err))
-			return nil, fmt.Errorf("error resolving directory path: %v", err)
+			return Result{}, fmt.Errorf("error reading binary log position of %s: %v", db.Name, err)
 		}
-		log.Debug("Resolved directory path",
+		log.Info("Recorded binary log position for incremental backups",
 			zap.String("database", db.Name),
-			zap.String("original_path", db.Directory),
-			zap.String("absolute_path", absoluteDir))
+			zap.String("binlog", binlog))
+	}
+	uploadFilePath := backupFilePath
+	uploadFileName := backupFileName
 
-		backupFilePath := filepath.Join(absoluteDir, db.Name, backupFileName)
-		uploadFilePath := backupFilePath
-		uploadFileName := backupFileName
+	// A run cancelled during the dump doesn't encrypt or keep it, the plaintext
+	// dump isn't left behind
+	if err := ctx.Err(); err != nil {
+		if rerr := os.Remove(backupFilePath); rerr != nil && !os.IsNotExist(rerr) {
+			log.Warn("Error removing backup file of cancelled run",
+				zap.String("database", db.Name),
+				zap.String("file", backupFilePath),
+				zap.Error(rerr))
+		}
+		return Result{}, fmt.Errorf("backup cancelled: %w", err)
+	}
 
-		// Encrypt the backup file if encryption is enabled
-		encryptedPath, err := encryptor.EncryptFile(backupFilePath)
-		if err != nil {
-			log.Error("Error encrypting backup file",
+	// Encrypt the backup file if encryption is enabled
+	_, encryptSpan := tracing.Start(ctx, "backup.encrypt")
+	encryptedPath, err := encryptor.EncryptFile(backupFilePath)
+	tracing.End(encryptSpan, err)
+	if err != nil {
+		log.Error("Error encrypting backup file",
+			zap.String("database", db.Name),
+			zap.String("file", backupFilePath),
+			zap.Error(err))
+		return Result{}, fmt.Errorf("error encrypting backup file of %s: %v", db.Name, err)
+	}
+
+	if encryptedPath != backupFilePath {
+		log.Info("Backup file encrypted",
+			zap.String("database", db.Name),
+			zap.String("original_path", backupFilePath),
+			zap.String("encrypted_path", encryptedPath))
+		uploadFilePath = encryptedPath
+		uploadFileName = backupFileName + ".enc"
+		// Remove the original unencrypted file unless it's kept for local restores
+		if opts.KeepLocalPlaintext {
+			log.Warn("Keeping unencrypted local backup file",
+				zap.String("database", db.Name),
+				zap.String("file", backupFilePath))
+		} else if err := os.Remove(backupFilePath); err != nil {
+			log.Warn("Error removing original backup file",
 				zap.String("database", db.Name),
 				zap.String("file", backupFilePath),
 				zap.Error(err))
-			return nil, fmt.Errorf("error encrypting backup file: %v", err)
+		} else {
+			log.Debug("Original backup file removed",
+				zap.String("database", db.Name),
+				zap.String("file", backupFilePath))
 		}
+	}
 
-		if encryptedPath != backupFilePath {
-			log.Info("Backup file encrypted",
-				zap.String("database", db.Name),
-				zap.String("original_path", backupFilePath),
-				zap.String("encrypted_path", encryptedPath))
-			uploadFilePath = encryptedPath
-			uploadFileName = backupFileName + ".enc"
-			// Remove the original unencrypted file
-			if err := os.Remove(backupFilePath); err != nil {
-				log.Warn("Error removing original backup file",
-					zap.String("database", db.Name),
-					zap.String("file", backupFilePath),
-					zap.Error(err))
-			} else {
-				log.Debug("Original backup file removed",
-					zap.String("database", db.Name),
-					zap.String("file", backupFilePath))
-			}
+	var size int64
+	if info, err := os.Stat(uploadFilePath); err == nil {
+		size = info.Size()
+		span.SetAttributes(attribute.Int64("backup.size_bytes", size))
+	}
+
+	log.Debug("Adding upload request",
+		zap.String("database", db.Name),
+		zap.String("file_path", uploadFilePath),
+		zap.String("file_name", uploadFileName))
+	return Result{
+		Database:   db.Name,
+		FolderName: folderName,
+		Type:       db.Type,
+		FilePath:   uploadFilePath,
+		FileName:   uploadFileName,
+		Size:       size,
+		CreatedAt:  createdAt,
+		Duration:   time.Since(start),
+		Binlog:     binlog,
+	}, nil
+}
+
+// BundleFolderName is the S3 folder that holds bundled backups
+const BundleFolderName = "bundle"
+
+// BundleFileName returns the name of the bundle of a run at t, before encryption
+func BundleFileName(naming Naming, t time.Time) string {
+	return fmt.Sprintf("backup-%s.tar.gz", naming.Timestamp(t))
+}
+
+// Bundle tars the per-database backup files into a single backup-<timestamp>.tar.gz
+// in the work directory (next to the first database folder by default), encrypts it if encryption is enabled and
+// returns it as the only upload request. The bundled files are removed afterwards,
+// the unencrypted bundle is kept only with opts.KeepLocalPlaintext.
+func Bundle(ctx context.Context, results []Result, encryptor encryption.Provider, opts Options) (bundle Result, err error) {
+	log := logger.L()
+
+	_, span := tracing.Start(ctx, "backup.bundle", attribute.Int("backup.file_count", len(results)))
+	defer func() { tracing.End(span, err) }()
+
+	if len(results) == 0 {
+		return Result{}, fmt.Errorf("no backup files to bundle")
+	}
+
+	// Next to the first database folder, file names may nest below it
+	first := results[0]
+	bundleDir := filepath.Dir(strings.TrimSuffix(first.FilePath, string(filepath.Separator)+filepath.FromSlash(first.FileName)))
+	if opts.WorkDir != "" {
+		workDir, err := paths.Resolve(opts.WorkDir)
+		if err != nil {
+			return Result{}, fmt.Errorf("error resolving work directory: %v", err)
+		}
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			return Result{}, fmt.Errorf("failed to create work directory: %v", err)
 		}
+		bundleDir = workDir
+	}
+	createdAt := opts.now()
+	bundleFileName := BundleFileName(opts.Naming, createdAt)
+	bundlePath := filepath.Join(bundleDir, bundleFileName)
 
-		log.Debug("Adding upload request",
-			zap.String("database", db.Name),
-			zap.String("file_path", uploadFilePath),
-			zap.String("file_name", uploadFileName))
-		uploadRequests = append(uploadRequests, Result{
-			FolderName: db.Name,
-			FilePath:   uploadFilePath,
-			FileName:   uploadFileName,
-		})
+	entries := make([]ArchiveEntry, len(results))
+	for i, res := range results {
+		entries[i] = ArchiveEntry{
+			Name: filepath.Join(res.FolderName, res.FileName),
+			Path: res.FilePath,
+		}
+	}
+
+	log.Info("Bundling backup files",
+		zap.String("bundle", bundlePath),
+		zap.Int("file_count", len(entries)))
+	if err := CreateArchive(bundlePath, entries); err != nil {
+		return Result{}, fmt.Errorf("error creating bundle: %v", err)
+	}
+
+	for _, res := range results {
+		if err := os.Remove(res.FilePath); err != nil {
+			log.Warn("Error removing bundled backup file",
+				zap.String("file", res.FilePath),
+				zap.Error(err))
+		}
 	}
 
-	return uploadRequests, nil
+	encryptedPath, err := encryptor.EncryptFile(bundlePath)
+	if err != nil {
+		log.Error("Error encrypting bundle",
+			zap.String("file", bundlePath),
+			zap.Error(err))
+		return Result{}, fmt.Errorf("error encrypting bundle: %v", err)
+	}
+
+	if encryptedPath != bundlePath {
+		log.Info("Bundle encrypted",
+			zap.String("original_path", bundlePath),
+			zap.String("encrypted_path", encryptedPath))
+		if opts.KeepLocalPlaintext {
+			log.Warn("Keeping unencrypted local bundle", zap.String("file", bundlePath))
+		} else if err := os.Remove(bundlePath); err != nil {
+			log.Warn("Error removing unencrypted bundle",
+				zap.String("file", bundlePath),
+				zap.Error(err))
+		}
+		bundlePath = encryptedPath
+		bundleFileName = bundleFileName + ".enc"
+	}
+
+	bundle = Result{
+		Database:   BundleFolderName,
+		FolderName: BundleFolderName,
+		Type:       BundleFolderName,
+		FilePath:   bundlePath,
+		FileName:   bundleFileName,
+		CreatedAt:  createdAt,
+	}
+	if info, err := os.Stat(bundlePath); err == nil {
+		bundle.Size = info.Size()
+	}
+	return bundle, nil
 }
@@ -0,0 +1,338 @@
+package backup
+
+import (
+	"archive/tar"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/paths"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Incremental MySQL backups copy the binary logs written since the previous
+// backup. Full backups of databases with incremental enabled are taken with
+// --flush-logs --master-data=2, so the dump ends exactly where the binary log it
+// names in its header begins. Every incremental backup flushes the binary logs
+// and copies the closed ones from the recorded start onwards, the log that is
+// active afterwards is where the next incremental backup starts.
+
+// IncrementalSuffix is appended to the file names of incremental backups, which
+// are archives of the copied binary logs
+const IncrementalSuffix = ".binlog" + archiveSuffix
+
+// binlogHeaderLines bounds how far into a dump its binary log coordinates are searched
+const binlogHeaderLines = 100
+
+// binlogCoordinates matches the replication coordinates mysqldump and mariadb-dump
+// write as a comment with --master-data=2 or --source-data=2
+var binlogCoordinates = regexp.MustCompile(`(?:MASTER|SOURCE)_LOG_FILE='([^']+)'`)
+
+// IncrementalFolderName returns the folder holding the incremental backups of the database
+func IncrementalFolderName(name string) string {
+	return name + "-incremental"
+}
+
+// LocalIncrementalDir returns the local directory the incremental backups of the database are written to
+func LocalIncrementalDir(db Config) (string, error) {
+	absoluteDir, err := paths.Resolve(db.Directory)
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory path: %v", err)
+	}
+	return filepath.Join(absoluteDir, IncrementalFolderName(db.Name)), nil
+}
+
+// SupportsIncremental reports whether backup --incremental copies the binary logs of the database
+func SupportsIncremental(db Config) bool {
+	return db.Type == MySQL && db.Incremental
+}
+
+// mysqlIncrementalFlags returns the mysqldump flags that start a new binary log
+// with the dump and record it in the dump header
+func mysqlIncrementalFlags(db Config) []string {
+	if !db.Incremental {
+		return nil
+	}
+	return []string{"--flush-logs", "--master-data=2"}
+}
+
+// DumpBinlogFile returns the binary log a MySQL dump taken with --master-data
+// starts at, read from the header of the dump. Archived dumps are read from the
+// first file of the archive.
+func DumpBinlogFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening dump: %v", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if IsArchivedDump(path) {
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading gzip stream: %v", err)
+		}
+		defer gzr.Close()
+
+		tr := tar.NewReader(gzr)
+		if _, err := tr.Next(); err != nil {
+			return "", fmt.Errorf("error reading archive: %v", err)
+		}
+		r = tr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 0; line < binlogHeaderLines && scanner.Scan(); line++ {
+		if match := binlogCoordinates.FindStringSubmatch(scanner.Text()); match != nil {
+			return match[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return "", fmt.Errorf("error reading dump: %v", err)
+	}
+	return "", fmt.Errorf("dump %s has no binary log coordinates, is binary logging enabled on the server?", path)
+}
+
+// binlogSequence splits a binary log file name such as mysql-bin.000042 into
+// its base name and sequence number
+func binlogSequence(name string) (string, int, error) {
+	base, seq, found := strings.Cut(filepath.Base(name), ".")
+	n, err := strconv.Atoi(seq)
+	if !found || err != nil {
+		return "", 0, fmt.Errorf("invalid binary log file name: %s", name)
+	}
+	return base, n, nil
+}
+
+// BinlogFiles returns the binary logs of an extracted incremental backup in
+// order, path is the single log or the directory holding them
+func BinlogFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// CheckBinlogChain checks that the binary logs continue each other without a
+// gap, starting at the log a full backup named in its header
+func CheckBinlogChain(start string, logs []string) error {
+	expectBase, expectSeq, err := binlogSequence(start)
+	if err != nil {
+		return err
+	}
+	// The sequence number is zero-padded to a fixed width
+	width := len(filepath.Base(start)) - len(expectBase) - 1
+	for _, log := range logs {
+		base, seq, err := binlogSequence(log)
+		if err != nil {
+			return err
+		}
+		if base != expectBase || seq != expectSeq {
+			return fmt.Errorf("binary log %s.%0*d is missing, the next one available is %s", expectBase, width, expectSeq, filepath.Base(log))
+		}
+		expectSeq++
+	}
+	return nil
+}
+
+// listBinlogs rotates the binary logs of the server and returns them oldest
+// first, the last one is the newly opened log
+func listBinlogs(ctx context.Context, db Config, bins Binaries) ([]string, error) {
+	args := []string{"-u", db.User, "-N", "-B"}
+	if db.Host != "" {
+		args = append(args, "-h", db.Host)
+	}
+	if db.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(db.Port))
+	}
+	args = append(args, MySQLSSLArgs(db)...)
+	args = append(args, "-e", "FLUSH BINARY LOGS; SHOW BINARY LOGS")
+	cmd := ClientCommand(ctx, db.Container, false, []string{"MYSQL_PWD=" + db.Password},
+		BinaryOrDefault(bins.MySQL, "mysql"), args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &CommandError{Err: fmt.Errorf("error listing binary logs: %v", err), Stderr: stderr.String()}
+	}
+
+	var logs []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			logs = append(logs, fields[0])
+		}
+	}
+	if len(logs) < 2 {
+		return nil, fmt.Errorf("server listed %d binary logs after flushing them, is binary logging enabled?", len(logs))
+	}
+	return logs, nil
+}
+
+// binlogsSince returns the closed binary logs from start onwards. The active
+// log, the last one, is left for the next incremental backup.
+func binlogsSince(logs []string, start string) ([]string, error) {
+	for i, name := range logs[:len(logs)-1] {
+		if name == start {
+			return logs[i : len(logs)-1], nil
+		}
+	}
+	return nil, fmt.Errorf("binary log %s is no longer on the server, take a full backup to start a new chain", start)
+}
+
+// newBinlogCopyCommand builds the steps that copy the binary logs from the server
+// into dir. mysqlbinlog doesn't create the directory, inside a container it is
+// created first.
+func newBinlogCopyCommand(ctx context.Context, db Config, dir string, logs []string, bins Binaries) []Step {
+	steps := withContainerCopy(ctx, db.Container, dir, func(path string) *exec.Cmd {
+		args := []string{"--read-from-remote-server", "--raw", "-u", db.User}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-P", strconv.Itoa(db.Port))
+		}
+		args = append(args, MySQLSSLArgs(db)...)
+		args = append(args, "--result-file="+path+"/")
+		args = append(args, logs...)
+		return ClientCommand(ctx, db.Container, false, []string{"MYSQL_PWD=" + db.Password},
+			BinaryOrDefault(bins.MySQLBinlog, "mysqlbinlog"), args...)
+	})
+	if db.Container != "" {
+		mkdir := Step{Cmd: exec.CommandContext(ctx, "docker", "exec", db.Container, "mkdir", "-p", "/tmp/"+filepath.Base(dir))}
+		steps = append([]Step{mkdir}, steps...)
+	}
+	return steps
+}
+
+// incrementalFile returns the name and local path of the incremental backup of db taken at createdAt
+func incrementalFile(db Config, opts Options, createdAt time.Time) (string, string, error) {
+	fileName, err := opts.Naming.FileName(db, createdAt)
+	if err != nil {
+		return "", "", err
+	}
+	fileName += IncrementalSuffix
+
+	dir, err := LocalIncrementalDir(db)
+	if err != nil {
+		return "", "", err
+	}
+	return fileName, filepath.Join(dir, filepath.FromSlash(fileName)), nil
+}
+
+// backupBinlogs copies the binary logs of the database written since start into
+// an archive and returns its file name and the binary log the next incremental
+// backup starts at
+func backupBinlogs(ctx context.Context, db Config, opts Options, createdAt time.Time, start string) (string, string, error) {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.String("type", db.Type),
+	)
+
+	if start == "" {
+		return "", "", fmt.Errorf("no full backup of %s recorded a binary log position, take a full backup first", db.Name)
+	}
+
+	fileName, filePath, err := incrementalFile(db, opts, createdAt)
+	if err != nil {
+		log.Error("Error naming incremental backup file", zap.Error(err))
+		return "", "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	timeout := opts.DumpTimeout
+	if db.Timeout > 0 {
+		timeout = db.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	logs, err := listBinlogs(ctx, db, opts.Binaries)
+	if err != nil {
+		log.Error("Error listing binary logs", zap.Error(err))
+		return "", "", err
+	}
+	copied, err := binlogsSince(logs, start)
+	if err != nil {
+		log.Error("Incremental backup chain is broken", zap.String("start", start), zap.Error(err))
+		return "", "", err
+	}
+	next := logs[len(logs)-1]
+	log.Info("Copying binary logs",
+		zap.Strings("binlogs", copied),
+		zap.String("next_start", next),
+		zap.Duration("timeout", timeout))
+
+	// The logs are copied into a directory next to the archive, leftovers of an
+	// interrupted run would end up in it
+	dumpDir := dumpDirectory(filePath)
+	removeDumpDirectory := func() {
+		if err := os.RemoveAll(dumpDir); err != nil {
+			log.Warn("Error removing dump directory", zap.Error(err))
+		}
+	}
+	removeDumpDirectory()
+	defer removeDumpDirectory()
+	if err := os.MkdirAll(dumpDir, 0755); err != nil {
+		return "", "", fmt.Errorf("error creating dump directory: %v", err)
+	}
+
+	var copyErr error
+	for _, step := range newBinlogCopyCommand(ctx, db, dumpDir, copied, opts.Binaries) {
+		if copyErr != nil && !step.Cleanup {
+			continue
+		}
+		if err := runStep(step); err != nil {
+			if step.Cleanup {
+				log.Warn("Error cleaning up after binary log copy", zap.Error(err))
+				continue
+			}
+			copyErr = err
+		}
+	}
+	if copyErr == nil {
+		copyErr = ArchiveDirectory(filePath, dumpDir)
+	}
+	if copyErr != nil {
+		log.Error("Error copying binary logs", zap.Error(copyErr))
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Warn("Error removing partial backup file", zap.String("file", filePath), zap.Error(err))
+		}
+		return "", "", fmt.Errorf("error copying binary logs: %w", copyErr)
+	}
+
+	log.Info("Binary logs copied successfully", zap.String("backup_file", fileName))
+	return fileName, next, nil
+}
@@ -2,12 +2,16 @@ package backup
 
 import (
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/paths"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,6 +20,10 @@ const (
 	MySQL      = "mysql"
 	PostgreSQL = "postgresql"
 	InfluxDB   = "influxdb"
+	Redis      = "redis"
+	SQLite     = "sqlite"
+	// Command runs the command template of the database, for tools without a built-in type
+	Command = "command"
 )
 
 // Config represents a database configuration
@@ -28,42 +36,335 @@ type Config struct {
 	Password  string `koanf:"password"`
 	Directory string `koanf:"directory"`
 	Container string `koanf:"container,omitempty"`
+	// Enabled set to false pauses the backups of this database (default true)
+	Enabled *bool `koanf:"enabled"`
+	// ExemptFromDeletion keeps all backups of this database regardless of the deletion rules
+	ExemptFromDeletion bool `koanf:"exempt_from_deletion"`
+	// DeletionRules overrides the global deletion rules for this database's folder
+	DeletionRules *DeletionRules `koanf:"deletion_rules"`
+	// MySQL only: dump stored routines, triggers and events (all default to true)
+	DumpRoutines *bool `koanf:"dump_routines"`
+	DumpTriggers *bool `koanf:"dump_triggers"`
+	DumpEvents   *bool `koanf:"dump_events"`
+	// MySQL only: dump every database on the server with --all-databases,
+	// Name is then only the label of the backup
+	AllDatabases bool `koanf:"all_databases"`
+	// MySQL and PostgreSQL only: dump just these tables, or all tables but these.
+	// PostgreSQL accepts pg_dump patterns such as "public.log_*".
+	IncludeTables []string `koanf:"include_tables"`
+	ExcludeTables []string `koanf:"exclude_tables"`
+	// Timeout kills the dump when it runs longer, overrides the global dump_timeout
+	Timeout time.Duration `koanf:"timeout"`
+	// ExpectedInterval is how often this database is expected to be backed up,
+	// overrides the global expected_interval
+	ExpectedInterval time.Duration `koanf:"expected_interval"`
+	// Schedule is the cron expression the serve command backs up this database
+	// on, independently of the others. Databases without one follow the global schedule.
+	Schedule string `koanf:"schedule"`
+	// MySQL and PostgreSQL only: TLS for the connection. SSLMode takes the
+	// mysqldump --ssl-mode values (disabled, preferred, required, verify_ca,
+	// verify_identity) or the libpq sslmode values (disable, allow, prefer,
+	// require, verify-ca, verify-full). Paths are inside the container if one is set.
+	SSLMode string `koanf:"ssl_mode"`
+	SSLCA   string `koanf:"ssl_ca"`
+	SSLCert string `koanf:"ssl_cert"`
+	SSLKey  string `koanf:"ssl_key"`
+	// ExtraArgs are appended to the options of the dump command, each quoted as a single argument
+	ExtraArgs []string `koanf:"extra_args"`
+	// InfluxDB only: read the API token from an environment variable or a file
+	// instead of the password field. Exactly one source must be set.
+	TokenEnv  string `koanf:"token_env"`
+	TokenFile string `koanf:"token_file"`
+	// InfluxDB only: major version of the server, 1 backs up with influxd backup
+	// -portable, 2 (default) with influx backup
+	InfluxVersion int `koanf:"influx_version"`
+	// InfluxDB 1.x only: back up just this database, and of it just this
+	// retention policy. All databases are backed up by default.
+	Database  string `koanf:"database"`
+	Retention string `koanf:"retention"`
+	// SQLite only: path of the database file, host, port and user are ignored
+	DBPath string `koanf:"db_path"`
+	// SkipUnchanged skips the backup when the database hasn't changed since the
+	// last successful run, MySQL and PostgreSQL only
+	SkipUnchanged bool `koanf:"skip_unchanged"`
+	// ChangeQuery replaces the built-in change detection signal with the output of this query
+	ChangeQuery string `koanf:"change_query"`
+	// Command only: shell command writing the backup to {{.Output}}, rendered
+	// with .Output, .Name, .Host, .Port and .User. The password is passed in
+	// the BACKUP_DB_PASSWORD environment variable.
+	Command string `koanf:"command"`
+	// Archive packs the dump into a .tar.gz before encryption and upload.
+	// InfluxDB backups, written as a directory tree, are always archived.
+	Archive bool `koanf:"archive"`
+	// MySQL only: full backups record the binary log position they end at, so
+	// backup --incremental can copy the binary logs written since. Needs binary
+	// logging and the RELOAD and REPLICATION SLAVE privileges.
+	Incremental bool `koanf:"incremental"`
 }
 
-func NewDBBackupCommand(db Config, backupFilePath string) (*exec.Cmd, error) {
+// IsEnabled reports whether the database is backed up, unless enabled is set to false
+func (c Config) IsEnabled() bool {
+	return boolOrDefault(c.Enabled, true)
+}
+
+// DeletionRules holds per-database overrides of the global deletion rules,
+// unset fields fall back to the global value
+type DeletionRules struct {
+	MaxAgeDays        *int   `koanf:"max_age_days"`
+	MaxCount          *int   `koanf:"max_count"`
+	MaxTotalSizeBytes *int64 `koanf:"max_total_size_bytes"`
+}
+
+// Binaries holds path overrides for the database client binaries. Empty values
+// use the binary of the same name from PATH (inside the container when one is set).
+type Binaries struct {
+	MySQLDump string `koanf:"mysqldump_path"`
+	PgDump    string `koanf:"pg_dump_path"`
+	Influx    string `koanf:"influx_path"`
+	Influxd   string `koanf:"influxd_path"`
+	RedisCli  string `koanf:"redis_cli_path"`
+	SQLite3   string `koanf:"sqlite3_path"`
+	// MySQLBinlog copies the binary logs of incremental backups
+	MySQLBinlog string `koanf:"mysqlbinlog_path"`
+	// Clients used by the restore command
+	MySQL string `koanf:"mysql_path"`
+	Psql  string `koanf:"psql_path"`
+}
+
+// BinaryOrDefault returns the configured binary path or the default binary name
+func BinaryOrDefault(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path
+}
+
+// boolOrDefault returns the value of an optional boolean setting or def when unset
+func boolOrDefault(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+// mysqlObjectFlags returns the mysqldump flags for routines, triggers and events
+func mysqlObjectFlags(db Config) []string {
+	flags := make([]string, 0, 3)
+	if boolOrDefault(db.DumpRoutines, true) {
+		flags = append(flags, "--routines")
+	}
+	if boolOrDefault(db.DumpTriggers, true) {
+		flags = append(flags, "--triggers")
+	} else {
+		flags = append(flags, "--skip-triggers")
+	}
+	if boolOrDefault(db.DumpEvents, true) {
+		flags = append(flags, "--events")
+	}
+	return flags
+}
+
+// mysqlDatabaseArgs returns the mysqldump arguments selecting what to dump
+func mysqlDatabaseArgs(db Config) []string {
+	if db.AllDatabases {
+		return []string{"--all-databases"}
+	}
+
+	args := make([]string, 0, len(db.ExcludeTables)+len(db.IncludeTables)+1)
+	for _, table := range db.ExcludeTables {
+		args = append(args, fmt.Sprintf("--ignore-table=%s.%s", db.Name, table))
+	}
+	args = append(args, db.Name)
+	return append(args, db.IncludeTables...)
+}
+
+// pgTableFlags returns the pg_dump flags for the included or excluded tables
+func pgTableFlags(db Config) []string {
+	flags := make([]string, 0, 2*(len(db.IncludeTables)+len(db.ExcludeTables)))
+	for _, table := range db.IncludeTables {
+		flags = append(flags, "-t", table)
+	}
+	for _, table := range db.ExcludeTables {
+		flags = append(flags, "-T", table)
+	}
+	return flags
+}
+
+// MySQLSSLArgs returns the mysql client flags for the TLS settings of the database
+func MySQLSSLArgs(db Config) []string {
+	var args []string
+	if db.SSLMode != "" {
+		args = append(args, "--ssl-mode="+strings.ToUpper(db.SSLMode))
+	}
+	if db.SSLCA != "" {
+		args = append(args, "--ssl-ca="+db.SSLCA)
+	}
+	if db.SSLCert != "" {
+		args = append(args, "--ssl-cert="+db.SSLCert)
+	}
+	if db.SSLKey != "" {
+		args = append(args, "--ssl-key="+db.SSLKey)
+	}
+	return args
+}
+
+// PostgresSSLEnv returns the libpq environment variables for the TLS settings of the database
+func PostgresSSLEnv(db Config) []string {
+	var env []string
+	if db.SSLMode != "" {
+		env = append(env, "PGSSLMODE="+db.SSLMode)
+	}
+	if db.SSLCA != "" {
+		env = append(env, "PGSSLROOTCERT="+db.SSLCA)
+	}
+	if db.SSLCert != "" {
+		env = append(env, "PGSSLCERT="+db.SSLCert)
+	}
+	if db.SSLKey != "" {
+		env = append(env, "PGSSLKEY="+db.SSLKey)
+	}
+	return env
+}
+
+// killWaitDelay bounds how long a killed client's output is waited for
+const killWaitDelay = 5 * time.Second
+
+// Step is a single command of a backup
+type Step struct {
+	Cmd *exec.Cmd
+	// Output is the file the command's stdout is written to, empty if it writes none
+	Output string
+	// Cleanup steps run even if an earlier step failed
+	Cleanup bool
+}
+
+// NewDBBackupCommand builds the commands that dump the database to backupFilePath.
+// Commands are run directly without a shell and secrets are passed through the
+// environment, so they never show up in the process list or the logs. The
+// commands are killed when ctx is done, except for the cleanup steps.
+func NewDBBackupCommand(ctx context.Context, db Config, backupFilePath string, bins Binaries) ([]Step, error) {
 	log := logger.L().With(
 		zap.String("database", db.Name),
 		zap.String("type", db.Type),
 		zap.String("backup_path", backupFilePath),
 	)
 
-	baseCmd := ""
+	var steps []Step
 
 	switch db.Type {
 	// mysql dump command
 	case MySQL:
-		baseCmd = fmt.Sprintf(`mysqldump -u %s --password="%s" --no-tablespaces %s > %s`,
-			db.User, db.Password, db.Name, backupFilePath)
-		log.Debug("Generated MySQL backup command", zap.String("command", strings.Replace(baseCmd, db.Password, "****", -1)))
+		args := []string{"-u", db.User, "--no-tablespaces"}
+		args = append(args, MySQLSSLArgs(db)...)
+		args = append(args, mysqlObjectFlags(db)...)
+		args = append(args, mysqlIncrementalFlags(db)...)
+		args = append(args, db.ExtraArgs...)
+		args = append(args, mysqlDatabaseArgs(db)...)
+		cmd := ClientCommand(ctx, db.Container, false, []string{"MYSQL_PWD=" + db.Password},
+			BinaryOrDefault(bins.MySQLDump, "mysqldump"), args...)
+		steps = []Step{{Cmd: cmd, Output: backupFilePath}}
+		log.Debug("Generated MySQL backup command", zap.String("command", stepsString(steps)))
 
 	// postgresql dump command
 	case PostgreSQL:
-		baseCmd = fmt.Sprintf(`PGPASSWORD="%s" pg_dump -U %s -h %s%d %s > %s`,
-			db.Password, db.User, db.Host, db.Port, db.Name, backupFilePath)
-		log.Debug("Generated PostgreSQL backup command", zap.String("command", strings.Replace(baseCmd, db.Password, "****", -1)))
+		args := []string{"-U", db.User}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-p", strconv.Itoa(db.Port))
+		}
+		args = append(args, pgTableFlags(db)...)
+		args = append(args, db.ExtraArgs...)
+		args = append(args, db.Name)
+		cmd := ClientCommand(ctx, db.Container, false, append([]string{"PGPASSWORD=" + db.Password}, PostgresSSLEnv(db)...),
+			BinaryOrDefault(bins.PgDump, "pg_dump"), args...)
+		steps = []Step{{Cmd: cmd, Output: backupFilePath}}
+		log.Debug("Generated PostgreSQL backup command", zap.String("command", stepsString(steps)))
 
-	// influxdb backup command
+	// influxdb 1.x backup command, the backup RPC service needs no credentials
 	case InfluxDB:
-		// For InfluxDB, we need to create a directory for the backup
-		backupDir := filepath.Dir(backupFilePath)
 		// InfluxDB backup command requires a directory, not a file
-		baseCmd = fmt.Sprintf(`influx backup -t %s -h %s:%d -o %s %s`,
-			db.Password, // token
-			db.Host,
-			db.Port,
-			db.User, // org
-			backupDir)
-		log.Debug("Generated InfluxDB backup command", zap.String("command", strings.Replace(baseCmd, db.Password, "****", -1)))
+		backupDir := backupFilePath
+		if db.InfluxVersion == 1 {
+			steps = withContainerCopy(ctx, db.Container, backupDir, func(path string) *exec.Cmd {
+				args := []string{"backup", "-portable",
+					"-host", fmt.Sprintf("%s:%d", db.Host, db.Port),
+				}
+				if db.Database != "" {
+					args = append(args, "-database", db.Database)
+				}
+				if db.Retention != "" {
+					args = append(args, "-retention", db.Retention)
+				}
+				args = append(args, db.ExtraArgs...)
+				args = append(args, path)
+				return ClientCommand(ctx, db.Container, false, nil,
+					BinaryOrDefault(bins.Influxd, "influxd"), args...)
+			})
+			log.Debug("Generated InfluxDB 1.x backup command", zap.String("command", stepsString(steps)))
+			break
+		}
+
+		// influxdb 2.x backup command
+		token, err := InfluxToken(db)
+		if err != nil {
+			log.Error("Error resolving InfluxDB token", zap.Error(err))
+			return nil, fmt.Errorf("error resolving InfluxDB token: %v", err)
+		}
+		steps = withContainerCopy(ctx, db.Container, backupDir, func(path string) *exec.Cmd {
+			args := []string{"backup",
+				"-h", fmt.Sprintf("%s:%d", db.Host, db.Port),
+				"-o", db.User, // org
+			}
+			args = append(args, db.ExtraArgs...)
+			args = append(args, path)
+			return ClientCommand(ctx, db.Container, false, []string{"INFLUX_TOKEN=" + token},
+				BinaryOrDefault(bins.Influx, "influx"), args...)
+		})
+		log.Debug("Generated InfluxDB backup command", zap.String("command", stepsString(steps)))
+
+	// redis rdb snapshot command
+	case Redis:
+		redisCli := BinaryOrDefault(bins.RedisCli, "redis-cli")
+		var env []string
+		if db.Password != "" {
+			env = []string{"REDISCLI_AUTH=" + db.Password}
+		}
+		steps = withContainerCopy(ctx, db.Container, backupFilePath, func(path string) *exec.Cmd {
+			return ClientCommand(ctx, db.Container, false, env, redisCli, redisDumpArgs(db, path)...)
+		})
+		log.Debug("Generated Redis backup command", zap.String("command", stepsString(steps)))
+
+	// sqlite online backup command, consistent even while writes are in flight
+	case SQLite:
+		sqlite3 := BinaryOrDefault(bins.SQLite3, "sqlite3")
+		steps = withContainerCopy(ctx, db.Container, backupFilePath, func(path string) *exec.Cmd {
+			args := append(append([]string{}, db.ExtraArgs...), db.DBPath, fmt.Sprintf(".backup '%s'", path))
+			return ClientCommand(ctx, db.Container, false, nil, sqlite3, args...)
+		})
+		log.Debug("Generated SQLite backup command", zap.String("command", stepsString(steps)))
+
+	// arbitrary command rendered from the template of the database
+	case Command:
+		tmpl, err := parseCommand(db.Command)
+		if err != nil {
+			return nil, err
+		}
+		var env []string
+		if db.Password != "" {
+			env = []string{"BACKUP_DB_PASSWORD=" + db.Password}
+		}
+		var renderErr error
+		steps = withContainerCopy(ctx, db.Container, backupFilePath, func(path string) *exec.Cmd {
+			var command string
+			command, renderErr = renderCommand(tmpl, db, path)
+			return ClientCommand(ctx, db.Container, false, env, "sh", "-c", command)
+		})
+		if renderErr != nil {
+			return nil, renderErr
+		}
+		log.Debug("Generated custom backup command", zap.String("command", stepsString(steps)))
 
 	default:
 		log.Error("Unsupported database type", zap.String("type", string(db.Type)))
@@ -71,37 +372,116 @@ func NewDBBackupCommand(db Config, backupFilePath string) (*exec.Cmd, error) {
 	}
 
 	if db.Container != "" {
-		baseCmd = fmt.Sprintf(`docker exec %s %s`, db.Container, baseCmd)
 		log.Debug("Added container execution wrapper", zap.String("container", db.Container))
 	}
+	return steps, nil
+}
+
+// withContainerCopy returns the backup steps for a client that writes the backup by path.
+// Inside a container the backup is written to /tmp, copied out to hostPath and removed
+// from the container afterwards.
+func withContainerCopy(ctx context.Context, container, hostPath string, backupCmd func(path string) *exec.Cmd) []Step {
+	if container == "" {
+		return []Step{{Cmd: backupCmd(hostPath)}}
+	}
+
+	containerPath := "/tmp/" + filepath.Base(hostPath)
+	return []Step{
+		{Cmd: backupCmd(containerPath)},
+		{Cmd: exec.CommandContext(ctx, "docker", "cp", container+":"+containerPath, hostPath)},
+		{Cmd: exec.Command("docker", "exec", container, "rm", "-rf", containerPath), Cleanup: true},
+	}
+}
+
+// ClientCommand runs a database client on the host or inside the container. The
+// variables in env are set in the environment and forwarded to the container by
+// name, so their values never show up in the process list. The client is killed
+// when ctx is done.
+func ClientCommand(ctx context.Context, container string, stdin bool, env []string, name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if container == "" {
+		cmd = exec.CommandContext(ctx, name, args...)
+	} else {
+		dockerArgs := []string{"exec"}
+		if stdin {
+			dockerArgs = append(dockerArgs, "-i")
+		}
+		for _, v := range env {
+			dockerArgs = append(dockerArgs, "-e", strings.SplitN(v, "=", 2)[0])
+		}
+		dockerArgs = append(dockerArgs, container, name)
+		cmd = exec.CommandContext(ctx, "docker", append(dockerArgs, args...)...)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	// Don't wait forever for children of a killed client that keep its output open
+	cmd.WaitDelay = killWaitDelay
+	return cmd
+}
+
+// String returns the command line of the step with the values of the variables
+// it sets in the environment masked, so it can be shown without leaking secrets
+func (s Step) String() string {
+	inherited := make(map[string]bool)
+	for _, v := range os.Environ() {
+		inherited[v] = true
+	}
+
+	var line strings.Builder
+	for _, v := range s.Cmd.Env {
+		if !inherited[v] {
+			line.WriteString(strings.SplitN(v, "=", 2)[0] + "=" + secretMask + " ")
+		}
+	}
+	line.WriteString(s.Cmd.String())
+	if s.Output != "" {
+		line.WriteString(" > " + s.Output)
+	}
+	return line.String()
+}
+
+// stepsString returns the command lines of the steps, joined like a shell would run them
+func stepsString(steps []Step) string {
+	lines := make([]string, len(steps))
+	for i, step := range steps {
+		lines[i] = step.Cmd.String()
+		if step.Output != "" {
+			lines[i] += " > " + step.Output
+		}
+	}
+	return strings.Join(lines, " && ")
+}
 
-	return exec.Command("sh", "-c", baseCmd), nil
+// redisDumpArgs returns the redis-cli arguments that write an RDB snapshot to rdbPath,
+// the password is read from REDISCLI_AUTH
+func redisDumpArgs(db Config, rdbPath string) []string {
+	var args []string
+	if db.Host != "" {
+		args = append(args, "-h", db.Host)
+	}
+	if db.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(db.Port))
+	}
+	if db.User != "" {
+		args = append(args, "--user", db.User)
+	}
+	args = append(args, db.ExtraArgs...)
+	return append(args, "--rdb", rdbPath)
 }
 
-func backup(db Config) (string, error) {
+// backup dumps the database into a file named by the naming template for the
+// given time and returns its file name
+func backup(ctx context.Context, db Config, opts Options, createdAt time.Time) (string, error) {
 	log := logger.L().With(
 		zap.String("database", db.Name),
 		zap.String("type", db.Type),
 	)
 
-	backupFileName := fmt.Sprintf("%s_%s", db.Name, time.Now().Format("2006-01-02-15-04-05"))
-	if db.Type == InfluxDB {
-		backupFileName = backupFileName + ".influx"
-	} else {
-		backupFileName = backupFileName + ".sql"
-	}
-
-	// Resolve the directory path, including handling "~" as the home directory
-	absoluteDir, err := resolvePath(db.Directory)
+	backupFileName, backupFilePath, err := backupFile(db, opts, createdAt)
 	if err != nil {
-		log.Error("Error resolving directory path",
-			zap.String("directory", db.Directory),
-			zap.Error(err))
-		return "", fmt.Errorf("error resolving directory path: %v", err)
+		log.Error("Error naming backup file", zap.Error(err))
+		return "", err
 	}
 
-	backupFilePath := fmt.Sprintf("%s/%s/%s", absoluteDir, db.Name, backupFileName)
-
 	// Ensure that the backup directory exists
 	dir := filepath.Dir(backupFilePath)
 	err = os.MkdirAll(dir, 0755)
@@ -112,16 +492,9 @@ func backup(db Config) (string, error) {
 		return "", fmt.Errorf("failed to create backup directory: %v", err)
 	}
 
-	// Get the appropriate backup command based on database type
-	cmd, err := NewDBBackupCommand(db, backupFilePath)
-	if err != nil {
-		log.Error("Error creating backup command", zap.Error(err))
-		return "", fmt.Errorf("error creating backup command: %v", err)
-	}
-
 	// For MySQL, check if mysqldump is available when not using a container
 	if db.Type == MySQL && db.Container == "" {
-		if err := checkMariadbDumpAvailability(); err != nil {
+		if err := checkMariadbDumpAvailability(BinaryOrDefault(opts.Binaries.MySQLDump, "mysqldump")); err != nil {
 			log.Error("MySQL dump not available", zap.Error(err))
 			return "", err
 		}
@@ -129,72 +502,305 @@ func backup(db Config) (string, error) {
 
 	// For InfluxDB, check if influx CLI is available when not using a container
 	if db.Type == InfluxDB && db.Container == "" {
-		if err := checkInfluxAvailability(); err != nil {
+		bin := BinaryOrDefault(opts.Binaries.Influx, "influx")
+		if db.InfluxVersion == 1 {
+			bin = BinaryOrDefault(opts.Binaries.Influxd, "influxd")
+		}
+		if err := checkInfluxAvailability(bin); err != nil {
 			log.Error("Influx CLI not available", zap.Error(err))
 			return "", err
 		}
 	}
 
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	// For Redis, check if redis-cli is available when not using a container
+	if db.Type == Redis && db.Container == "" {
+		if err := checkRedisCliAvailability(BinaryOrDefault(opts.Binaries.RedisCli, "redis-cli")); err != nil {
+			log.Error("Redis CLI not available", zap.Error(err))
+			return "", err
+		}
+	}
 
-	// Run the backup command
-	log.Info("Executing backup command")
-	err = cmd.Run()
-	if err != nil {
+	// For SQLite, check if sqlite3 is available when not using a container
+	if db.Type == SQLite && db.Container == "" {
+		if err := checkSQLite3Availability(BinaryOrDefault(opts.Binaries.SQLite3, "sqlite3")); err != nil {
+			log.Error("SQLite CLI not available", zap.Error(err))
+			return "", err
+		}
+	}
+
+	// Run the dump, failed commands are retried up to DumpRetries times
+	timeout := opts.DumpTimeout
+	if db.Timeout > 0 {
+		timeout = db.Timeout
+	}
+	log.Info("Executing backup command", zap.Duration("timeout", timeout))
+	for attempt := 1; ; attempt++ {
+		err := runDump(ctx, db, backupFilePath, opts.Binaries, timeout)
+		if err == nil {
+			break
+		}
+
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			log.Error("Error backing up database", zap.Error(err))
+			return "", err
+		}
 		log.Error("Error running backup command",
-			zap.Error(err),
-			zap.String("stderr", stderr.String()))
-		return "", fmt.Errorf("error running backup command: %v, error message: %s", err, stderr.String())
+			zap.Int("attempt", attempt),
+			zap.Error(cmdErr.Err),
+			zap.String("stderr", cmdErr.Stderr))
+		if attempt > opts.DumpRetries || ctx.Err() != nil {
+			return "", err
+		}
+
+		log.Warn("Retrying backup command",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("retry_delay", opts.DumpRetryDelay))
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(opts.DumpRetryDelay):
+		}
 	}
 
 	log.Info("Backup command executed successfully")
 	return backupFileName, nil
 }
 
-// Helper function to resolve paths, including expanding "~" to the home directory
-func resolvePath(path string) (string, error) {
-	log := logger.L().With(zap.String("path", path))
+// runDump runs the backup commands of the database once. The commands are killed
+// after timeout if it is set. When a command fails the partial backup file is
+// removed, cleanup steps run even after a failure.
+func runDump(ctx context.Context, db Config, backupFilePath string, bins Binaries, timeout time.Duration) error {
+	log := logger.L().With(zap.String("database", db.Name))
 
-	if strings.HasPrefix(path, "~") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Error("Could not resolve home directory", zap.Error(err))
-			return "", fmt.Errorf("could not resolve home directory: %v", err)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Archived dumps are written to a directory next to the backup file that is
+	// packed into it afterwards and never kept. Leftovers of an interrupted run
+	// would end up in the archive.
+	dumpPath := dumpTarget(db, backupFilePath)
+	if archived(db) {
+		dumpDir := dumpDirectory(backupFilePath)
+		removeDumpDirectory := func() {
+			if err := os.RemoveAll(dumpDir); err != nil {
+				log.Warn("Error removing dump directory", zap.Error(err))
+			}
+		}
+		removeDumpDirectory()
+		defer removeDumpDirectory()
+
+		if !dumpsTree(db) {
+			if err := os.MkdirAll(dumpDir, 0755); err != nil {
+				return fmt.Errorf("error creating dump directory: %v", err)
+			}
 		}
-		return filepath.Join(homeDir, path[1:]), nil
 	}
 
-	return path, nil
+	// Get the appropriate backup command based on database type
+	steps, err := NewDBBackupCommand(ctx, db, dumpPath, bins)
+	if err != nil {
+		return fmt.Errorf("error creating backup command: %v", err)
+	}
+
+	var backupErr error
+	for _, step := range steps {
+		if backupErr != nil && !step.Cleanup {
+			continue
+		}
+		if err := runStep(step); err != nil {
+			if step.Cleanup {
+				log.Warn("Error cleaning up after backup command", zap.Error(err))
+				continue
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err.Err = fmt.Errorf("backup command timed out after %s", timeout)
+			}
+			backupErr = err
+		}
+	}
+	if backupErr == nil && archived(db) {
+		if err := ArchiveDirectory(backupFilePath, dumpDirectory(backupFilePath)); err != nil {
+			backupErr = fmt.Errorf("error archiving dump directory: %v", err)
+		}
+	}
+	if backupErr == nil {
+		return nil
+	}
+
+	// A failed dump may have left a partial file that must never be uploaded
+	if err := os.Remove(backupFilePath); err == nil {
+		log.Info("Removed partial backup file", zap.String("file", backupFilePath))
+	} else if !os.IsNotExist(err) {
+		log.Warn("Error removing partial backup file",
+			zap.String("file", backupFilePath),
+			zap.Error(err))
+	}
+	return backupErr
 }
 
-// checkInfluxAvailability checks if influx CLI is available on the system
-func checkInfluxAvailability() error {
-	log := logger.L()
-	cmd := exec.Command("sh", "-c", "command -v influx")
+// runStep runs a backup command, writing its stdout to the step's output file if it has one
+func runStep(step Step) *CommandError {
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	step.Cmd.Stderr = &stderr
+
+	if step.Output == "" {
+		if err := step.Cmd.Run(); err != nil {
+			return &CommandError{Err: err, Stderr: stderr.String()}
+		}
+		return nil
+	}
 
-	err := cmd.Run()
+	file, err := os.Create(step.Output)
 	if err != nil {
-		log.Error("InfluxDB CLI not found", zap.Error(err), zap.String("stderr", stderr.String()))
-		return fmt.Errorf("influx CLI is not installed or available on the system: %s", stderr.String())
+		return &CommandError{Err: fmt.Errorf("error creating backup file: %v", err)}
+	}
+	step.Cmd.Stdout = file
+	if err := step.Cmd.Run(); err != nil {
+		file.Close()
+		return &CommandError{Err: err, Stderr: stderr.String()}
+	}
+	if err := file.Close(); err != nil {
+		return &CommandError{Err: fmt.Errorf("error writing backup file: %v", err)}
+	}
+	return nil
+}
+
+// CommandError is returned when a backup command exits with an error
+type CommandError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("error running backup command: %v, error message: %s", e.Err, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// LocalDir returns the local directory the backups of the database are written to
+func LocalDir(db Config) (string, error) {
+	absoluteDir, err := paths.Resolve(db.Directory)
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory path: %v", err)
+	}
+	return filepath.Join(absoluteDir, db.Name), nil
+}
+
+// archiveSuffix is appended to the backup file name of archived dumps
+const archiveSuffix = ".tar.gz"
+
+// archived reports whether the dump of the database is packed into a .tar.gz
+// backup file, always the case for the directory trees of InfluxDB
+func archived(db Config) bool {
+	return db.Archive || db.Type == InfluxDB
+}
+
+// backupFile returns the name and local path of the backup file of db taken at createdAt
+func backupFile(db Config, opts Options, createdAt time.Time) (string, string, error) {
+	backupFileName, err := opts.Naming.FileName(db, createdAt)
+	if err != nil {
+		return "", "", err
+	}
+	switch db.Type {
+	case InfluxDB:
+		backupFileName = backupFileName + influxExtension(db)
+	case Redis:
+		backupFileName = backupFileName + ".rdb"
+	case SQLite:
+		backupFileName = backupFileName + ".sqlite"
+	case Command:
+		backupFileName = backupFileName + ".bak"
+	default:
+		backupFileName = backupFileName + ".sql"
+	}
+	if archived(db) {
+		backupFileName = backupFileName + archiveSuffix
+	}
+
+	// Resolve the directory path, including handling "~" as the home directory
+	absoluteDir, err := paths.Resolve(db.Directory)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving directory path: %v", err)
+	}
+
+	return backupFileName, fmt.Sprintf("%s/%s/%s", absoluteDir, db.Name, backupFileName), nil
+}
+
+// dumpTarget returns the path the backup command writes to: the backup file
+// itself, or for archived dumps the dump directory or a file inside it
+func dumpTarget(db Config, backupFilePath string) string {
+	if !archived(db) {
+		return backupFilePath
+	}
+	dumpDir := dumpDirectory(backupFilePath)
+	if dumpsTree(db) {
+		return dumpDir
+	}
+	return filepath.Join(dumpDir, filepath.Base(dumpDir))
+}
+
+// dumpsTree reports whether the archived dump is a directory tree written by
+// the backup command, rather than a single file placed in the dump directory
+func dumpsTree(db Config) bool {
+	return db.Type == InfluxDB || db.Type == Command
+}
+
+// dumpDirectory returns the directory the dump is written to before it is
+// archived into backupFilePath
+func dumpDirectory(backupFilePath string) string {
+	return strings.TrimSuffix(backupFilePath, archiveSuffix)
+}
+
+// influxExtension returns the backup file extension of the InfluxDB version,
+// the formats of 1.x and 2.x backups are incompatible
+func influxExtension(db Config) string {
+	if db.InfluxVersion == 1 {
+		return ".influx1"
+	}
+	return ".influx"
+}
+
+// checkInfluxAvailability checks if influx CLI is available on the system
+func checkInfluxAvailability(bin string) error {
+	if _, err := exec.LookPath(bin); err != nil {
+		logger.L().Error("InfluxDB CLI not found", zap.String("binary", bin), zap.Error(err))
+		return fmt.Errorf("influx CLI (%s) is not installed or available on the system: %v", bin, err)
 	}
 
 	return nil
 }
 
 // checkMariadbDumpAvailability checks if mariadb-dump is available on the system
-func checkMariadbDumpAvailability() error {
-	log := logger.L()
-	cmd := exec.Command("sh", "-c", "command -v mysqldump")
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+func checkMariadbDumpAvailability(bin string) error {
+	if _, err := exec.LookPath(bin); err != nil {
+		logger.L().Error("MySQL dump not found", zap.String("binary", bin), zap.Error(err))
+		return fmt.Errorf("mariadb-dump (%s) is not installed or available on the system: %v", bin, err)
+	}
 
-	err := cmd.Run()
-	if err != nil {
-		log.Error("MySQL dump not found", zap.Error(err), zap.String("stderr", stderr.String()))
-		return fmt.Errorf("mariadb-dump is not installed or available on the system: %s", stderr.String())
+	return nil
+}
+
+// checkRedisCliAvailability checks if redis-cli is available on the system
+func checkRedisCliAvailability(bin string) error {
+	if _, err := exec.LookPath(bin); err != nil {
+		logger.L().Error("Redis CLI not found", zap.String("binary", bin), zap.Error(err))
+		return fmt.Errorf("redis-cli (%s) is not installed or available on the system: %v", bin, err)
+	}
+
+	return nil
+}
+
+// checkSQLite3Availability checks if sqlite3 is available on the system
+func checkSQLite3Availability(bin string) error {
+	if _, err := exec.LookPath(bin); err != nil {
+		logger.L().Error("SQLite CLI not found", zap.String("binary", bin), zap.Error(err))
+		return fmt.Errorf("sqlite3 (%s) is not installed or available on the system: %v", bin, err)
 	}
 
 	return nil
@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDump writes a dump tool script to dir that prints a partial dump and exits with an error
+func fakeDump(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "pg_dump")
+	script := "#!/bin/sh\necho 'CREATE TABLE orders (id INT);'\necho 'connection lost' >&2\nexit 1\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("error writing fake dump tool: %v", err)
+	}
+	return path
+}
+
+func TestRunDumpRemovesPartialBackupFile(t *testing.T) {
+	bins := Binaries{PgDump: fakeDump(t, t.TempDir())}
+
+	tests := []struct {
+		name string
+		db   Config
+		file string
+	}{
+		{name: "plain", db: Config{Name: "crm", Type: PostgreSQL}, file: "crm_2024-06-01-00-00-00.sql"},
+		{name: "archived", db: Config{Name: "crm", Type: PostgreSQL, Archive: true}, file: "crm_2024-06-01-00-00-00.sql.tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := runDump(context.Background(), tt.db, filepath.Join(dir, tt.file), bins, 0)
+			if err == nil {
+				t.Fatal("runDump() succeeded with a failing dump command")
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				t.Errorf("failed dump left %s behind", entry.Name())
+			}
+		})
+	}
+}
+
+func TestPostgresHostAndPortArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		db   Config
+		want []string
+	}{
+		{name: "host and port", db: Config{Host: "db.example.com", Port: 5433}, want: []string{"-h", "db.example.com", "-p", "5433"}},
+		{name: "host", db: Config{Host: "db.example.com"}, want: []string{"-h", "db.example.com"}},
+		{name: "port", db: Config{Port: 5433}, want: []string{"-p", "5433"}},
+		{name: "neither", db: Config{}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.db.Name, tt.db.Type, tt.db.User = "crm", PostgreSQL, "postgres"
+			steps, err := NewDBBackupCommand(context.Background(), tt.db, "/backups/crm/crm.sql", Binaries{})
+			if err != nil {
+				t.Fatalf("NewDBBackupCommand() error = %v", err)
+			}
+
+			args := steps[0].Cmd.Args
+			want := append([]string{"pg_dump", "-U", "postgres"}, tt.want...)
+			if len(args) < len(want) || strings.Join(args[:len(want)], " ") != strings.Join(want, " ") {
+				t.Errorf("command %q, want it to start with %q", args, want)
+			}
+			if args[len(args)-1] != "crm" {
+				t.Errorf("command %q, want the database name last", args)
+			}
+		})
+	}
+}
+
+func TestAvailabilityChecksDontRunThePath(t *testing.T) {
+	dir := t.TempDir()
+	installed := fakeDump(t, dir)
+	marker := filepath.Join(dir, "marker")
+	injected := "true; touch " + marker
+
+	checks := map[string]func(string) error{
+		"influx":    checkInfluxAvailability,
+		"mysqldump": checkMariadbDumpAvailability,
+		"redis-cli": checkRedisCliAvailability,
+		"sqlite3":   checkSQLite3Availability,
+	}
+	for name, check := range checks {
+		t.Run(name, func(t *testing.T) {
+			if err := check(installed); err != nil {
+				t.Errorf("check of an installed binary error = %v", err)
+			}
+			if err := check(injected); err == nil {
+				t.Errorf("check of %q succeeded", injected)
+			}
+			if _, err := os.Stat(marker); err == nil {
+				t.Fatalf("check of %q ran it through a shell", injected)
+			}
+		})
+	}
+}
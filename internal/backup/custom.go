@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// commandData is the data the command template is rendered with
+type commandData struct {
+	Output string
+	Name   string
+	Host   string
+	Port   int
+	User   string
+}
+
+// parseCommand parses the command template of a database of the Command type
+func parseCommand(text string) (*template.Template, error) {
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %v", err)
+	}
+	return tmpl, nil
+}
+
+// renderCommand renders the command that writes the backup of db to output
+func renderCommand(tmpl *template.Template, db Config, output string) (string, error) {
+	var buf bytes.Buffer
+	data := commandData{Output: output, Name: db.Name, Host: db.Host, Port: db.Port, User: db.User}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid command: %v", err)
+	}
+	return buf.String(), nil
+}
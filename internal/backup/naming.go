@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultNamingTemplate reproduces the <name>_<timestamp> file names
+	DefaultNamingTemplate = "{{.Name}}_{{.Timestamp}}"
+	// DefaultTimestampFormat is the Go time layout of the timestamp in file names
+	DefaultTimestampFormat = "2006-01-02-15-04-05"
+)
+
+// Naming controls how backup files are named. The template is rendered with
+// .Name, .Type, .Timestamp and .Hostname and may contain "/" to nest backups
+// in folders below the database folder. The rendered name is always placed in
+// the <name>/ database folder, so it must not start with {{.Name}}/ itself.
+// The extension of the database type (.sql, .rdb, ...) is always appended.
+type Naming struct {
+	Template        string `koanf:"template"`
+	TimestampFormat string `koanf:"timestamp_format"`
+}
+
+// namingData is the data the naming template is rendered with
+type namingData struct {
+	Name      string
+	Type      string
+	Timestamp string
+	Hostname  string
+}
+
+// Validate parses the template and renders it once so mistakes surface at config load time
+func (n Naming) Validate() error {
+	// Bundles are named after the timestamp alone, so it can't nest folders
+	if strings.Contains(n.TimestampFormat, "/") {
+		return fmt.Errorf("invalid naming.timestamp_format %q: must not contain \"/\", use naming.template to nest folders", n.TimestampFormat)
+	}
+	example := Config{Name: "example", Type: MySQL}
+	name, err := n.FileName(example, time.Now())
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(name, example.Name+"/") {
+		return fmt.Errorf("invalid naming.template %q: files are already stored in the <name>/ database folder, remove the leading {{.Name}}/", n.Template)
+	}
+	return nil
+}
+
+// FileName renders the file name of a backup of db taken at t, without extension
+func (n Naming) FileName(db Config, t time.Time) (string, error) {
+	text := n.Template
+	if text == "" {
+		text = DefaultNamingTemplate
+	}
+	tmpl, err := template.New("naming").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid naming.template: %v", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, namingData{
+		Name:      db.Name,
+		Type:      db.Type,
+		Timestamp: n.Timestamp(t),
+		Hostname:  hostname,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid naming.template: %v", err)
+	}
+
+	name := buf.String()
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || path.Clean(name) != name ||
+		name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid naming.template: %q is not a relative file path", name)
+	}
+	return name, nil
+}
+
+// Timestamp formats t with the configured timestamp format
+func (n Naming) Timestamp(t time.Time) string {
+	if n.TimestampFormat == "" {
+		return t.Format(DefaultTimestampFormat)
+	}
+	return t.Format(n.TimestampFormat)
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBackupFileNames(t *testing.T) {
+	createdAt := time.Date(2024, 6, 1, 14, 30, 5, 0, time.UTC)
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("error reading hostname: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		db     Config
+		naming Naming
+		want   string
+	}{
+		{name: "default", db: Config{Name: "shop", Type: MySQL}, want: "shop_2024-06-01-14-30-05.sql"},
+		{name: "postgres", db: Config{Name: "crm", Type: PostgreSQL}, want: "crm_2024-06-01-14-30-05.sql"},
+		{name: "redis", db: Config{Name: "cache", Type: Redis}, want: "cache_2024-06-01-14-30-05.rdb"},
+		{name: "sqlite", db: Config{Name: "app", Type: SQLite}, want: "app_2024-06-01-14-30-05.sqlite"},
+		{name: "command", db: Config{Name: "ldap", Type: Command}, want: "ldap_2024-06-01-14-30-05.bak"},
+		{name: "influxdb", db: Config{Name: "metrics", Type: InfluxDB}, want: "metrics_2024-06-01-14-30-05.influx.tar.gz"},
+		{name: "influxdb 1", db: Config{Name: "metrics", Type: InfluxDB, InfluxVersion: 1}, want: "metrics_2024-06-01-14-30-05.influx1.tar.gz"},
+		{name: "archived", db: Config{Name: "shop", Type: MySQL, Archive: true}, want: "shop_2024-06-01-14-30-05.sql.tar.gz"},
+		{
+			name:   "timestamp format",
+			db:     Config{Name: "shop", Type: MySQL},
+			naming: Naming{TimestampFormat: "20060102T150405Z"},
+			want:   "shop_20240601T143005Z.sql",
+		},
+		{
+			name:   "template",
+			db:     Config{Name: "shop", Type: MySQL},
+			naming: Naming{Template: "{{.Type}}-{{.Name}}-{{.Timestamp}}"},
+			want:   "mysql-shop-2024-06-01-14-30-05.sql",
+		},
+		{
+			name:   "nested template",
+			db:     Config{Name: "shop", Type: MySQL},
+			naming: Naming{Template: "{{.Type}}/{{.Timestamp}}", TimestampFormat: "20060102"},
+			want:   "mysql/20240601.sql",
+		},
+		{
+			name:   "hostname",
+			db:     Config{Name: "shop", Type: MySQL},
+			naming: Naming{Template: "{{.Hostname}}_{{.Name}}"},
+			want:   hostname + "_shop.sql",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Naming: tt.naming, Clock: func() time.Time { return createdAt }}
+			tt.db.Directory = "/backups"
+
+			name, path, err := backupFile(tt.db, opts, opts.now())
+			if err != nil {
+				t.Fatalf("backupFile() error = %v", err)
+			}
+			if name != tt.want {
+				t.Errorf("file name = %q, want %q", name, tt.want)
+			}
+			if wantPath := "/backups/" + tt.db.Name + "/" + tt.want; path != wantPath {
+				t.Errorf("file path = %q, want %q", path, wantPath)
+			}
+		})
+	}
+}
+
+func TestBundleFileName(t *testing.T) {
+	createdAt := time.Date(2024, 6, 1, 14, 30, 5, 0, time.UTC)
+	if got := BundleFileName(Naming{}, createdAt); got != "backup-2024-06-01-14-30-05.tar.gz" {
+		t.Errorf("BundleFileName() = %q", got)
+	}
+	if got := BundleFileName(Naming{TimestampFormat: "20060102"}, createdAt); got != "backup-20240601.tar.gz" {
+		t.Errorf("BundleFileName() with timestamp format = %q", got)
+	}
+}
+
+func TestInvalidNamingTemplates(t *testing.T) {
+	tests := []struct {
+		name   string
+		naming Naming
+	}{
+		{name: "unparsable", naming: Naming{Template: "{{.Name"}},
+		{name: "unknown field", naming: Naming{Template: "{{.Database}}"}},
+		{name: "empty", naming: Naming{Template: "{{if false}}x{{end}}"}},
+		{name: "absolute", naming: Naming{Template: "/{{.Name}}"}},
+		{name: "parent directory", naming: Naming{Template: "../{{.Name}}"}},
+		{name: "database folder", naming: Naming{Template: "{{.Name}}/{{.Timestamp}}/dump"}},
+		{name: "slash in timestamp format", naming: Naming{TimestampFormat: "2006/01/02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.naming.Validate(); err == nil {
+				t.Errorf("Validate() accepted %+v", tt.naming)
+			}
+		})
+	}
+}
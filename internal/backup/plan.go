@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+)
+
+// PlannedBackup is the backup of a database that a run would take
+type PlannedBackup struct {
+	Database string
+	Type     string
+	// FileName and FilePath name the backup file before encryption
+	FileName string
+	FilePath string
+	// Steps are the commands that would write the backup file
+	Steps []Step
+}
+
+// Plan builds the backups of the enabled databases without running or creating
+// anything, named after the current time of opts
+func Plan(ctx context.Context, dbConfigs []Config, opts Options) ([]PlannedBackup, error) {
+	createdAt := opts.now()
+
+	plans := make([]PlannedBackup, 0, len(dbConfigs))
+	for _, db := range dbConfigs {
+		if !db.IsEnabled() {
+			logSkippedDisabled(db)
+			continue
+		}
+
+		fileName, filePath, err := backupFile(db, opts, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error planning backup of %s: %v", db.Name, err)
+		}
+		steps, err := NewDBBackupCommand(ctx, db, dumpTarget(db, filePath), opts.Binaries)
+		if err != nil {
+			return nil, fmt.Errorf("error planning backup of %s: %v", db.Name, err)
+		}
+		plans = append(plans, PlannedBackup{
+			Database: db.Name,
+			Type:     db.Type,
+			FileName: fileName,
+			FilePath: filePath,
+			Steps:    steps,
+		})
+	}
+	return plans, nil
+}
@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"backup-agent/internal/pkg/paths"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const secretMask = "****"
+
+// InfluxToken resolves the InfluxDB API token from the inline password,
+// the token_env environment variable or the token_file
+func InfluxToken(db Config) (string, error) {
+	switch {
+	case db.TokenEnv != "":
+		token := os.Getenv(db.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("environment variable %s is empty or not set", db.TokenEnv)
+		}
+		return token, nil
+	case db.TokenFile != "":
+		path, err := paths.Resolve(db.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading token file: %v", err)
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", db.TokenFile)
+		}
+		return token, nil
+	default:
+		return db.Password, nil
+	}
+}
+
+// MarshalLogObject logs the database configuration with its secrets masked
+func (c Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", c.Name)
+	enc.AddString("type", c.Type)
+	enc.AddString("host", c.Host)
+	enc.AddInt("port", c.Port)
+	enc.AddString("user", c.User)
+	if c.Password != "" {
+		enc.AddString("password", secretMask)
+	}
+	if c.TokenEnv != "" {
+		enc.AddString("token_env", c.TokenEnv)
+	}
+	if c.TokenFile != "" {
+		enc.AddString("token_file", c.TokenFile)
+	}
+	if c.InfluxVersion != 0 {
+		enc.AddInt("influx_version", c.InfluxVersion)
+	}
+	if c.Database != "" {
+		enc.AddString("database", c.Database)
+	}
+	if c.Retention != "" {
+		enc.AddString("retention", c.Retention)
+	}
+	if c.AllDatabases {
+		enc.AddBool("all_databases", c.AllDatabases)
+	}
+	if c.DBPath != "" {
+		enc.AddString("db_path", c.DBPath)
+	}
+	if c.SkipUnchanged {
+		enc.AddBool("skip_unchanged", c.SkipUnchanged)
+	}
+	if c.Command != "" {
+		enc.AddString("command", c.Command)
+	}
+	if c.Enabled != nil {
+		enc.AddBool("enabled", *c.Enabled)
+	}
+	if c.Archive {
+		enc.AddBool("archive", c.Archive)
+	}
+	if c.Incremental {
+		enc.AddBool("incremental", c.Incremental)
+	}
+	enc.AddString("directory", c.Directory)
+	if c.Container != "" {
+		enc.AddString("container", c.Container)
+	}
+	return nil
+}
+
+// Configs is a list of database configurations that can be logged with secrets masked
+type Configs []Config
+
+// MarshalLogArray logs every database configuration with its secrets masked
+func (c Configs) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, db := range c {
+		if err := enc.AppendObject(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// mysqlSSLModes are the values of mysqldump --ssl-mode
+	mysqlSSLModes = []string{"disabled", "preferred", "required", "verify_ca", "verify_identity"}
+	// postgresSSLModes are the values of the libpq sslmode
+	postgresSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+)
+
+// Validate checks the database configuration for conflicting settings
+func (c Config) Validate() error {
+	if c.Schedule != "" {
+		if _, err := cron.ParseStandard(c.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q: %v", c.Schedule, err)
+		}
+	}
+
+	if c.Type == InfluxDB && c.InfluxVersion != 0 && c.InfluxVersion != 1 && c.InfluxVersion != 2 {
+		return fmt.Errorf("invalid influx_version %d: must be 1 or 2", c.InfluxVersion)
+	}
+	if c.Type != InfluxDB && c.InfluxVersion != 0 {
+		return fmt.Errorf("influx_version is only supported for %s", InfluxDB)
+	}
+	if (c.Database != "" || c.Retention != "") && (c.Type != InfluxDB || c.InfluxVersion != 1) {
+		return fmt.Errorf("database and retention are only supported for %s with influx_version 1", InfluxDB)
+	}
+	if c.Retention != "" && c.Database == "" {
+		return fmt.Errorf("retention requires database")
+	}
+
+	if c.Type == InfluxDB && c.InfluxVersion == 1 {
+		// The backup service of InfluxDB 1.x doesn't authenticate
+		if c.TokenEnv != "" || c.TokenFile != "" {
+			return fmt.Errorf("token_env and token_file are only supported for InfluxDB 2.x")
+		}
+	} else if c.Type == InfluxDB {
+		sources := 0
+		for _, source := range []string{c.Password, c.TokenEnv, c.TokenFile} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("exactly one of password, token_env or token_file must be set for the InfluxDB token, got %d", sources)
+		}
+	} else if c.TokenEnv != "" || c.TokenFile != "" {
+		return fmt.Errorf("token_env and token_file are only supported for %s", InfluxDB)
+	}
+
+	if c.Type == Command {
+		if c.Command == "" {
+			return fmt.Errorf("command is required for %s", Command)
+		}
+		// Render once so template mistakes surface at config load time
+		tmpl, err := parseCommand(c.Command)
+		if err != nil {
+			return err
+		}
+		if _, err := renderCommand(tmpl, c, "/tmp/example"); err != nil {
+			return err
+		}
+	} else if c.Command != "" {
+		return fmt.Errorf("command is only supported for the %s type", Command)
+	}
+
+	if c.Type == SQLite && c.DBPath == "" {
+		return fmt.Errorf("db_path is required for %s", SQLite)
+	}
+
+	if len(c.IncludeTables) > 0 || len(c.ExcludeTables) > 0 {
+		if c.Type != MySQL && c.Type != PostgreSQL {
+			return fmt.Errorf("include_tables and exclude_tables are only supported for %s and %s", MySQL, PostgreSQL)
+		}
+		if len(c.IncludeTables) > 0 && len(c.ExcludeTables) > 0 {
+			return fmt.Errorf("include_tables and exclude_tables can't both be set")
+		}
+		if c.AllDatabases {
+			return fmt.Errorf("include_tables and exclude_tables are not supported with all_databases")
+		}
+		for _, tables := range [][]string{c.IncludeTables, c.ExcludeTables} {
+			for _, table := range tables {
+				if table == "" {
+					return fmt.Errorf("invalid table name %q", table)
+				}
+			}
+		}
+	}
+
+	if c.SSLMode != "" || c.SSLCA != "" || c.SSLCert != "" || c.SSLKey != "" {
+		if c.Type != MySQL && c.Type != PostgreSQL {
+			return fmt.Errorf("ssl_mode, ssl_ca, ssl_cert and ssl_key are only supported for %s and %s", MySQL, PostgreSQL)
+		}
+		if (c.SSLCert == "") != (c.SSLKey == "") {
+			return fmt.Errorf("ssl_cert and ssl_key must be set together")
+		}
+	}
+	if c.SSLMode != "" {
+		modes := postgresSSLModes
+		if c.Type == MySQL {
+			modes = mysqlSSLModes
+		}
+		if !slices.Contains(modes, c.SSLMode) {
+			return fmt.Errorf("invalid ssl_mode %q for %s: must be one of %s", c.SSLMode, c.Type, strings.Join(modes, ", "))
+		}
+	}
+
+	if c.AllDatabases {
+		if c.Type != MySQL {
+			return fmt.Errorf("all_databases is only supported for %s", MySQL)
+		}
+		if c.SkipUnchanged {
+			return fmt.Errorf("skip_unchanged is not supported with all_databases")
+		}
+	}
+
+	if c.Incremental && c.Type != MySQL {
+		return fmt.Errorf("incremental is only supported for %s", MySQL)
+	}
+
+	if c.SkipUnchanged && c.Type != MySQL && c.Type != PostgreSQL {
+		return fmt.Errorf("skip_unchanged is only supported for %s and %s", MySQL, PostgreSQL)
+	}
+	if c.ChangeQuery != "" && !c.SkipUnchanged {
+		return fmt.Errorf("change_query requires skip_unchanged")
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if c.ExpectedInterval < 0 {
+		return fmt.Errorf("expected_interval must not be negative")
+	}
+
+	if rules := c.DeletionRules; rules != nil {
+		if rules.MaxAgeDays != nil && *rules.MaxAgeDays < 0 {
+			return fmt.Errorf("deletion_rules.max_age_days must not be negative")
+		}
+		if rules.MaxCount != nil && *rules.MaxCount < 0 {
+			return fmt.Errorf("deletion_rules.max_count must not be negative")
+		}
+		if rules.MaxTotalSizeBytes != nil && *rules.MaxTotalSizeBytes < 0 {
+			return fmt.Errorf("deletion_rules.max_total_size_bytes must not be negative")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultPath is where the catalog is kept unless catalog_path is set
+const DefaultPath = "/var/lib/go-backup/catalog.json"
+
+// Entry is the recorded state of a database after its last successful backup run
+type Entry struct {
+	// ChangeSignal is the change detection value observed before the last backup
+	ChangeSignal string `json:"change_signal,omitempty"`
+	// Binlog is the binary log the next incremental backup starts at, recorded
+	// by the backups of MySQL databases with incremental enabled
+	Binlog    string    `json:"binlog,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Catalog keeps local state between backup runs in a JSON file
+type Catalog struct {
+	path      string
+	Databases map[string]Entry `json:"databases"`
+	// Failures counts the consecutive failed runs seen by each notification channel
+	Failures map[string]int `json:"failures,omitempty"`
+}
+
+// Load reads the catalog at path, a missing file yields an empty catalog
+func Load(path string) (*Catalog, error) {
+	c := &Catalog{
+		path:      path,
+		Databases: make(map[string]Entry),
+		Failures:  make(map[string]int),
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog: %v", err)
+	}
+
+	if err := json.Unmarshal(content, c); err != nil {
+		return nil, fmt.Errorf("error parsing catalog %s: %v", path, err)
+	}
+	if c.Databases == nil {
+		c.Databases = make(map[string]Entry)
+	}
+	if c.Failures == nil {
+		c.Failures = make(map[string]int)
+	}
+	return c, nil
+}
+
+// Get returns the entry of the database and whether one was recorded
+func (c *Catalog) Get(name string) (Entry, bool) {
+	entry, ok := c.Databases[name]
+	return entry, ok
+}
+
+// Set records the entry of the database
+func (c *Catalog) Set(name string, entry Entry) {
+	c.Databases[name] = entry
+}
+
+// FailureCount returns the number of consecutive failures recorded under key
+func (c *Catalog) FailureCount(key string) int {
+	return c.Failures[key]
+}
+
+// SetFailureCount records the number of consecutive failures under key
+func (c *Catalog) SetFailureCount(key string, count int) {
+	if count == 0 {
+		delete(c.Failures, key)
+		return
+	}
+	c.Failures[key] = count
+}
+
+// Save writes the catalog back to its file, replacing it atomically
+func (c *Catalog) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %v", err)
+	}
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding catalog: %v", err)
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return fmt.Errorf("error writing catalog: %v", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("error replacing catalog: %v", err)
+	}
+	return nil
+}
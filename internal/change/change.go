@@ -0,0 +1,73 @@
+// Package change detects whether a database changed since its last backup by
+// reading a cheap signal that changes whenever its data does. A backup is skipped
+// when the signal equals the value recorded after the previous successful run.
+//
+// Limitations per engine:
+//   - MySQL: the signal combines the latest UPDATE_TIME, the row estimates and the
+//     data sizes from information_schema.TABLES. InnoDB keeps UPDATE_TIME in memory
+//     only, so it resets on server restart (causing one extra backup). Engines
+//     without UPDATE_TIME only notice changes to row estimates or sizes, and
+//     routine, trigger or event changes are not seen at all.
+//   - PostgreSQL: the signal sums the insert, update and delete counters of
+//     pg_stat_user_tables. Counters reset by pg_stat_reset() or a crash cause one
+//     extra backup, schema changes without data changes are not seen, and the
+//     statistics collector may lag behind recent commits by a few hundred milliseconds.
+//   - A change_query replaces the built-in signal, its complete output is compared.
+//   - Other database types don't support change detection.
+package change
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/restore"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	mysqlSignalQuery = `SELECT CONCAT_WS(',', COALESCE(MAX(UPDATE_TIME), ''), COALESCE(SUM(TABLE_ROWS), 0), COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0)) ` +
+		`FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()`
+	postgresSignalQuery = `SELECT COALESCE(SUM(n_tup_ins + n_tup_upd + n_tup_del), 0) FROM pg_stat_user_tables`
+)
+
+// Supported reports whether change detection is available for the database type
+func Supported(dbType string) bool {
+	return dbType == backup.MySQL || dbType == backup.PostgreSQL
+}
+
+// signalQuery returns the change_query of the database or the built-in query of its engine
+func signalQuery(db backup.Config) (string, error) {
+	if db.ChangeQuery != "" {
+		return db.ChangeQuery, nil
+	}
+	switch db.Type {
+	case backup.MySQL:
+		return mysqlSignalQuery, nil
+	case backup.PostgreSQL:
+		return postgresSignalQuery, nil
+	default:
+		return "", fmt.Errorf("change detection is not supported for database type: %s", db.Type)
+	}
+}
+
+// Signal reads the current change signal of the database
+func Signal(db backup.Config, bins backup.Binaries) (string, error) {
+	query, err := signalQuery(db)
+	if err != nil {
+		return "", err
+	}
+
+	cmd, err := restore.NewVerifyQueryCommand(db, query, bins)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running change query: %v, error message: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ChainCommand picks the backups that restore a MySQL database with incremental
+// backups to a point in time: the newest full backup taken at or before it and
+// the incremental backups taken since, up to the first one past the point in time
+type ChainCommand struct {
+	s3Client *s3.S3
+	cfg      *config.Config
+	database string
+	until    time.Time
+}
+
+// RestoreChain is the full backup and the ordered incremental backups chosen by a ChainCommand
+type RestoreChain struct {
+	Full         SelectedBackup
+	Incrementals []SelectedBackup
+}
+
+// NewChainCommand creates a new ChainCommand for the backups of database
+func NewChainCommand(s3Client *s3.S3, cfg *config.Config, database string) *ChainCommand {
+	return &ChainCommand{
+		s3Client: s3Client,
+		cfg:      cfg,
+		database: database,
+		until:    time.Now(),
+	}
+}
+
+// WithUntil sets the point in time the database is restored to
+func (c *ChainCommand) WithUntil(until time.Time) *ChainCommand {
+	c.until = until
+	return c
+}
+
+// Execute selects the full backup and lists the incremental folder for the backups
+// taken after it. Incremental backups are dated like full ones, by their backup-time
+// metadata or LastModified for uploads without it, and objects uploaded before the
+// full backup was taken aren't looked at.
+func (c *ChainCommand) Execute(ctx context.Context) (*RestoreChain, error) {
+	log := logger.L().With(
+		zap.String("database", c.database),
+		zap.Time("until", c.until))
+
+	full, err := NewSelectCommand(c.s3Client, c.cfg, c.database).
+		WithBefore(c.until).
+		Execute(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := c.s3Client.KeyComponent(backup.IncrementalFolderName(c.database))
+	listResp, err := c.s3Client.List(ctx, c.cfg.S3.Bucket, folder+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incremental backups of %s: %w", c.database, err)
+	}
+
+	var incrementals []SelectedBackup
+	for _, file := range listResp.Files {
+		if strings.HasSuffix(file.Key, "/") || file.CreatedAt.Before(full.BackupTime) {
+			continue
+		}
+
+		info, err := c.s3Client.HeadObject(ctx, c.cfg.S3.Bucket, file.Key)
+		if err != nil {
+			return nil, err
+		}
+		backupTime := info.BackupTime
+		if backupTime.IsZero() {
+			backupTime = file.CreatedAt
+		}
+		if backupTime.After(full.BackupTime) {
+			incrementals = append(incrementals, SelectedBackup{Key: file.Key, BackupTime: backupTime})
+		}
+	}
+	sort.Slice(incrementals, func(i, j int) bool {
+		return incrementals[i].BackupTime.Before(incrementals[j].BackupTime)
+	})
+
+	// The first incremental backup taken after the point in time holds its events
+	for i, inc := range incrementals {
+		if inc.BackupTime.After(c.until) {
+			incrementals = incrementals[:i+1]
+			break
+		}
+	}
+
+	chain := &RestoreChain{Full: *full, Incrementals: incrementals}
+	log.Info("Selected restore chain",
+		zap.String("full", full.Key),
+		zap.Time("full_backup_time", full.BackupTime),
+		zap.Int("incremental_count", len(incrementals)))
+	return chain, nil
+}
+
+// Reaches reports whether the incremental backups of the chain cover the point in time
+func (c *RestoreChain) Reaches(until time.Time) bool {
+	if len(c.Incrementals) == 0 {
+		return !c.Full.BackupTime.Before(until)
+	}
+	return !c.Incrementals[len(c.Incrementals)-1].BackupTime.Before(until)
+}
@@ -2,22 +2,29 @@ package command
 
 import (
 	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
 	"backup-agent/internal/config"
 	"backup-agent/internal/pkg/logger"
 	"context"
+	"errors"
 	"fmt"
-	"path"
 	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // DeleteCommand handles the deletion of old backups based on configured rules
 type DeleteCommand struct {
-	s3Client *s3.S3
-	cfg      *config.Config
-	dryRun   bool
+	s3Client    *s3.S3
+	cfg         *config.Config
+	dryRun      bool
+	summaryOnly bool
+	pruneEmpty  bool
+	database    string
+	olderThan   time.Duration
 }
 
 // DeleteStats holds statistics about the deletion operation
@@ -29,6 +36,8 @@ type DeleteStats struct {
 	RetainedSize   int64
 	OldestRetained time.Time
 	NewestRetained time.Time
+	// PrunedFolders is the number of empty folder markers removed
+	PrunedFolders int
 	// Per database statistics
 	DatabaseStats map[string]*DatabaseStats
 }
@@ -59,6 +68,32 @@ func (c *DeleteCommand) WithDryRun(dryRun bool) *DeleteCommand {
 	return c
 }
 
+// WithSummaryOnly suppresses per-file info logs, keeping warnings and errors
+func (c *DeleteCommand) WithSummaryOnly(summaryOnly bool) *DeleteCommand {
+	c.summaryOnly = summaryOnly
+	return c
+}
+
+// WithPruneEmptyFolders removes leftover folder markers of folders without backups
+func (c *DeleteCommand) WithPruneEmptyFolders(pruneEmpty bool) *DeleteCommand {
+	c.pruneEmpty = pruneEmpty
+	return c
+}
+
+// WithDatabase limits the deletion to the folders of the given database, its
+// backups and incremental backups
+func (c *DeleteCommand) WithDatabase(database string) *DeleteCommand {
+	c.database = database
+	return c
+}
+
+// WithOlderThan replaces the configured rules with deleting every backup older
+// than olderThan, for ad-hoc cleanups. Exempt databases still retain their backups.
+func (c *DeleteCommand) WithOlderThan(olderThan time.Duration) *DeleteCommand {
+	c.olderThan = olderThan
+	return c
+}
+
 // Execute runs the deletion command based on configured rules
 func (c *DeleteCommand) Execute(ctx context.Context) (*DeleteStats, error) {
 	log := logger.L()
@@ -66,15 +101,15 @@ func (c *DeleteCommand) Execute(ctx context.Context) (*DeleteStats, error) {
 		DatabaseStats: make(map[string]*DatabaseStats),
 	}
 
-	if !c.cfg.DeletionRules.Enabled {
+	// Ad-hoc cleanups don't depend on the configured rules
+	if !c.cfg.DeletionRules.Enabled && c.olderThan == 0 {
 		log.Info("backup deletion is disabled")
 		return stats, nil
 	}
 
-	// List all backups (files in the bucket)
-	listResp, err := c.s3Client.List(ctx, c.cfg.S3.Bucket, "")
+	listResp, err := c.listFiles(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files: %w", err)
+		return nil, err
 	}
 
 	if len(listResp.Files) == 0 {
@@ -82,180 +117,235 @@ func (c *DeleteCommand) Execute(ctx context.Context) (*DeleteStats, error) {
 		return stats, nil
 	}
 
-	// Group files by database folder
+	// Group files by database folder, folder markers are not backups
 	dbFiles := make(map[string][]s3.FileInfo)
+	var markers []s3.FileInfo
 	for _, file := range listResp.Files {
-		// Get the database folder name (first part of the key)
-		dbFolder := path.Dir(file.Key)
+		if isFolderMarker(file) {
+			markers = append(markers, file)
+			continue
+		}
+		// Get the database folder name (first part of the key, file names may nest below it)
+		dbFolder := folderOf(file.Key)
 		dbFiles[dbFolder] = append(dbFiles[dbFolder], file)
 	}
 
+	// Keys that are (or in dry-run mode would be) deleted
+	deletedKeys := make(map[string]bool)
+
+	// Incremental backups are planned after the full backups they build on
+	folders := make([]string, 0, len(dbFiles))
+	for dbFolder := range dbFiles {
+		folders = append(folders, dbFolder)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		_, incI := c.fullFolderOf(folders[i])
+		_, incJ := c.fullFolderOf(folders[j])
+		if incI != incJ {
+			return incJ
+		}
+		return folders[i] < folders[j]
+	})
+	fullPlans := make(map[string]*retentionPlan)
+
 	// Process each database folder
-	for dbFolder, files := range dbFiles {
-		// Initialize database stats
-		dbStats := &DatabaseStats{}
-		stats.DatabaseStats[dbFolder] = dbStats
-
-		// Sort files by creation time (newest first)
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].CreatedAt.After(files[j].CreatedAt)
-		})
-
-		dbStats.TotalFiles = len(files)
-		stats.TotalFiles += len(files)
-
-		// Initialize sets for files to delete and retain
-		filesToDelete := make(map[string]s3.FileInfo)
-		filesToRetain := make(map[string]s3.FileInfo)
-
-		// Apply time-based rule independently
-		if c.cfg.DeletionRules.MaxAgeDays > 0 {
-			cutoffTime := time.Now().AddDate(0, 0, -c.cfg.DeletionRules.MaxAgeDays)
-			for _, file := range files {
-				if file.CreatedAt.Before(cutoffTime) {
-					filesToDelete[file.Key] = file
-				} else {
-					filesToRetain[file.Key] = file
-				}
-			}
-			log.Info("applied time-based retention rule for database",
-				zap.String("database", dbFolder),
-				zap.Int("max_age_days", c.cfg.DeletionRules.MaxAgeDays),
-				zap.Time("cutoff_time", cutoffTime),
-				zap.Int("files_to_delete", len(filesToDelete)),
-				zap.Int("files_to_retain", len(filesToRetain)))
+	for _, dbFolder := range folders {
+		files := dbFiles[dbFolder]
+		// Databases may override the global rules, exempt ones retain all their backups
+		db, _ := c.dbConfigFor(dbFolder)
+		rules := c.cfg.DeletionRules.Override(db.DeletionRules)
+
+		candidates := make([]retentionFile, len(files))
+		for i, file := range files {
+			candidates[i] = retentionFile(file)
 		}
+		var plan retentionPlan
+		if fullFolder, incremental := c.fullFolderOf(dbFolder); incremental {
+			plan = planIncrementalRetention(dbFolder, candidates, fullPlans[fullFolder], db.ExemptFromDeletion)
+		} else if c.olderThan > 0 {
+			plan = planOlderThan(dbFolder, candidates, c.olderThan, db.ExemptFromDeletion, time.Now())
+		} else {
+			plan = planRetention(dbFolder, candidates, rules, db.ExemptFromDeletion, time.Now())
+		}
+		fullPlans[dbFolder] = &plan
 
-		// Apply count-based rule independently
-		if c.cfg.DeletionRules.MaxCount > 0 {
-			// If we have more files than max_count, mark the excess for deletion
-			if len(files) > c.cfg.DeletionRules.MaxCount {
-				// Keep only the most recent max_count files
-				for i, file := range files {
-					if i >= c.cfg.DeletionRules.MaxCount {
-						filesToDelete[file.Key] = file
-						delete(filesToRetain, file.Key)
-					} else {
-						filesToRetain[file.Key] = file
-						delete(filesToDelete, file.Key)
-					}
-				}
-			} else {
-				// If we have fewer files than max_count, keep all of them
-				for _, file := range files {
-					filesToRetain[file.Key] = file
-					delete(filesToDelete, file.Key)
-				}
-			}
-			log.Info("applied count-based retention rule for database",
-				zap.String("database", dbFolder),
-				zap.Int("max_count", c.cfg.DeletionRules.MaxCount),
-				zap.Int("files_to_delete", len(filesToDelete)),
-				zap.Int("files_to_retain", len(filesToRetain)))
+		dbStats := stats.record(dbFolder, len(files), plan)
+		dbStats.logSummary(dbFolder, c.dryRun)
+
+		filesToDelete := make([]s3.FileInfo, len(plan.Delete))
+		for i, file := range plan.Delete {
+			filesToDelete[i] = s3.FileInfo(file)
+			deletedKeys[file.Key] = true
 		}
 
-		// Convert maps to slices for final processing
-		var filesToDeleteSlice []s3.FileInfo
-		for _, file := range filesToDelete {
-			filesToDeleteSlice = append(filesToDeleteSlice, file)
+		if c.dryRun {
+			log.Info("dry run mode - no files were actually deleted")
+			continue
 		}
 
-		var filesToRetainSlice []s3.FileInfo
-		for _, file := range filesToRetain {
-			filesToRetainSlice = append(filesToRetainSlice, file)
+		// Delete the files for this database
+		if err := c.deleteFiles(ctx, filesToDelete); err != nil {
+			return stats, err
 		}
+	}
 
-		// Sort retained files by creation time for statistics
-		sort.Slice(filesToRetainSlice, func(i, j int) bool {
-			return filesToRetainSlice[i].CreatedAt.After(filesToRetainSlice[j].CreatedAt)
-		})
-
-		// Calculate database statistics
-		dbStats.DeletedFiles = len(filesToDeleteSlice)
-		dbStats.RetainedFiles = len(filesToRetainSlice)
-		if len(filesToRetainSlice) > 0 {
-			dbStats.OldestRetained = filesToRetainSlice[len(filesToRetainSlice)-1].CreatedAt
-			dbStats.NewestRetained = filesToRetainSlice[0].CreatedAt
+	// Remove folder markers of folders that no longer contain backups
+	if c.pruneEmpty {
+		pruned, err := c.pruneFolderMarkers(ctx, markers, listResp.Files, deletedKeys)
+		stats.PrunedFolders = pruned
+		if err != nil {
+			return stats, err
 		}
+	}
+
+	// Log overall deletion summary
+	stats.logSummary(c.dryRun)
 
-		for _, file := range filesToDeleteSlice {
-			dbStats.DeletedSize += file.Size
+	return stats, nil
+}
+
+// listFiles lists the backups the command applies to, the whole bucket or the
+// folders of the selected database
+func (c *DeleteCommand) listFiles(ctx context.Context) (*s3.ListResponse, error) {
+	if c.database == "" {
+		listResp, err := c.s3Client.List(ctx, c.cfg.S3.Bucket, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
 		}
-		for _, file := range filesToRetainSlice {
-			dbStats.RetainedSize += file.Size
+		return listResp, nil
+	}
+
+	all := &s3.ListResponse{}
+	for _, folder := range []string{c.database, backup.IncrementalFolderName(c.database)} {
+		listResp, err := c.s3Client.List(ctx, c.cfg.S3.Bucket, c.s3Client.KeyComponent(folder)+"/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of %s: %w", c.database, err)
 		}
+		all.Files = append(all.Files, listResp.Files...)
+	}
+	return all, nil
+}
 
-		// Update overall statistics
-		stats.DeletedFiles += dbStats.DeletedFiles
-		stats.RetainedFiles += dbStats.RetainedFiles
-		stats.DeletedSize += dbStats.DeletedSize
-		stats.RetainedSize += dbStats.RetainedSize
+// folderOf returns the database folder of an object key, its first path segment.
+// Backups nested below the folder by the naming template, such as
+// orders/2024/06/orders.sql, belong to the orders database.
+func folderOf(key string) string {
+	folder, _, found := strings.Cut(key, "/")
+	if !found {
+		return "."
+	}
+	return folder
+}
 
-		// Update overall oldest/newest retained times
-		if len(filesToRetainSlice) > 0 {
-			if stats.OldestRetained.IsZero() || filesToRetainSlice[len(filesToRetainSlice)-1].CreatedAt.Before(stats.OldestRetained) {
-				stats.OldestRetained = filesToRetainSlice[len(filesToRetainSlice)-1].CreatedAt
-			}
-			if stats.NewestRetained.IsZero() || filesToRetainSlice[0].CreatedAt.After(stats.NewestRetained) {
-				stats.NewestRetained = filesToRetainSlice[0].CreatedAt
+// isFolderMarker reports whether the object is a zero-byte "folder/" marker
+func isFolderMarker(file s3.FileInfo) bool {
+	return strings.HasSuffix(file.Key, "/") && file.Size == 0
+}
+
+// pruneFolderMarkers deletes the folder markers whose folder contains no remaining
+// backups and returns how many were (or in dry-run mode would be) removed
+func (c *DeleteCommand) pruneFolderMarkers(ctx context.Context, markers, files []s3.FileInfo, deletedKeys map[string]bool) (int, error) {
+	log := logger.L()
+
+	var empty []s3.FileInfo
+	for _, marker := range markers {
+		hasBackups := false
+		for _, file := range files {
+			if !isFolderMarker(file) && !deletedKeys[file.Key] && strings.HasPrefix(file.Key, marker.Key) {
+				hasBackups = true
+				break
 			}
 		}
+		if !hasBackups {
+			empty = append(empty, marker)
+		}
+	}
 
-		// Log database deletion summary
-		log.Info("deletion summary for database",
-			zap.String("database", dbFolder),
-			zap.Int("total_files", dbStats.TotalFiles),
-			zap.Int("files_to_delete", dbStats.DeletedFiles),
-			zap.Int("files_to_retain", dbStats.RetainedFiles),
-			zap.Int64("deleted_size_bytes", dbStats.DeletedSize),
-			zap.Int64("retained_size_bytes", dbStats.RetainedSize),
-			zap.Time("oldest_retained", dbStats.OldestRetained),
-			zap.Time("newest_retained", dbStats.NewestRetained),
-			zap.Bool("dry_run", c.dryRun))
+	log.Info("found empty folder markers",
+		zap.Int("folder_markers", len(markers)),
+		zap.Int("empty_folders", len(empty)),
+		zap.Bool("dry_run", c.dryRun))
 
-		if c.dryRun {
-			log.Info("dry run mode - no files were actually deleted")
-			continue
+	if c.dryRun {
+		for _, marker := range empty {
+			log.Info("dry run mode - would prune empty folder", zap.String("key", marker.Key))
 		}
+		return len(empty), nil
+	}
 
-		// Delete the files for this database
-		if err := c.deleteFiles(ctx, filesToDeleteSlice); err != nil {
-			return stats, err
-		}
+	if err := c.deleteFiles(ctx, empty); err != nil {
+		return 0, err
 	}
+	return len(empty), nil
+}
 
-	// Log overall deletion summary
-	log.Info("overall deletion summary",
-		zap.Int("total_files", stats.TotalFiles),
-		zap.Int("files_to_delete", stats.DeletedFiles),
-		zap.Int("files_to_retain", stats.RetainedFiles),
-		zap.Int64("deleted_size_bytes", stats.DeletedSize),
-		zap.Int64("retained_size_bytes", stats.RetainedSize),
-		zap.Time("oldest_retained", stats.OldestRetained),
-		zap.Time("newest_retained", stats.NewestRetained),
-		zap.Bool("dry_run", c.dryRun))
+// dbConfigFor returns the configuration of the database stored in dbFolder,
+// which may also be the folder of its incremental backups
+func (c *DeleteCommand) dbConfigFor(dbFolder string) (backup.Config, bool) {
+	for _, db := range c.cfg.DBConfigs {
+		if c.s3Client.KeyComponent(db.Name) == dbFolder ||
+			c.s3Client.KeyComponent(backup.IncrementalFolderName(db.Name)) == dbFolder {
+			return db, true
+		}
+	}
+	return backup.Config{}, false
+}
 
-	return stats, nil
+// fullFolderOf returns the folder of the full backups of a database with
+// incremental backups if dbFolder holds its incremental backups
+func (c *DeleteCommand) fullFolderOf(dbFolder string) (string, bool) {
+	for _, db := range c.cfg.DBConfigs {
+		if backup.SupportsIncremental(db) && c.s3Client.KeyComponent(backup.IncrementalFolderName(db.Name)) == dbFolder {
+			return c.s3Client.KeyComponent(db.Name), true
+		}
+	}
+	return "", false
 }
 
-// deleteFiles deletes the specified files and logs the operation
+// deleteFiles deletes the specified files in batches and logs the operation
 func (c *DeleteCommand) deleteFiles(ctx context.Context, files []s3.FileInfo) error {
 	log := logger.L()
-	for _, file := range files {
+	s3Client := c.s3Client
+	if c.summaryOnly {
+		log = log.WithOptions(zap.IncreaseLevel(zapcore.WarnLevel))
+		s3Client = s3Client.WithMinLogLevel(zapcore.WarnLevel)
+	}
+
+	keys := make([]string, len(files))
+	for i, file := range files {
 		log.Info("deleting file",
 			zap.String("key", file.Key),
 			zap.Time("created_at", file.CreatedAt),
 			zap.Int64("size", file.Size))
+		keys[i] = file.Key
+	}
+
+	err := s3Client.DeleteMultiple(ctx, c.cfg.S3.Bucket, keys)
 
-		if err := c.s3Client.Delete(ctx, c.cfg.S3.Bucket, file.Key); err != nil {
-			log.Error("failed to delete file",
-				zap.String("key", file.Key),
-				zap.Error(err))
-			return fmt.Errorf("failed to delete file %s: %w", file.Key, err)
+	// A partial failure still deleted the keys S3 did not report
+	failed := make(map[string]bool)
+	var deleteErr *s3.DeleteError
+	if errors.As(err, &deleteErr) {
+		for _, key := range deleteErr.Keys() {
+			failed[key] = true
 		}
+	} else if err != nil {
+		log.Error("failed to delete files",
+			zap.Int("file_count", len(keys)),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete files: %w", err)
+	}
 
+	for _, key := range keys {
+		if failed[key] {
+			log.Error("failed to delete file", zap.String("key", key))
+			continue
+		}
 		log.Info("successfully deleted file",
-			zap.String("key", file.Key))
+			zap.String("key", key))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete files: %w", err)
 	}
 	return nil
-} 
\ No newline at end of file
+}
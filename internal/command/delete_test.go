@@ -0,0 +1,142 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/config"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listingServer is a fake S3 answering every list request with the given keys,
+// each a day older than the one before, and head requests without metadata
+func listingServer(t *testing.T, keys []string) *s3.S3 {
+	t.Helper()
+
+	newest := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		prefix := r.URL.Query().Get("prefix")
+		var body strings.Builder
+		body.WriteString("<ListBucketResult><IsTruncated>false</IsTruncated>")
+		for i, key := range keys {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			fmt.Fprintf(&body, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>100</Size></Contents>",
+				key, newest.AddDate(0, 0, -i).Format(time.RFC3339))
+		}
+		body.WriteString("</ListBucketResult>")
+		fmt.Fprint(w, body.String())
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := s3.New(s3.Config{
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		Endpoint:       server.URL,
+		Region:         "us-east-1",
+		ForcePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating S3 adapter: %v", err)
+	}
+	return client
+}
+
+func TestFolderOf(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "orders/orders_2024-06-01.sql", want: "orders"},
+		{key: "orders/2024/06/dump.sql", want: "orders"},
+		{key: "orders/host-1/2024/06/01/dump.sql", want: "orders"},
+		{key: "orders-incremental/2024/06/orders.binlog.tar.gz", want: "orders-incremental"},
+		{key: "dump.sql", want: "."},
+	}
+	for _, tt := range tests {
+		if got := folderOf(tt.key); got != tt.want {
+			t.Errorf("folderOf(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRetentionCountsNestedBackupsPerDatabase(t *testing.T) {
+	// Newest first: one backup per day, spread over month and day folders
+	keys := []string{
+		"orders/2024/06/30/orders.sql",
+		"crm/host-1/crm.sql",
+		"orders/2024/06/29/orders.sql",
+		"crm/host-2/crm.sql",
+		"orders/2024/06/28/orders.sql",
+		"orders/2024/05/31/orders.sql",
+		"crm/host-1/crm_old.sql",
+		"orders/2024/05/30/orders.sql",
+	}
+	client := listingServer(t, keys)
+	cfg := &config.Config{
+		S3:            s3.Config{Bucket: "backups"},
+		DeletionRules: config.DeletionRules{Enabled: true, MaxCount: 3},
+	}
+
+	stats, err := NewDeleteCommand(client, cfg).WithDryRun(true).Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(stats.DatabaseStats) != 2 {
+		t.Fatalf("grouped into %d databases, want orders and crm", len(stats.DatabaseStats))
+	}
+	tests := []struct {
+		folder   string
+		total    int
+		retained int
+		deleted  int
+	}{
+		{folder: "orders", total: 5, retained: 3, deleted: 2},
+		{folder: "crm", total: 3, retained: 3, deleted: 0},
+	}
+	for _, tt := range tests {
+		dbStats, ok := stats.DatabaseStats[tt.folder]
+		if !ok {
+			t.Errorf("no retention statistics for %s", tt.folder)
+			continue
+		}
+		if dbStats.TotalFiles != tt.total || dbStats.RetainedFiles != tt.retained || dbStats.DeletedFiles != tt.deleted {
+			t.Errorf("%s: total %d retained %d deleted %d, want %d, %d and %d", tt.folder,
+				dbStats.TotalFiles, dbStats.RetainedFiles, dbStats.DeletedFiles, tt.total, tt.retained, tt.deleted)
+		}
+	}
+}
+
+func TestListGroupsNestedBackupsPerDatabase(t *testing.T) {
+	client := listingServer(t, []string{
+		"orders/2024/06/30/orders.sql",
+		"crm/host-1/crm.sql",
+		"orders/2024/05/31/orders.sql",
+	})
+	cfg := &config.Config{S3: s3.Config{Bucket: "backups"}}
+
+	report, err := NewListCommand(client, cfg).Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	counts := make(map[string]int)
+	for _, folder := range report.Folders {
+		counts[folder.Folder] = len(folder.Files)
+	}
+	if len(counts) != 2 || counts["orders"] != 2 || counts["crm"] != 1 {
+		t.Errorf("listed folders %v, want orders with 2 backups and crm with 1", counts)
+	}
+}
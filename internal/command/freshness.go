@@ -0,0 +1,134 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FreshnessCommand checks that every configured database has a recent backup in S3
+type FreshnessCommand struct {
+	s3Client          *s3.S3
+	cfg               *config.Config
+	maxAge            time.Duration
+	expectedIntervals bool
+}
+
+// FreshnessStatus holds the freshness of a single database's backups
+type FreshnessStatus struct {
+	Database     string
+	Folder       string
+	NewestBackup time.Time
+	// NewestKey and Size describe the newest backup, empty when there is none
+	NewestKey string
+	Size      int64
+	Age       time.Duration
+	// MaxAge is the age above which the database is stale
+	MaxAge time.Duration
+	Stale  bool
+}
+
+// FreshnessReport holds the result of a freshness check
+type FreshnessReport struct {
+	MaxAge    time.Duration
+	Databases []FreshnessStatus
+	// StaleCount is the number of databases without a backup within MaxAge
+	StaleCount int
+}
+
+// NewFreshnessCommand creates a new FreshnessCommand instance
+func NewFreshnessCommand(s3Client *s3.S3, cfg *config.Config) *FreshnessCommand {
+	return &FreshnessCommand{
+		s3Client: s3Client,
+		cfg:      cfg,
+		maxAge:   24 * time.Hour,
+	}
+}
+
+// WithMaxAge sets the maximum allowed age of the newest backup
+func (c *FreshnessCommand) WithMaxAge(maxAge time.Duration) *FreshnessCommand {
+	c.maxAge = maxAge
+	return c
+}
+
+// WithExpectedIntervals judges every database by its expected_interval instead of the max age
+func (c *FreshnessCommand) WithExpectedIntervals(expectedIntervals bool) *FreshnessCommand {
+	c.expectedIntervals = expectedIntervals
+	return c
+}
+
+// Execute finds the newest backup of every configured database and flags stale ones
+func (c *FreshnessCommand) Execute(ctx context.Context) (*FreshnessReport, error) {
+	log := logger.L()
+	report := &FreshnessReport{MaxAge: c.maxAge}
+	now := time.Now()
+
+	// Bundled backups of all databases share a single folder
+	folders := make([]string, len(c.cfg.DBConfigs))
+	for i, db := range c.cfg.DBConfigs {
+		folders[i] = c.s3Client.KeyComponent(db.Name)
+		if c.cfg.Bundle {
+			folders[i] = backup.BundleFolderName
+		}
+	}
+
+	prefixes := make([]string, len(folders))
+	for i, folder := range folders {
+		prefixes[i] = folder + "/"
+	}
+	listResp := c.s3Client.ListMultiple(ctx, c.cfg.S3.Bucket, prefixes, 0)
+
+	for i, db := range c.cfg.DBConfigs {
+		folderResp := listResp.Prefixes[prefixes[i]]
+		if folderResp.Error != nil {
+			return nil, fmt.Errorf("failed to list backups of %s: %w", db.Name, folderResp.Error)
+		}
+
+		status := FreshnessStatus{
+			Database: db.Name,
+			Folder:   folders[i],
+			MaxAge:   c.maxAge,
+		}
+		if c.expectedIntervals {
+			status.MaxAge = c.cfg.ExpectedIntervalOf(db)
+		}
+		for _, file := range folderResp.Files {
+			if file.CreatedAt.After(status.NewestBackup) {
+				status.NewestBackup = file.CreatedAt
+				status.NewestKey = file.Key
+				status.Size = file.Size
+			}
+		}
+
+		if status.NewestBackup.IsZero() {
+			status.Stale = true
+		} else {
+			status.Age = now.Sub(status.NewestBackup)
+			status.Stale = status.Age > status.MaxAge
+		}
+
+		if status.Stale {
+			report.StaleCount++
+			log.Warn("database backup is stale",
+				zap.String("database", db.Name),
+				zap.Time("newest_backup", status.NewestBackup),
+				zap.Duration("age", status.Age),
+				zap.Duration("max_age", status.MaxAge))
+		} else {
+			log.Info("database backup is fresh",
+				zap.String("database", db.Name),
+				zap.Time("newest_backup", status.NewestBackup),
+				zap.Duration("age", status.Age))
+		}
+
+		report.Databases = append(report.Databases, status)
+	}
+
+	return report, nil
+}
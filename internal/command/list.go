@@ -0,0 +1,93 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// ListCommand lists the backups stored in S3 grouped by database folder
+type ListCommand struct {
+	s3Client *s3.S3
+	cfg      *config.Config
+	database string
+}
+
+// FolderListing holds the backups of a single database folder, newest first
+type FolderListing struct {
+	Folder    string
+	Files     []s3.FileInfo
+	TotalSize int64
+}
+
+// ListReport holds the result of a listing
+type ListReport struct {
+	Folders []FolderListing
+}
+
+// NewListCommand creates a new ListCommand instance
+func NewListCommand(s3Client *s3.S3, cfg *config.Config) *ListCommand {
+	return &ListCommand{
+		s3Client: s3Client,
+		cfg:      cfg,
+	}
+}
+
+// WithDatabase limits the listing to the folder of the given database
+func (c *ListCommand) WithDatabase(database string) *ListCommand {
+	c.database = database
+	return c
+}
+
+// Execute lists the bucket and groups the backups by database folder
+func (c *ListCommand) Execute(ctx context.Context) (*ListReport, error) {
+	log := logger.L()
+
+	prefix := ""
+	if c.database != "" {
+		prefix = c.s3Client.KeyComponent(c.database) + "/"
+	}
+
+	listResp, err := c.s3Client.List(ctx, c.cfg.S3.Bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	// Group files by database folder, folder markers are not backups
+	folders := make(map[string]*FolderListing)
+	for _, file := range listResp.Files {
+		if isFolderMarker(file) {
+			continue
+		}
+		dbFolder := folderOf(file.Key)
+		listing, ok := folders[dbFolder]
+		if !ok {
+			listing = &FolderListing{Folder: dbFolder}
+			folders[dbFolder] = listing
+		}
+		listing.Files = append(listing.Files, file)
+		listing.TotalSize += file.Size
+	}
+
+	report := &ListReport{}
+	for _, listing := range folders {
+		sort.Slice(listing.Files, func(i, j int) bool {
+			return listing.Files[i].CreatedAt.After(listing.Files[j].CreatedAt)
+		})
+		report.Folders = append(report.Folders, *listing)
+	}
+	sort.Slice(report.Folders, func(i, j int) bool {
+		return report.Folders[i].Folder < report.Folders[j].Folder
+	})
+
+	log.Info("listed backups",
+		zap.String("prefix", prefix),
+		zap.Int("folders", len(report.Folders)),
+		zap.Int("files", len(listResp.Files)))
+	return report, nil
+}
@@ -0,0 +1,230 @@
+package command
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LocalDeleteCommand applies the deletion rules to the backups kept on local disk,
+// the files below the directory of every configured database
+type LocalDeleteCommand struct {
+	cfg         *config.Config
+	dryRun      bool
+	summaryOnly bool
+}
+
+// NewLocalDeleteCommand creates a new LocalDeleteCommand instance
+func NewLocalDeleteCommand(cfg *config.Config) *LocalDeleteCommand {
+	return &LocalDeleteCommand{
+		cfg: cfg,
+	}
+}
+
+// WithDryRun enables dry-run mode
+func (c *LocalDeleteCommand) WithDryRun(dryRun bool) *LocalDeleteCommand {
+	c.dryRun = dryRun
+	return c
+}
+
+// WithSummaryOnly suppresses per-file info logs, keeping warnings and errors
+func (c *LocalDeleteCommand) WithSummaryOnly(summaryOnly bool) *LocalDeleteCommand {
+	c.summaryOnly = summaryOnly
+	return c
+}
+
+// Execute runs the deletion rules against the local backup directories.
+// Backups are dated by their modification time.
+func (c *LocalDeleteCommand) Execute(ctx context.Context) (*DeleteStats, error) {
+	log := logger.L()
+	stats := &DeleteStats{
+		DatabaseStats: make(map[string]*DatabaseStats),
+	}
+
+	if !c.cfg.DeletionRules.Enabled {
+		log.Info("backup deletion is disabled")
+		return stats, nil
+	}
+
+	for _, db := range c.cfg.DBConfigs {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		folders, err := localFolders(db)
+		if err != nil {
+			return stats, fmt.Errorf("failed to resolve local directory of %s: %v", db.Name, err)
+		}
+		// The full backups come first, the incremental ones are planned after them
+		var full *retentionPlan
+		for _, folder := range folders {
+			plan, err := c.pruneFolder(db, folder, full, stats)
+			if err != nil {
+				return stats, err
+			}
+			if !folder.Incremental {
+				full = plan
+			}
+		}
+	}
+
+	// Log overall deletion summary
+	stats.logSummary(c.dryRun)
+
+	return stats, nil
+}
+
+// localFolder is a local directory holding backups of a database
+type localFolder struct {
+	Name        string
+	Dir         string
+	Incremental bool
+}
+
+// localFolders returns the local backup directories of the database, the one
+// of its incremental backups included if it takes them
+func localFolders(db backup.Config) ([]localFolder, error) {
+	dir, err := backup.LocalDir(db)
+	if err != nil {
+		return nil, err
+	}
+	folders := []localFolder{{Name: db.Name, Dir: dir}}
+	if backup.SupportsIncremental(db) {
+		dir, err := backup.LocalIncrementalDir(db)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, localFolder{Name: backup.IncrementalFolderName(db.Name), Dir: dir, Incremental: true})
+	}
+	return folders, nil
+}
+
+// pruneFolder applies the deletion rules of the database to one of its local backup
+// directories and returns its plan, nil if it holds no backups. Incremental backups
+// follow the plan of the full backups they build on.
+func (c *LocalDeleteCommand) pruneFolder(db backup.Config, folder localFolder, full *retentionPlan, stats *DeleteStats) (*retentionPlan, error) {
+	log := logger.L()
+
+	files, companions, err := listLocalFiles(folder.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local backups of %s: %w", db.Name, err)
+	}
+	if len(files) == 0 {
+		log.Info("no local backups found for database",
+			zap.String("database", folder.Name),
+			zap.String("directory", folder.Dir))
+		return nil, nil
+	}
+
+	var plan retentionPlan
+	if folder.Incremental {
+		plan = planIncrementalRetention(folder.Name, files, full, db.ExemptFromDeletion)
+	} else {
+		rules := c.cfg.DeletionRules.Override(db.DeletionRules)
+		plan = planRetention(folder.Name, files, rules, db.ExemptFromDeletion, time.Now())
+	}
+
+	dbStats := stats.record(folder.Name, len(files), plan)
+	dbStats.logSummary(folder.Name, c.dryRun)
+
+	if c.dryRun {
+		log.Info("dry run mode - no files were actually deleted")
+		return &plan, nil
+	}
+
+	return &plan, c.deleteFiles(plan.Delete, companions)
+}
+
+// listLocalFiles returns the backups below dir, a missing directory has none. An
+// encrypted backup and the plaintext kept next to it (keep_local_plaintext) are
+// one backup, listed under the encrypted file and dated by the newer and sized by
+// both files; the plaintext is returned as its companion, keyed by the backup.
+func listLocalFiles(dir string) ([]retentionFile, map[string][]string, error) {
+	var files []retentionFile
+	companions := make(map[string][]string)
+	byBackup := make(map[string]int)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(path, ".enc")
+		i, ok := byBackup[name]
+		if !ok {
+			byBackup[name] = len(files)
+			files = append(files, retentionFile{
+				Key:       path,
+				CreatedAt: info.ModTime(),
+				Size:      info.Size(),
+			})
+			return nil
+		}
+
+		// The other file of the pair was seen first
+		file := &files[i]
+		if path == name {
+			companions[file.Key] = []string{path}
+		} else {
+			companions[path] = []string{file.Key}
+			file.Key = path
+		}
+		file.Size += info.Size()
+		if info.ModTime().After(file.CreatedAt) {
+			file.CreatedAt = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, companions, nil
+}
+
+// deleteFiles removes the specified local backups with their companion files and logs the operation
+func (c *LocalDeleteCommand) deleteFiles(files []retentionFile, companions map[string][]string) error {
+	log := logger.L()
+	if c.summaryOnly {
+		log = log.WithOptions(zap.IncreaseLevel(zapcore.WarnLevel))
+	}
+
+	for _, file := range files {
+		log.Info("deleting local file",
+			zap.String("path", file.Key),
+			zap.Strings("companions", companions[file.Key]),
+			zap.Time("modified_at", file.CreatedAt),
+			zap.Int64("size", file.Size))
+
+		for _, path := range append([]string{file.Key}, companions[file.Key]...) {
+			if err := os.Remove(path); err != nil {
+				log.Error("failed to delete local file",
+					zap.String("path", path),
+					zap.Error(err))
+				return fmt.Errorf("failed to delete local file %s: %w", path, err)
+			}
+		}
+
+		log.Info("successfully deleted local file",
+			zap.String("path", file.Key))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLocalRetentionCountsKeptPlaintextWithItsBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbDir := filepath.Join(dir, "shop")
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newest first: three encrypted backups with their plaintext kept next to
+	// them (keep_local_plaintext), one taken before it was enabled
+	newest := time.Now().Add(-time.Hour)
+	backups := [][]string{
+		{"shop_2024-06-04.sql", "shop_2024-06-04.sql.enc"},
+		{"shop_2024-06-03.sql", "shop_2024-06-03.sql.enc"},
+		{"shop_2024-06-02.sql", "shop_2024-06-02.sql.enc"},
+		{"shop_2024-06-01.sql.enc"},
+	}
+	for i, files := range backups {
+		modified := newest.AddDate(0, 0, -i)
+		for _, name := range files {
+			path := filepath.Join(dbDir, name)
+			if err := os.WriteFile(path, []byte("backup"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cfg := &config.Config{
+		DBConfigs:     []backup.Config{{Name: "shop", Type: backup.PostgreSQL, Directory: dir}},
+		DeletionRules: config.DeletionRules{Enabled: true, MaxCount: 2},
+	}
+	stats, err := NewLocalDeleteCommand(cfg).Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	dbStats := stats.DatabaseStats["shop"]
+	if dbStats == nil {
+		t.Fatal("no retention statistics for shop")
+	}
+	if dbStats.TotalFiles != 4 || dbStats.RetainedFiles != 2 || dbStats.DeletedFiles != 2 {
+		t.Errorf("total %d retained %d deleted %d, want 4 backups with 2 retained and 2 deleted",
+			dbStats.TotalFiles, dbStats.RetainedFiles, dbStats.DeletedFiles)
+	}
+	if dbStats.RetainedSize != 4*int64(len("backup")) {
+		t.Errorf("retained size %d, want both files of the retained backups", dbStats.RetainedSize)
+	}
+
+	entries, err := os.ReadDir(dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	want := append(slices.Clone(backups[0]), backups[1]...)
+	slices.Sort(want)
+	if !slices.Equal(left, want) {
+		t.Errorf("left %v behind, want %v", left, want)
+	}
+}
@@ -0,0 +1,294 @@
+package command
+
+import (
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// retentionFile is a backup as seen by the retention rules, an object in S3 or a file on local disk
+type retentionFile struct {
+	Key       string // Object key or local path
+	CreatedAt time.Time
+	Size      int64
+}
+
+// retentionPlan is the outcome of applying the retention rules to the backups of a folder
+type retentionPlan struct {
+	Delete []retentionFile
+	Retain []retentionFile // Newest first
+}
+
+// planRetention applies the deletion rules to the backups of a database folder.
+// The age and count rules are applied independently, the size rule runs last on
+// whatever they retained. Exempt databases retain all their backups.
+func planRetention(dbFolder string, files []retentionFile, rules config.DeletionRules, exempt bool, now time.Time) retentionPlan {
+	log := logger.L()
+
+	// Sort files by creation time (newest first)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	// Initialize sets for files to delete and retain
+	filesToDelete := make(map[string]retentionFile)
+	filesToRetain := make(map[string]retentionFile)
+
+	if exempt {
+		for _, file := range files {
+			filesToRetain[file.Key] = file
+		}
+		log.Info("database is exempt from deletion, retaining all backups",
+			zap.String("database", dbFolder),
+			zap.Int("files_to_retain", len(filesToRetain)))
+	}
+
+	// Apply time-based rule independently
+	if !exempt && rules.MaxAgeDays > 0 {
+		cutoffTime := now.AddDate(0, 0, -rules.MaxAgeDays)
+		for _, file := range files {
+			if file.CreatedAt.Before(cutoffTime) {
+				filesToDelete[file.Key] = file
+			} else {
+				filesToRetain[file.Key] = file
+			}
+		}
+		log.Info("applied time-based retention rule for database",
+			zap.String("database", dbFolder),
+			zap.Int("max_age_days", rules.MaxAgeDays),
+			zap.Time("cutoff_time", cutoffTime),
+			zap.Int("files_to_delete", len(filesToDelete)),
+			zap.Int("files_to_retain", len(filesToRetain)))
+	}
+
+	// Apply count-based rule independently
+	if !exempt && rules.MaxCount > 0 {
+		// If we have more files than max_count, mark the excess for deletion
+		if len(files) > rules.MaxCount {
+			// Keep only the most recent max_count files
+			for i, file := range files {
+				if i >= rules.MaxCount {
+					filesToDelete[file.Key] = file
+					delete(filesToRetain, file.Key)
+				} else {
+					filesToRetain[file.Key] = file
+					delete(filesToDelete, file.Key)
+				}
+			}
+		} else {
+			// If we have fewer files than max_count, keep all of them
+			for _, file := range files {
+				filesToRetain[file.Key] = file
+				delete(filesToDelete, file.Key)
+			}
+		}
+		log.Info("applied count-based retention rule for database",
+			zap.String("database", dbFolder),
+			zap.Int("max_count", rules.MaxCount),
+			zap.Int("files_to_delete", len(filesToDelete)),
+			zap.Int("files_to_retain", len(filesToRetain)))
+	}
+
+	// Apply size-based rule on top of the others, oldest retained backups go first
+	if !exempt && rules.MaxTotalSizeBytes > 0 {
+		applySizeRule(dbFolder, rules.MaxTotalSizeBytes, files, filesToDelete, filesToRetain)
+	}
+
+	// Convert maps to slices for final processing
+	var plan retentionPlan
+	for _, file := range filesToDelete {
+		plan.Delete = append(plan.Delete, file)
+	}
+	for _, file := range filesToRetain {
+		plan.Retain = append(plan.Retain, file)
+	}
+
+	// Sort retained files by creation time for statistics
+	sort.Slice(plan.Retain, func(i, j int) bool {
+		return plan.Retain[i].CreatedAt.After(plan.Retain[j].CreatedAt)
+	})
+	return plan
+}
+
+// planIncrementalRetention plans the incremental backups of a database after its
+// full backups, the deletion rules aren't applied to them. An incremental backup
+// is only useful together with the full backup it builds on: every incremental
+// backup taken since the oldest retained full backup is kept, older ones are
+// deleted with the full backups they build on. Without a plan for the full
+// backups, e.g. when none are stored, or when no full backup is deleted, all
+// incremental backups are kept.
+func planIncrementalRetention(dbFolder string, files []retentionFile, full *retentionPlan, exempt bool) retentionPlan {
+	log := logger.L()
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	var plan retentionPlan
+	if exempt || full == nil || len(full.Delete) == 0 {
+		plan.Retain = files
+		log.Info("retaining all incremental backups of database",
+			zap.String("database", dbFolder),
+			zap.Bool("exempt", exempt),
+			zap.Int("files_to_retain", len(plan.Retain)))
+		return plan
+	}
+
+	// Retain is sorted newest first, the last one is the oldest retained full backup
+	var cutoffTime time.Time
+	if len(full.Retain) > 0 {
+		cutoffTime = full.Retain[len(full.Retain)-1].CreatedAt
+	}
+	for _, file := range files {
+		if len(full.Retain) > 0 && !file.CreatedAt.Before(cutoffTime) {
+			plan.Retain = append(plan.Retain, file)
+		} else {
+			plan.Delete = append(plan.Delete, file)
+		}
+	}
+	log.Info("applied incremental chain retention for database",
+		zap.String("database", dbFolder),
+		zap.Time("oldest_retained_full", cutoffTime),
+		zap.Int("files_to_delete", len(plan.Delete)),
+		zap.Int("files_to_retain", len(plan.Retain)))
+	return plan
+}
+
+// planOlderThan deletes the backups of a database folder older than olderThan,
+// replacing the deletion rules for ad-hoc cleanups. Exempt databases retain all their backups.
+func planOlderThan(dbFolder string, files []retentionFile, olderThan time.Duration, exempt bool, now time.Time) retentionPlan {
+	if exempt {
+		return planRetention(dbFolder, files, config.DeletionRules{}, true, now)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	var plan retentionPlan
+	cutoffTime := now.Add(-olderThan)
+	for _, file := range files {
+		if file.CreatedAt.Before(cutoffTime) {
+			plan.Delete = append(plan.Delete, file)
+		} else {
+			plan.Retain = append(plan.Retain, file)
+		}
+	}
+	logger.L().Info("applied ad-hoc age cleanup for database",
+		zap.String("database", dbFolder),
+		zap.Duration("older_than", olderThan),
+		zap.Time("cutoff_time", cutoffTime),
+		zap.Int("files_to_delete", len(plan.Delete)),
+		zap.Int("files_to_retain", len(plan.Retain)))
+	return plan
+}
+
+// applySizeRule deletes the oldest backups that aren't already marked for deletion
+// until the retained total of the folder fits maxSize. The newest backup is always
+// kept, even if it alone exceeds the budget. files must be sorted newest first.
+func applySizeRule(dbFolder string, maxSize int64, files []retentionFile, filesToDelete, filesToRetain map[string]retentionFile) {
+	log := logger.L()
+
+	var retained []retentionFile
+	var retainedSize int64
+	for _, file := range files {
+		if _, ok := filesToDelete[file.Key]; ok {
+			continue
+		}
+		filesToRetain[file.Key] = file
+		retained = append(retained, file)
+		retainedSize += file.Size
+	}
+
+	for i := len(retained) - 1; i > 0 && retainedSize > maxSize; i-- {
+		file := retained[i]
+		filesToDelete[file.Key] = file
+		delete(filesToRetain, file.Key)
+		retainedSize -= file.Size
+	}
+
+	if len(retained) > 0 && retainedSize > maxSize {
+		log.Warn("newest backup alone exceeds the size budget, keeping it",
+			zap.String("database", dbFolder),
+			zap.String("key", retained[0].Key),
+			zap.Int64("size", retained[0].Size),
+			zap.Int64("max_total_size_bytes", maxSize))
+	}
+
+	log.Info("applied size-based retention rule for database",
+		zap.String("database", dbFolder),
+		zap.Int64("max_total_size_bytes", maxSize),
+		zap.Int64("retained_size_bytes", retainedSize),
+		zap.Int("files_to_delete", len(filesToDelete)),
+		zap.Int("files_to_retain", len(filesToRetain)))
+}
+
+// record adds the plan of a database folder to the statistics and returns the folder's statistics
+func (s *DeleteStats) record(dbFolder string, total int, plan retentionPlan) *DatabaseStats {
+	dbStats := &DatabaseStats{
+		TotalFiles:    total,
+		DeletedFiles:  len(plan.Delete),
+		RetainedFiles: len(plan.Retain),
+	}
+	s.DatabaseStats[dbFolder] = dbStats
+
+	if len(plan.Retain) > 0 {
+		dbStats.OldestRetained = plan.Retain[len(plan.Retain)-1].CreatedAt
+		dbStats.NewestRetained = plan.Retain[0].CreatedAt
+	}
+	for _, file := range plan.Delete {
+		dbStats.DeletedSize += file.Size
+	}
+	for _, file := range plan.Retain {
+		dbStats.RetainedSize += file.Size
+	}
+
+	// Update overall statistics
+	s.TotalFiles += dbStats.TotalFiles
+	s.DeletedFiles += dbStats.DeletedFiles
+	s.RetainedFiles += dbStats.RetainedFiles
+	s.DeletedSize += dbStats.DeletedSize
+	s.RetainedSize += dbStats.RetainedSize
+
+	// Update overall oldest/newest retained times
+	if len(plan.Retain) > 0 {
+		if s.OldestRetained.IsZero() || dbStats.OldestRetained.Before(s.OldestRetained) {
+			s.OldestRetained = dbStats.OldestRetained
+		}
+		if s.NewestRetained.IsZero() || dbStats.NewestRetained.After(s.NewestRetained) {
+			s.NewestRetained = dbStats.NewestRetained
+		}
+	}
+	return dbStats
+}
+
+// logSummary logs the deletion summary of a database folder
+func (d *DatabaseStats) logSummary(dbFolder string, dryRun bool) {
+	logger.L().Info("deletion summary for database",
+		zap.String("database", dbFolder),
+		zap.Int("total_files", d.TotalFiles),
+		zap.Int("files_to_delete", d.DeletedFiles),
+		zap.Int("files_to_retain", d.RetainedFiles),
+		zap.Int64("deleted_size_bytes", d.DeletedSize),
+		zap.Int64("retained_size_bytes", d.RetainedSize),
+		zap.Time("oldest_retained", d.OldestRetained),
+		zap.Time("newest_retained", d.NewestRetained),
+		zap.Bool("dry_run", dryRun))
+}
+
+// logSummary logs the overall deletion summary
+func (s *DeleteStats) logSummary(dryRun bool) {
+	logger.L().Info("overall deletion summary",
+		zap.Int("total_files", s.TotalFiles),
+		zap.Int("files_to_delete", s.DeletedFiles),
+		zap.Int("files_to_retain", s.RetainedFiles),
+		zap.Int64("deleted_size_bytes", s.DeletedSize),
+		zap.Int64("retained_size_bytes", s.RetainedSize),
+		zap.Time("oldest_retained", s.OldestRetained),
+		zap.Time("newest_retained", s.NewestRetained),
+		zap.Int("pruned_folders", s.PrunedFolders),
+		zap.Bool("dry_run", dryRun))
+}
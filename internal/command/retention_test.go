@@ -0,0 +1,90 @@
+package command
+
+import (
+	"backup-agent/internal/config"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// dailyChains returns days daily full backups taken at midnight and 23 hourly
+// incremental backups after each of them, the newest day first
+func dailyChains(now time.Time, days int) (fulls, incrementals []retentionFile) {
+	today := now.Truncate(24 * time.Hour)
+	for day := 0; day < days; day++ {
+		fullAt := today.AddDate(0, 0, -day)
+		fulls = append(fulls, retentionFile{Key: fmt.Sprintf("db/full-%d", day), CreatedAt: fullAt})
+		for hour := 1; hour < 24; hour++ {
+			incrementals = append(incrementals, retentionFile{
+				Key:       fmt.Sprintf("db-incremental/inc-%d-%d", day, hour),
+				CreatedAt: fullAt.Add(time.Duration(hour) * time.Hour),
+			})
+		}
+	}
+	return fulls, incrementals
+}
+
+func TestPlanIncrementalRetentionFollowsFullBackups(t *testing.T) {
+	now := time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC)
+	fulls, incrementals := dailyChains(now, 15)
+
+	full := planRetention("db", fulls, config.DeletionRules{MaxCount: 10}, false, now)
+	if len(full.Retain) != 10 || len(full.Delete) != 5 {
+		t.Fatalf("full backups: retained %d deleted %d, want 10 and 5", len(full.Retain), len(full.Delete))
+	}
+	oldestFull := full.Retain[len(full.Retain)-1].CreatedAt
+
+	plan := planIncrementalRetention("db-incremental", incrementals, &full, false)
+	if len(plan.Retain) != 10*23 || len(plan.Delete) != 5*23 {
+		t.Fatalf("incremental backups: retained %d deleted %d, want %d and %d", len(plan.Retain), len(plan.Delete), 10*23, 5*23)
+	}
+	for _, file := range plan.Retain {
+		if file.CreatedAt.Before(oldestFull) {
+			t.Errorf("retained incremental %s predates the oldest retained full backup", file.Key)
+		}
+	}
+	for _, file := range plan.Delete {
+		if !file.CreatedAt.Before(oldestFull) {
+			t.Errorf("deleted incremental %s builds on a retained full backup", file.Key)
+		}
+	}
+}
+
+func TestPlanIncrementalRetentionKeepsAll(t *testing.T) {
+	now := time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC)
+	fulls, incrementals := dailyChains(now, 3)
+	noneDeleted := planRetention("db", fulls, config.DeletionRules{MaxCount: 10}, false, now)
+	allDeleted := planRetention("db", fulls, config.DeletionRules{MaxAgeDays: 1}, false, now.AddDate(0, 0, 10))
+
+	tests := []struct {
+		name   string
+		full   *retentionPlan
+		exempt bool
+	}{
+		{name: "no full backups", full: nil},
+		{name: "no full backup deleted", full: &noneDeleted},
+		{name: "exempt database", full: &allDeleted, exempt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planIncrementalRetention("db-incremental", incrementals, tt.full, tt.exempt)
+			if len(plan.Delete) != 0 || len(plan.Retain) != len(incrementals) {
+				t.Errorf("retained %d deleted %d, want all %d retained", len(plan.Retain), len(plan.Delete), len(incrementals))
+			}
+		})
+	}
+}
+
+func TestPlanIncrementalRetentionDeletesWithLastFull(t *testing.T) {
+	now := time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC)
+	fulls, incrementals := dailyChains(now, 3)
+	full := planRetention("db", fulls, config.DeletionRules{MaxAgeDays: 1}, false, now.AddDate(0, 0, 10))
+	if len(full.Retain) != 0 {
+		t.Fatalf("retained %d full backups, want none", len(full.Retain))
+	}
+
+	plan := planIncrementalRetention("db-incremental", incrementals, &full, false)
+	if len(plan.Retain) != 0 || len(plan.Delete) != len(incrementals) {
+		t.Errorf("retained %d deleted %d, want all %d deleted", len(plan.Retain), len(plan.Delete), len(incrementals))
+	}
+}
@@ -0,0 +1,248 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/checksum"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Rotation states of a single backup file
+const (
+	RotateStatusRotated        = "rotated"
+	RotateStatusAlreadyRotated = "already rotated"
+	RotateStatusPending        = "would rotate"
+	RotateStatusFailed         = "failed"
+)
+
+// RotateKeyCommand re-encrypts the encrypted backups in S3 with a new key
+type RotateKeyCommand struct {
+	s3Client *s3.S3
+	oldKey   encryption.Provider
+	newKey   encryption.Provider
+	cfg      *config.Config
+	dryRun   bool
+}
+
+// RotateKeyResult holds the outcome of rotating a single backup file
+type RotateKeyResult struct {
+	Key    string
+	Size   int64
+	Status string
+	Err    error
+}
+
+// RotateKeyReport holds the results of a key rotation run
+type RotateKeyReport struct {
+	Files        []RotateKeyResult
+	RotatedCount int
+	SkippedCount int
+	FailedCount  int
+	PendingCount int
+}
+
+// NewRotateKeyCommand creates a new RotateKeyCommand instance
+func NewRotateKeyCommand(s3Client *s3.S3, oldKey, newKey encryption.Provider, cfg *config.Config) *RotateKeyCommand {
+	return &RotateKeyCommand{
+		s3Client: s3Client,
+		oldKey:   oldKey,
+		newKey:   newKey,
+		cfg:      cfg,
+	}
+}
+
+// WithDryRun only lists the backups that would be re-encrypted
+func (c *RotateKeyCommand) WithDryRun(dryRun bool) *RotateKeyCommand {
+	c.dryRun = dryRun
+	return c
+}
+
+// Execute lists the encrypted backups of every configured database and re-encrypts
+// them one by one. Every object is replaced in a single upload, so it is either
+// still encrypted with the old key or already with the new one. Failures don't
+// stop the run; files already encrypted with the new key are skipped, so running
+// the command again finishes an interrupted rotation.
+func (c *RotateKeyCommand) Execute(ctx context.Context) (*RotateKeyReport, error) {
+	log := logger.L()
+	report := &RotateKeyReport{}
+
+	// Bundled backups of all databases share a single folder
+	prefixes := make([]string, 0, len(c.cfg.DBConfigs))
+	for _, db := range c.cfg.DBConfigs {
+		prefixes = append(prefixes, c.s3Client.KeyComponent(db.Name)+"/")
+	}
+	if c.cfg.Bundle {
+		prefixes = []string{backup.BundleFolderName + "/"}
+	}
+
+	listResp := c.s3Client.ListMultiple(ctx, c.cfg.S3.Bucket, prefixes, 0)
+	if err := listResp.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	files := make([]s3.FileInfo, 0, len(listResp.Files))
+	for _, file := range listResp.Files {
+		if strings.HasSuffix(file.Key, ".enc") {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Key < files[j].Key
+	})
+
+	for i, file := range files {
+		result := RotateKeyResult{Key: file.Key, Size: file.Size}
+
+		if c.dryRun {
+			result.Status = RotateStatusPending
+			report.PendingCount++
+			log.Info("Would re-encrypt backup", zap.String("key", file.Key))
+			report.Files = append(report.Files, result)
+			continue
+		}
+
+		result.Status, result.Err = c.rotateFile(ctx, file)
+		switch result.Status {
+		case RotateStatusRotated:
+			report.RotatedCount++
+		case RotateStatusAlreadyRotated:
+			report.SkippedCount++
+		default:
+			report.FailedCount++
+			log.Error("Error re-encrypting backup, the object still uses the old key",
+				zap.String("key", file.Key),
+				zap.Error(result.Err))
+		}
+		log.Info("Key rotation progress",
+			zap.String("key", file.Key),
+			zap.String("status", result.Status),
+			zap.Int("done", i+1),
+			zap.Int("total", len(files)))
+		report.Files = append(report.Files, result)
+	}
+
+	return report, nil
+}
+
+// rotateFile streams a backup from S3 through decryption with the old key and
+// encryption with the new key into a file in the work directory, and uploads it
+// back into the same object with the SHA-256 of the new ciphertext. The plaintext
+// is never written to disk or kept in memory beyond a chunk per stage.
+func (c *RotateKeyCommand) rotateFile(ctx context.Context, file s3.FileInfo) (string, error) {
+	log := logger.L()
+	bucket := c.cfg.S3.Bucket
+
+	info, err := c.s3Client.HeadObject(ctx, bucket, file.Key)
+	if err != nil {
+		return RotateStatusFailed, err
+	}
+	tags, err := c.s3Client.ObjectTags(ctx, bucket, file.Key)
+	if err != nil {
+		return RotateStatusFailed, err
+	}
+
+	staged, err := c.stagingFile()
+	if err != nil {
+		return RotateStatusFailed, err
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	// Download -> decrypt with the old key -> encrypt with the new key -> staged file
+	downloaded, downloadWriter := io.Pipe()
+	go func() {
+		downloadWriter.CloseWithError(c.s3Client.Download(ctx, bucket, file.Key, downloadWriter))
+	}()
+	defer downloaded.Close()
+
+	decryptErr := make(chan error, 1)
+	decrypted, decryptWriter := io.Pipe()
+	plaintext := &countingWriter{w: decryptWriter}
+	go func() {
+		err := c.oldKey.DecryptStream(downloaded, plaintext)
+		decryptErr <- err
+		decryptWriter.CloseWithError(err)
+	}()
+	defer decrypted.Close()
+
+	if err := c.newKey.EncryptStream(decrypted, staged); err != nil {
+		// A wrong key fails on the first chunk, before any plaintext is written.
+		// Tell a file that was already rotated by an earlier run apart from a real failure.
+		decrypted.CloseWithError(err)
+		if derr := <-decryptErr; derr != nil && plaintext.n == 0 {
+			if c.usesNewKey(ctx, file.Key) {
+				log.Info("Backup is already encrypted with the new key", zap.String("key", file.Key))
+				return RotateStatusAlreadyRotated, nil
+			}
+			return RotateStatusFailed, fmt.Errorf("decryption with the old key failed: %v", derr)
+		}
+		return RotateStatusFailed, fmt.Errorf("error re-encrypting backup: %v", err)
+	}
+
+	// The stored SHA-256 describes the old ciphertext and is replaced, the backup time and tags are kept
+	sum, _, err := checksum.SHA256File(staged.Name())
+	if err != nil {
+		return RotateStatusFailed, err
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return RotateStatusFailed, fmt.Errorf("error rewinding %s: %v", staged.Name(), err)
+	}
+	err = c.s3Client.UploadObject(ctx, bucket, file.Key, s3.UploadRequest{
+		Content:    staged,
+		Checksum:   sum,
+		BackupTime: info.BackupTime,
+		Tags:       tags,
+	})
+	if err != nil {
+		return RotateStatusFailed, err
+	}
+	return RotateStatusRotated, nil
+}
+
+// stagingFile creates the file a re-encrypted backup is written to before its
+// upload, in the work directory if one is configured
+func (c *RotateKeyCommand) stagingFile() (*os.File, error) {
+	if c.cfg.WorkDir != "" {
+		if err := os.MkdirAll(c.cfg.WorkDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create work directory: %v", err)
+		}
+	}
+	file, err := os.CreateTemp(c.cfg.WorkDir, "rotate-*.enc")
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging file: %v", err)
+	}
+	return file, nil
+}
+
+// usesNewKey reports whether the object can be decrypted with the new key
+func (c *RotateKeyCommand) usesNewKey(ctx context.Context, key string) bool {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.s3Client.Download(ctx, c.cfg.S3.Bucket, key, pw))
+	}()
+	defer pr.Close()
+
+	return c.newKey.DecryptStream(pr, io.Discard) == nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SelectCommand picks the newest backup of a database taken at or before a point in time
+type SelectCommand struct {
+	s3Client *s3.S3
+	cfg      *config.Config
+	database string
+	before   time.Time
+}
+
+// SelectedBackup is the backup chosen by a SelectCommand
+type SelectedBackup struct {
+	Key string
+	// BackupTime is the recorded backup time, or the upload time for backups without one
+	BackupTime time.Time
+}
+
+// NewSelectCommand creates a new SelectCommand for the backups of database
+func NewSelectCommand(s3Client *s3.S3, cfg *config.Config, database string) *SelectCommand {
+	return &SelectCommand{
+		s3Client: s3Client,
+		cfg:      cfg,
+		database: database,
+		before:   time.Now(),
+	}
+}
+
+// WithBefore sets the point in time the backup must not be newer than
+func (c *SelectCommand) WithBefore(before time.Time) *SelectCommand {
+	c.before = before
+	return c
+}
+
+// Execute lists the database folder and the bundle folder and returns the newest backup
+// taken at or before the cutoff, which may be a bundle holding the backup of every
+// database. Bundles are looked at whether or not bundle is enabled, since it may have
+// been toggled since they were taken. Backups are dated by the backup-time metadata recorded at upload, falling back to
+// LastModified for older uploads. An upload always happens after the backup was taken, so
+// objects uploaded before the best match so far can't beat it and aren't looked at.
+func (c *SelectCommand) Execute(ctx context.Context) (*SelectedBackup, error) {
+	log := logger.L().With(
+		zap.String("database", c.database),
+		zap.Time("before", c.before))
+
+	prefixes := []string{c.s3Client.KeyComponent(c.database) + "/", backup.BundleFolderName + "/"}
+	listResp := c.s3Client.ListMultiple(ctx, c.cfg.S3.Bucket, prefixes, 0)
+	if err := listResp.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list backups of %s: %w", c.database, err)
+	}
+
+	files := listResp.Files
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	var selected *SelectedBackup
+	for _, file := range files {
+		if strings.HasSuffix(file.Key, "/") {
+			continue
+		}
+		if selected != nil && !file.CreatedAt.After(selected.BackupTime) {
+			break
+		}
+
+		info, err := c.s3Client.HeadObject(ctx, c.cfg.S3.Bucket, file.Key)
+		if err != nil {
+			return nil, err
+		}
+		backupTime := info.BackupTime
+		if backupTime.IsZero() {
+			backupTime = file.CreatedAt
+		}
+
+		if backupTime.After(c.before) {
+			continue
+		}
+		if selected == nil || backupTime.After(selected.BackupTime) {
+			selected = &SelectedBackup{Key: file.Key, BackupTime: backupTime}
+		}
+	}
+
+	if selected == nil {
+		return nil, fmt.Errorf("no backup of %s was taken at or before %s", c.database, c.before.Format(time.RFC3339))
+	}
+
+	log.Info("Selected backup",
+		zap.String("key", selected.Key),
+		zap.Time("backup_time", selected.BackupTime))
+	return selected, nil
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSelectFindsBundledBackups(t *testing.T) {
+	// Newest first: a bundle taken after bundle was enabled, then backups of shop
+	// from before, and an older bundle
+	client := listingServer(t, []string{
+		"bundle/backup-2024-06-30.tar.gz.enc",
+		"shop/shop_2024-06-29.sql.enc",
+		"crm/crm_2024-06-29.sql.enc",
+		"bundle/backup-2024-06-27.tar.gz.enc",
+	})
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		database string
+		bundle   bool
+		before   time.Time
+		want     string
+	}{
+		{name: "bundle enabled", database: "shop", bundle: true, before: day(30), want: "bundle/backup-2024-06-30.tar.gz.enc"},
+		{name: "bundle disabled", database: "shop", before: day(30), want: "bundle/backup-2024-06-30.tar.gz.enc"},
+		{name: "own folder", database: "shop", bundle: true, before: day(29), want: "shop/shop_2024-06-29.sql.enc"},
+		{name: "older bundle", database: "shop", before: day(28), want: "bundle/backup-2024-06-27.tar.gz.enc"},
+		{name: "bundles only", database: backup.BundleFolderName, before: day(29), want: "bundle/backup-2024-06-27.tar.gz.enc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{S3: s3.Config{Bucket: "backups"}, Bundle: tt.bundle}
+			selected, err := NewSelectCommand(client, cfg, tt.database).WithBefore(tt.before).Execute(context.Background())
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if selected.Key != tt.want {
+				t.Errorf("selected %s, want %s", selected.Key, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package command
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/config"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// VerifyCommand downloads backups from S3 and checks that they are intact
+type VerifyCommand struct {
+	s3Client   *s3.S3
+	encryptor  encryption.Provider
+	cfg        *config.Config
+	latestOnly bool
+}
+
+// VerifyResult holds the outcome of verifying a single backup file
+type VerifyResult struct {
+	Key  string
+	Size int64
+	// ChecksumChecked is set when the object carried a SHA-256 in its metadata
+	ChecksumChecked bool
+	// Decrypted is set when the file was encrypted and decrypted successfully
+	Decrypted bool
+	Err       error
+}
+
+// VerifyReport holds the results of a verification run
+type VerifyReport struct {
+	Files       []VerifyResult
+	FailedCount int
+}
+
+// NewVerifyCommand creates a new VerifyCommand instance
+func NewVerifyCommand(s3Client *s3.S3, encryptor encryption.Provider, cfg *config.Config) *VerifyCommand {
+	return &VerifyCommand{
+		s3Client:  s3Client,
+		encryptor: encryptor,
+		cfg:       cfg,
+	}
+}
+
+// WithLatestOnly limits verification to the newest backup of every folder
+func (c *VerifyCommand) WithLatestOnly(latestOnly bool) *VerifyCommand {
+	c.latestOnly = latestOnly
+	return c
+}
+
+// Execute lists the backups of every configured database and verifies them one by one
+func (c *VerifyCommand) Execute(ctx context.Context) (*VerifyReport, error) {
+	log := logger.L()
+	report := &VerifyReport{}
+
+	// Bundled backups of all databases share a single folder
+	prefixes := make([]string, 0, len(c.cfg.DBConfigs))
+	for _, db := range c.cfg.DBConfigs {
+		prefixes = append(prefixes, c.s3Client.KeyComponent(db.Name)+"/")
+	}
+	if c.cfg.Bundle {
+		prefixes = []string{backup.BundleFolderName + "/"}
+	}
+
+	listResp := c.s3Client.ListMultiple(ctx, c.cfg.S3.Bucket, prefixes, 0)
+	if err := listResp.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	for _, prefix := range prefixes {
+		files := listResp.Prefixes[prefix].Files
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].CreatedAt.After(files[j].CreatedAt)
+		})
+
+		for _, file := range files {
+			// Skip folder markers
+			if strings.HasSuffix(file.Key, "/") {
+				continue
+			}
+
+			result := c.verifyFile(ctx, file)
+			if result.Err != nil {
+				report.FailedCount++
+				log.Error("Backup verification failed",
+					zap.String("key", file.Key),
+					zap.Error(result.Err))
+			} else {
+				log.Info("Backup verified", zap.String("key", file.Key))
+			}
+			report.Files = append(report.Files, result)
+
+			if c.latestOnly {
+				break
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// verifyFile streams a backup from S3, hashing it and decrypting it on the fly when it is encrypted
+func (c *VerifyCommand) verifyFile(ctx context.Context, file s3.FileInfo) VerifyResult {
+	result := VerifyResult{Key: file.Key, Size: file.Size}
+
+	info, err := c.s3Client.HeadObject(ctx, c.cfg.S3.Bucket, file.Key)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.s3Client.Download(ctx, c.cfg.S3.Bucket, file.Key, pw))
+	}()
+	defer pr.Close()
+
+	// Hash everything that is read, whether it goes through decryption or not
+	hash := sha256.New()
+	hashed := io.TeeReader(pr, hash)
+	if strings.HasSuffix(file.Key, ".enc") {
+		if err := c.encryptor.DecryptStream(hashed, io.Discard); err != nil {
+			result.Err = fmt.Errorf("decryption failed: %w", err)
+			return result
+		}
+		result.Decrypted = true
+	}
+	// Read whatever decryption left over so the checksum covers the whole object
+	if _, err := io.Copy(io.Discard, hashed); err != nil {
+		result.Err = fmt.Errorf("download failed: %v", err)
+		return result
+	}
+
+	if info.Checksum != "" {
+		result.ChecksumChecked = true
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != info.Checksum {
+			result.Err = fmt.Errorf("checksum mismatch: expected %s, got %s", info.Checksum, sum)
+		}
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"fmt"
+)
+
+// DefaultDestinationName is the name of the destination configured by the s3 block
+const DefaultDestinationName = "default"
+
+// Destination is an S3 bucket the backups are uploaded to
+type Destination struct {
+	Name string `koanf:"name"`
+	// Required aborts the backup when the upload to this destination fails,
+	// failures of optional destinations are only reported (default true)
+	Required  *bool `koanf:"required"`
+	s3.Config `koanf:",squash"`
+}
+
+// IsRequired reports whether a failed upload to the destination aborts the backup
+func (d Destination) IsRequired() bool {
+	return d.Required == nil || *d.Required
+}
+
+// UploadDestinations returns the destinations backups are uploaded to, the s3
+// block when no destinations are configured
+func (c *Config) UploadDestinations() []Destination {
+	if len(c.Destinations) == 0 {
+		return []Destination{{Name: DefaultDestinationName, Config: c.S3}}
+	}
+	return c.Destinations
+}
+
+// UseDestination makes the named destination the S3 configuration read by the
+// commands that work on a single bucket
+func (c *Config) UseDestination(name string) error {
+	for _, dest := range c.UploadDestinations() {
+		if dest.Name == name {
+			c.S3 = dest.Config
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown destination %q", name)
+}
+
+// validateDestinations checks the S3 settings of every destination, or of the s3
+// block without destinations, and the destination names, and makes the first
+// destination the S3 configuration of the single-bucket commands
+func (c *Config) validateDestinations() error {
+	if len(c.Destinations) == 0 {
+		if err := c.S3.Validate(); err != nil {
+			return fmt.Errorf("invalid s3 configuration: %v", err)
+		}
+		return nil
+	}
+	if c.S3.Bucket != "" {
+		return fmt.Errorf("s3 and destinations can't both be set, move the s3 block into destinations")
+	}
+
+	names := make(map[string]bool, len(c.Destinations))
+	for _, dest := range c.Destinations {
+		if dest.Name == "" {
+			return fmt.Errorf("every destination needs a name")
+		}
+		if names[dest.Name] {
+			return fmt.Errorf("duplicate destination name %q", dest.Name)
+		}
+		names[dest.Name] = true
+		if dest.Bucket == "" {
+			return fmt.Errorf("destination %s has no bucket", dest.Name)
+		}
+		if err := dest.Config.Validate(); err != nil {
+			return fmt.Errorf("invalid destination %s: %v", dest.Name, err)
+		}
+	}
+
+	c.S3 = c.Destinations[0].Config
+	return nil
+}
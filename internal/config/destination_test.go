@@ -0,0 +1,68 @@
+package config
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"strings"
+	"testing"
+)
+
+func TestUploadDestinationsKeepRegion(t *testing.T) {
+	cfg := Config{S3: s3.Config{Bucket: "backups", Region: "eu-central-1"}}
+	dests := cfg.UploadDestinations()
+	if len(dests) != 1 || dests[0].Region != "eu-central-1" {
+		t.Fatalf("UploadDestinations() = %+v, want the s3 block with region eu-central-1", dests)
+	}
+
+	cfg = Config{Destinations: []Destination{
+		{Name: "primary", Config: s3.Config{Bucket: "backups", Region: "eu-central-1"}},
+		{Name: "offsite", Config: s3.Config{Bucket: "offsite", Region: "us-west-2"}},
+	}}
+	if err := cfg.UseDestination("offsite"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.S3.Region != "us-west-2" {
+		t.Errorf("region after UseDestination() = %q, want us-west-2", cfg.S3.Region)
+	}
+}
+
+func TestValidateDestinationSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsite s3.Config
+		wantErr string
+	}{
+		{name: "valid", offsite: s3.Config{Bucket: "offsite", Endpoint: "https://s3.example.com", AccessKey: "a", SecretKey: "s"}},
+		{name: "endpoint without scheme", offsite: s3.Config{Bucket: "offsite", Endpoint: "minio.internal:9000"}},
+		{name: "half credentials", offsite: s3.Config{Bucket: "offsite", AccessKey: "a"},
+			wantErr: "invalid destination offsite: access_key and secret_key must be set together"},
+		{name: "endpoint", offsite: s3.Config{Bucket: "offsite", Endpoint: "ftp://files.example.com"},
+			wantErr: `invalid destination offsite: invalid endpoint "ftp://files.example.com"`},
+		{name: "server-side encryption", offsite: s3.Config{Bucket: "offsite", ServerSideEncryption: "rot13"},
+			wantErr: `invalid destination offsite: invalid server_side_encryption "rot13"`},
+		{name: "kms key without kms", offsite: s3.Config{Bucket: "offsite", KMSKeyID: "alias/backups"},
+			wantErr: "invalid destination offsite: kms_key_id requires server_side_encryption"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Destinations: []Destination{
+				{Name: "primary", Config: s3.Config{Bucket: "backups"}},
+				{Name: "offsite", Config: tt.offsite},
+			}}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg := Config{S3: s3.Config{Bucket: "backups", SecretKey: "s"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid s3 configuration") {
+		t.Errorf("Validate() error = %v, want the s3 block rejected", err)
+	}
+}
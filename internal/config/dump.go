@@ -0,0 +1,104 @@
+package config
+
+import (
+	"backup-agent/internal/backup"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redactedValue = "****"
+
+// Redacted returns a copy of the configuration with its secrets masked
+func (c Config) Redacted() Config {
+	c.S3.AccessKey = redact(c.S3.AccessKey)
+	c.S3.SecretKey = redact(c.S3.SecretKey)
+
+	destinations := make([]Destination, len(c.Destinations))
+	for i, destination := range c.Destinations {
+		destination.AccessKey = redact(destination.AccessKey)
+		destination.SecretKey = redact(destination.SecretKey)
+		destinations[i] = destination
+	}
+	c.Destinations = destinations
+
+	if c.Encryption != nil {
+		encryption := *c.Encryption
+		encryption.Key = redact(encryption.Key)
+		encryption.Passphrase = redact(encryption.Passphrase)
+		c.Encryption = &encryption
+	}
+
+	// Webhook URLs embed their credentials
+	c.Notifications.Webhook.URL = redact(c.Notifications.Webhook.URL)
+	c.Notifications.SMTP.Password = redact(c.Notifications.SMTP.Password)
+
+	dbConfigs := make([]backup.Config, len(c.DBConfigs))
+	for i, db := range c.DBConfigs {
+		db.Password = redact(db.Password)
+		dbConfigs[i] = db
+	}
+	c.DBConfigs = dbConfigs
+
+	return c
+}
+
+// redact masks a secret, empty values stay empty so unset secrets remain visible
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// Map returns the configuration as nested maps keyed by the koanf field names,
+// ready to be marshalled back to YAML or JSON
+func (c Config) Map() map[string]interface{} {
+	return toMap(reflect.ValueOf(c)).(map[string]interface{})
+}
+
+// toMap converts structs to maps keyed by their koanf tags, recursing into pointers
+// and slices. Squashed structs are merged into their parent like koanf reads them.
+func toMap(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toMap(v.Elem())
+
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("koanf"), ",")
+			if field.IsExported() && name == "" && opts == "squash" {
+				if squashed, ok := toMap(v.Field(i)).(map[string]interface{}); ok {
+					for key, value := range squashed {
+						m[key] = value
+					}
+				}
+				continue
+			}
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			m[name] = toMap(v.Field(i))
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = toMap(v.Index(i))
+		}
+		return items
+
+	default:
+		if d, ok := v.Interface().(time.Duration); ok {
+			return d.String()
+		}
+		return v.Interface()
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"backup-agent/internal/adapter/s3"
+	"backup-agent/internal/backup"
+	"backup-agent/internal/pkg/encryption"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	secrets := []string{
+		"s3-access-key", "s3-secret-key",
+		"offsite-access-key", "offsite-secret-key",
+		"encryption-key", "encryption-passphrase",
+		"https://hooks.example.com/secret-token",
+		"smtp-password",
+		"db-password",
+	}
+
+	cfg := Config{
+		S3: s3.Config{Bucket: "backups", AccessKey: "s3-access-key", SecretKey: "s3-secret-key"},
+		Destinations: []Destination{{
+			Name:   "offsite",
+			Config: s3.Config{Bucket: "offsite", AccessKey: "offsite-access-key", SecretKey: "offsite-secret-key"},
+		}},
+		Encryption: &encryption.Config{Enabled: true, Key: "encryption-key", Passphrase: "encryption-passphrase"},
+		DBConfigs:  []backup.Config{{Name: "shop", Password: "db-password"}},
+	}
+	cfg.Notifications.Webhook.URL = "https://hooks.example.com/secret-token"
+	cfg.Notifications.SMTP.Password = "smtp-password"
+
+	out, err := json.Marshal(cfg.Redacted().Map())
+	if err != nil {
+		t.Fatalf("error encoding configuration: %v", err)
+	}
+	dump := string(out)
+	for _, secret := range secrets {
+		if strings.Contains(dump, secret) {
+			t.Errorf("dump contains secret %q", secret)
+		}
+	}
+	for _, name := range []string{`"bucket":"offsite"`, `"access_key":"****"`} {
+		if !strings.Contains(dump, name) {
+			t.Errorf("dump is missing %s", name)
+		}
+	}
+
+	// The configuration itself keeps its secrets
+	if cfg.Destinations[0].SecretKey != "offsite-secret-key" || cfg.DBConfigs[0].Password != "db-password" {
+		t.Errorf("Redacted modified the original configuration")
+	}
+}
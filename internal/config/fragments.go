@@ -0,0 +1,53 @@
+package config
+
+import (
+	"backup-agent/internal/backup"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// loadDBConfigFragments appends a database configuration for every *.yaml file in
+// dir to the inline db_configs. Names must be unique across the config file and all fragments.
+func loadDBConfigFragments(dbConfigs []backup.Config, dir string) ([]backup.Config, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing db_configs_dir: %v", err)
+	}
+	sort.Strings(paths)
+
+	sources := make(map[string]string, len(dbConfigs)+len(paths))
+	for _, db := range dbConfigs {
+		if _, ok := sources[db.Name]; ok {
+			return nil, fmt.Errorf("duplicate database name %s in db_configs", db.Name)
+		}
+		sources[db.Name] = "db_configs"
+	}
+
+	for _, path := range paths {
+		fk := koanf.New(".")
+		if err := fk.Load(file.Provider(path), yaml.Parser()); err != nil {
+			return nil, fmt.Errorf("error loading database config %s: %v", path, err)
+		}
+
+		var db backup.Config
+		if err := fk.Unmarshal("", &db); err != nil {
+			return nil, fmt.Errorf("error unmarshalling database config %s: %v", path, err)
+		}
+		if db.Name == "" {
+			return nil, fmt.Errorf("database config %s has no name", path)
+		}
+		if source, ok := sources[db.Name]; ok {
+			return nil, fmt.Errorf("duplicate database name %s in %s, already defined in %s", db.Name, path, source)
+		}
+		sources[db.Name] = path
+
+		dbConfigs = append(dbConfigs, db)
+	}
+
+	return dbConfigs, nil
+}
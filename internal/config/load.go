@@ -1,8 +1,14 @@
 package config
 
 import (
+	"backup-agent/internal/pkg/encryption"
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/paths"
+	"backup-agent/internal/pkg/stream"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/knadh/koanf/parsers/yaml"
@@ -14,18 +20,26 @@ import (
 // Koanf instance
 var k = koanf.New(".")
 
-// Load configuration using Koanf
-func Load(filepath string) (*Config, error) {
-	if filepath == "" {
-		filepath = "config.yaml"
+// Load configuration using Koanf. The files are merged in order, later files
+// overriding the keys of earlier ones, and a directory stands for its *.yaml
+// files in lexical order. Environment variables override all files.
+func Load(configPaths ...string) (*Config, error) {
+	if len(configPaths) == 0 {
+		configPaths = []string{"config.yaml"}
 		logger.L().Info("using default configuration config.yml")
 	}
 
-	if err := k.Load(file.Provider(filepath), yaml.Parser()); err != nil {
-		return nil, fmt.Errorf("error loading config from file: %v", err)
+	files, err := configFiles(configPaths)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if err := k.Load(file.Provider(path), yaml.Parser()); err != nil {
+			return nil, fmt.Errorf("error loading config from file %s: %v", path, err)
+		}
 	}
 
-	if err := 	k.Load(env.Provider("BACKUP_", ".", func(s string) string {
+	if err := k.Load(env.Provider("BACKUP_", ".", func(s string) string {
 		return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(s, "BACKUP_")), "_", ".")
 	}), nil); err != nil {
 		return nil, fmt.Errorf("error loading config from env: %v", err)
@@ -36,5 +50,73 @@ func Load(filepath string) (*Config, error) {
 		return nil, fmt.Errorf("error unmarshalling config: %v", err)
 	}
 
+	if cfg.DBConfigsDir != "" {
+		if err := paths.ResolveAll(&cfg.DBConfigsDir); err != nil {
+			return nil, fmt.Errorf("invalid db_configs_dir: %v", err)
+		}
+		dbConfigs, err := loadDBConfigFragments(cfg.DBConfigs, cfg.DBConfigsDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DBConfigs = dbConfigs
+	}
+
+	if err := cfg.resolvePaths(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	stream.SetBufferSize(cfg.StreamBufferSize)
+	encryption.SetWorkDir(cfg.WorkDir)
+
 	return &cfg, nil
 }
+
+// resolvePaths expands "~" and environment variables in the paths of local
+// files. Paths that may point into a container, such as db_path, are kept.
+func (c *Config) resolvePaths() error {
+	if err := paths.ResolveAll(&c.LogFile, &c.WorkDir, &c.CatalogPath, &c.Metrics.TextfilePath); err != nil {
+		return err
+	}
+	if c.Encryption != nil {
+		if err := paths.ResolveAll(&c.Encryption.KeyFile, &c.Encryption.IdentityFile); err != nil {
+			return err
+		}
+	}
+	for i := range c.DBConfigs {
+		db := &c.DBConfigs[i]
+		if err := paths.ResolveAll(&db.Directory, &db.TokenFile); err != nil {
+			return fmt.Errorf("db_configs entry %s: %v", db.Name, err)
+		}
+	}
+	return nil
+}
+
+// configFiles expands the directories among configPaths into their *.yaml files
+func configFiles(configPaths []string) ([]string, error) {
+	var files []string
+	for _, path := range configPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading config from file: %v", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing config directory %s: %v", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("config directory %s contains no *.yaml files", path)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -5,6 +5,23 @@ import (
 	"backup-agent/internal/backup"
 	"backup-agent/internal/pkg/encryption"
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/metrics"
+	"backup-agent/internal/pkg/notify"
+	"backup-agent/internal/pkg/tracing"
+	"time"
+)
+
+// defaultDumpRetryDelay is the pause between dump attempts unless dump_retry_delay is set
+const defaultDumpRetryDelay = 10 * time.Second
+
+// defaultExpectedInterval is how often databases are expected to be backed up unless expected_interval is set
+const defaultExpectedInterval = 24 * time.Hour
+
+const (
+	// UnreachableAbort aborts the backup run before dumping when S3 is unreachable
+	UnreachableAbort = "abort"
+	// UnreachableLocal proceeds with a local-only backup when S3 is unreachable
+	UnreachableLocal = "local"
 )
 
 // DeletionRules defines rules for automatic backup deletion
@@ -13,18 +30,112 @@ type DeletionRules struct {
 	MaxAgeDays int `koanf:"max_age_days"`
 	// MaxCount defines the maximum number of backups to keep
 	MaxCount int `koanf:"max_count"`
+	// MaxTotalSizeBytes defines the storage budget of each database folder,
+	// the oldest backups are deleted until the retained total fits
+	MaxTotalSizeBytes int64 `koanf:"max_total_size_bytes"`
 	// Enabled determines if automatic deletion is enabled
 	Enabled bool `koanf:"enabled"`
 }
 
+// Override returns the rules with the fields set in the database's overrides replaced
+func (r DeletionRules) Override(overrides *backup.DeletionRules) DeletionRules {
+	if overrides == nil {
+		return r
+	}
+	if overrides.MaxAgeDays != nil {
+		r.MaxAgeDays = *overrides.MaxAgeDays
+	}
+	if overrides.MaxCount != nil {
+		r.MaxCount = *overrides.MaxCount
+	}
+	if overrides.MaxTotalSizeBytes != nil {
+		r.MaxTotalSizeBytes = *overrides.MaxTotalSizeBytes
+	}
+	return r
+}
+
 // Config represents the application configuration
 type Config struct {
 	LogLevel logger.LogLevel `koanf:"log_level"`
-	Upload   struct {
+	// LogFormat is "console" (default) or "json"
+	LogFormat logger.Format `koanf:"log_format"`
+	// LogFile additionally writes the logs to this path, rotated once it
+	// reaches LogMaxSizeMB megabytes
+	LogFile       string `koanf:"log_file"`
+	LogMaxSizeMB  int    `koanf:"log_max_size_mb"`
+	LogMaxBackups int    `koanf:"log_max_backups"`
+	LogMaxAgeDays int    `koanf:"log_max_age_days"`
+	Upload        struct {
 		Enabled bool `koanf:"enabled"`
+		// OnUnreachable defines what to do when the bucket can't be reached
+		// before dumping: "abort" (default) or "local"
+		OnUnreachable string `koanf:"on_unreachable"`
+		// PipelineDepth enables uploading each backup while the next one is
+		// dumped and encrypted, with at most this many backups waiting for upload
+		PipelineDepth int `koanf:"pipeline_depth"`
+		// AbortIncompleteAfter aborts multipart uploads left incomplete for longer
+		// than this, e.g. by killed runs, at the start of every backup run (0 disables)
+		AbortIncompleteAfter time.Duration `koanf:"abort_incomplete_after"`
 	} `koanf:"upload"`
-	S3         s3.Config          `koanf:"s3"`
-	Encryption *encryption.Config `koanf:"encryption"`
-	DBConfigs  []backup.Config    `koanf:"db_configs"`
-	DeletionRules DeletionRules    `koanf:"deletion_rules"`
+	S3            s3.Config          `koanf:"s3"`
+	Encryption    *encryption.Config `koanf:"encryption"`
+	DBConfigs     []backup.Config    `koanf:"db_configs"`
+	DeletionRules DeletionRules      `koanf:"deletion_rules"`
+	// Destinations replicate every backup to several buckets instead of the
+	// single s3 bucket, the first one is read by list, restore and the like
+	Destinations []Destination `koanf:"destinations"`
+	// Schedule is the cron expression the serve command runs backups on
+	Schedule string `koanf:"schedule"`
+	// DeleteSchedule is the cron expression the serve command applies the
+	// deletion rules on, empty disables scheduled deletion
+	DeleteSchedule string `koanf:"delete_schedule"`
+	// IncrementalSchedule is the cron expression the serve command runs
+	// incremental backups on, empty disables them
+	IncrementalSchedule string `koanf:"incremental_schedule"`
+	// DBConfigsDir is a directory of *.yaml files, each holding one additional db_configs entry
+	DBConfigsDir string `koanf:"db_configs_dir"`
+	// Bundle tars all database dumps of a run into a single archive before upload
+	Bundle bool `koanf:"bundle"`
+	// StreamBufferSize is the buffer size in bytes for streaming read/write loops
+	StreamBufferSize int `koanf:"stream_buffer_size"`
+	// WorkDir holds intermediate files (bundle staging, encryption and restore temporaries)
+	WorkDir string `koanf:"work_dir"`
+	// ProtectedDatabases lists database names (glob patterns allowed) that the
+	// restore command refuses to overwrite without --force-protected
+	ProtectedDatabases []string `koanf:"protected_databases"`
+	// CatalogPath is the local file that keeps state between runs, such as the
+	// change detection signals (default /var/lib/go-backup/catalog.json)
+	CatalogPath string `koanf:"catalog_path"`
+	// Tracing exports OpenTelemetry spans of backup runs over OTLP/HTTP
+	Tracing tracing.Config `koanf:"tracing"`
+	// Metrics serves Prometheus metrics of backup runs
+	Metrics metrics.Config `koanf:"metrics"`
+	// Notifications reports the outcome of backup and delete runs
+	Notifications notify.Config `koanf:"notifications"`
+	// Binaries overrides the paths of the database client binaries
+	Binaries backup.Binaries `koanf:"binaries"`
+	// Naming controls the backup file names and their timestamp format
+	Naming backup.Naming `koanf:"naming"`
+	// DumpTimeout kills dump commands running longer (default none), the
+	// timeout of a database overrides it
+	DumpTimeout time.Duration `koanf:"dump_timeout"`
+	// DumpRetries is how often a failed dump command is retried
+	DumpRetries int `koanf:"dump_retries"`
+	// DumpRetryDelay is the pause between dump attempts (default 10s)
+	DumpRetryDelay time.Duration `koanf:"dump_retry_delay"`
+	// ContinueOnError backs up and uploads the remaining databases after a
+	// failed backup, the run still fails listing the failed databases
+	ContinueOnError bool `koanf:"continue_on_error"`
+	// ExpectedInterval is how often every database is expected to be backed up,
+	// status flags databases whose newest backup is older (default 24h). The
+	// expected_interval of a database overrides it.
+	ExpectedInterval time.Duration `koanf:"expected_interval"`
+}
+
+// ExpectedIntervalOf returns how often the database is expected to be backed up
+func (c *Config) ExpectedIntervalOf(db backup.Config) time.Duration {
+	if db.ExpectedInterval > 0 {
+		return db.ExpectedInterval
+	}
+	return c.ExpectedInterval
 }
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"backup-agent/internal/catalog"
+	"backup-agent/internal/pkg/encryption"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/stream"
+	"fmt"
+	"path"
+
+	"github.com/robfig/cron/v3"
+)
+
+// IsProtected reports whether the database matches one of the protected_databases patterns
+func (c *Config) IsProtected(name string) bool {
+	for _, pattern := range c.ProtectedDatabases {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Logger returns the configuration of the global logger
+func (c *Config) Logger() logger.Config {
+	return logger.Config{
+		Level:      c.LogLevel,
+		Format:     c.LogFormat,
+		File:       c.LogFile,
+		MaxSizeMB:  c.LogMaxSizeMB,
+		MaxBackups: c.LogMaxBackups,
+		MaxAgeDays: c.LogMaxAgeDays,
+	}
+}
+
+// Validate checks the configuration for invalid values and fills in defaults
+func (c *Config) Validate() error {
+	if c.Encryption == nil {
+		c.Encryption = &encryption.Config{}
+	}
+
+	switch c.LogFormat {
+	case "":
+		c.LogFormat = logger.ConsoleFormat
+	case logger.ConsoleFormat, logger.JSONFormat:
+	default:
+		return fmt.Errorf("invalid log_format %q: must be %q or %q",
+			c.LogFormat, logger.ConsoleFormat, logger.JSONFormat)
+	}
+
+	if c.LogMaxSizeMB < 0 || c.LogMaxBackups < 0 || c.LogMaxAgeDays < 0 {
+		return fmt.Errorf("log_max_size_mb, log_max_backups and log_max_age_days must not be negative")
+	}
+
+	switch c.Upload.OnUnreachable {
+	case "":
+		c.Upload.OnUnreachable = UnreachableAbort
+	case UnreachableAbort, UnreachableLocal:
+	default:
+		return fmt.Errorf("invalid upload.on_unreachable %q: must be %q or %q",
+			c.Upload.OnUnreachable, UnreachableAbort, UnreachableLocal)
+	}
+
+	if err := c.validateDestinations(); err != nil {
+		return err
+	}
+
+	for _, db := range c.DBConfigs {
+		if err := db.Validate(); err != nil {
+			return fmt.Errorf("invalid db_configs entry %s: %v", db.Name, err)
+		}
+		// A bundle holds every database of a run, a database of its own schedule would be missing
+		if db.Schedule != "" && c.Bundle {
+			return fmt.Errorf("invalid db_configs entry %s: schedule can't be combined with bundle", db.Name)
+		}
+	}
+
+	if c.Upload.PipelineDepth < 0 {
+		return fmt.Errorf("invalid upload.pipeline_depth %d: must not be negative", c.Upload.PipelineDepth)
+	}
+	if c.Upload.AbortIncompleteAfter < 0 {
+		return fmt.Errorf("invalid upload.abort_incomplete_after %s: must not be negative", c.Upload.AbortIncompleteAfter)
+	}
+
+	if c.DumpTimeout < 0 {
+		return fmt.Errorf("invalid dump_timeout %s: must not be negative", c.DumpTimeout)
+	}
+	if c.DumpRetries < 0 {
+		return fmt.Errorf("invalid dump_retries %d: must not be negative", c.DumpRetries)
+	}
+	if c.DumpRetryDelay < 0 {
+		return fmt.Errorf("invalid dump_retry_delay %s: must not be negative", c.DumpRetryDelay)
+	}
+	if c.DumpRetryDelay == 0 {
+		c.DumpRetryDelay = defaultDumpRetryDelay
+	}
+	if c.ExpectedInterval < 0 {
+		return fmt.Errorf("invalid expected_interval %s: must not be negative", c.ExpectedInterval)
+	}
+	if c.ExpectedInterval == 0 {
+		c.ExpectedInterval = defaultExpectedInterval
+	}
+
+	if c.Schedule != "" {
+		if _, err := cron.ParseStandard(c.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q: %v", c.Schedule, err)
+		}
+	}
+	if c.DeleteSchedule != "" {
+		if _, err := cron.ParseStandard(c.DeleteSchedule); err != nil {
+			return fmt.Errorf("invalid delete_schedule %q: %v", c.DeleteSchedule, err)
+		}
+	}
+	if c.IncrementalSchedule != "" {
+		if _, err := cron.ParseStandard(c.IncrementalSchedule); err != nil {
+			return fmt.Errorf("invalid incremental_schedule %q: %v", c.IncrementalSchedule, err)
+		}
+	}
+
+	if c.DeletionRules.MaxTotalSizeBytes < 0 {
+		return fmt.Errorf("invalid deletion_rules.max_total_size_bytes %d: must not be negative", c.DeletionRules.MaxTotalSizeBytes)
+	}
+
+	for _, pattern := range c.ProtectedDatabases {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid protected_databases pattern %q: %v", pattern, err)
+		}
+	}
+
+	if err := c.Naming.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Notifications.Validate(); err != nil {
+		return err
+	}
+
+	if c.CatalogPath == "" {
+		c.CatalogPath = catalog.DefaultPath
+	}
+
+	if c.StreamBufferSize == 0 {
+		c.StreamBufferSize = stream.DefaultBufferSize
+	}
+	if c.StreamBufferSize < stream.MinBufferSize || c.StreamBufferSize > stream.MaxBufferSize {
+		return fmt.Errorf("invalid stream_buffer_size %d: must be between %d and %d bytes",
+			c.StreamBufferSize, stream.MinBufferSize, stream.MaxBufferSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"backup-agent/internal/pkg/stream"
+	"testing"
+)
+
+func TestValidateStreamBufferSize(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{size: 0},
+		{size: stream.MinBufferSize},
+		{size: stream.MaxBufferSize},
+		{size: stream.MinBufferSize - 1, wantErr: true},
+		{size: stream.MaxBufferSize + 1, wantErr: true},
+		{size: 128 * 1024 * 1024, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{StreamBufferSize: tt.size}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate() with stream_buffer_size %d error = %v, want error %v", tt.size, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package checksum
+
+import (
+	"backup-agent/internal/pkg/stream"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SHA256 returns the hex encoded SHA-256 of everything read from r and the number of bytes read
+func SHA256(r io.Reader) (string, int64, error) {
+	hash := sha256.New()
+	n, err := stream.Copy(hash, r)
+	if err != nil {
+		return "", n, fmt.Errorf("error computing checksum: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// SHA256File returns the hex encoded SHA-256 and the size of the file at path
+func SHA256File(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer file.Close()
+
+	return SHA256(file)
+}
@@ -0,0 +1,109 @@
+package encryption
+
+import (
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/stream"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"go.uber.org/zap"
+)
+
+// AgeEncryptor encrypts backups to age public keys, so only the holders of
+// the matching identities can decrypt them
+type AgeEncryptor struct {
+	config     *Config
+	recipients []age.Recipient
+	log        *zap.Logger
+}
+
+// NewAgeEncryptor creates an encryptor for the configured age recipients
+func NewAgeEncryptor(config *Config) (*AgeEncryptor, error) {
+	log := logger.L().With(zap.String("encryption_type", TypeAge))
+
+	recipients := make([]age.Recipient, 0, len(config.Recipients))
+	for _, value := range config.Recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %v", value, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	log.Debug("Encryptor initialized successfully", zap.Int("recipient_count", len(recipients)))
+	return &AgeEncryptor{
+		config:     config,
+		recipients: recipients,
+		log:        log,
+	}, nil
+}
+
+// EncryptFile encrypts a file to the recipients and returns the path to the encrypted file
+func (e *AgeEncryptor) EncryptFile(inputPath string) (string, error) {
+	return encryptFile(e.log, inputPath, e.EncryptStream)
+}
+
+// DecryptFile decrypts an encrypted file with the configured identities
+func (e *AgeEncryptor) DecryptFile(inputPath, outputPath string) (string, error) {
+	return decryptFile(e.log, inputPath, outputPath, e.DecryptStream)
+}
+
+// EncryptStream encrypts everything read from r to the recipients and writes it to w
+func (e *AgeEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	encrypted, err := age.Encrypt(w, e.recipients...)
+	if err != nil {
+		return fmt.Errorf("error starting age encryption: %v", err)
+	}
+	if _, err := stream.Copy(encrypted, r); err != nil {
+		return fmt.Errorf("error encrypting data: %v", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("error finishing age encryption: %v", err)
+	}
+	return nil
+}
+
+// DecryptStream decrypts an age encrypted backup read from r and writes the plaintext to w.
+// age authenticates the file in chunks, so a truncated or tampered file is rejected.
+func (e *AgeEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	identities, err := e.identities()
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return fmt.Errorf("%w: %v", ErrDecryptionAuthFailed, err)
+		}
+		return fmt.Errorf("error decrypting data: %v", err)
+	}
+	if _, err := stream.Copy(w, decrypted); err != nil {
+		return fmt.Errorf("error decrypting data: %v", err)
+	}
+	return nil
+}
+
+// identities reads the private keys from the identity file, which is only needed to decrypt
+func (e *AgeEncryptor) identities() ([]age.Identity, error) {
+	if e.config.IdentityFile == "" {
+		return nil, fmt.Errorf("identity_file is required to decrypt age encrypted backups")
+	}
+
+	file, err := os.Open(e.config.IdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading identity file: %v", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing identity file %s: %v", e.config.IdentityFile, err)
+	}
+	return identities, nil
+}
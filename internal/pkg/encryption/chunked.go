@@ -0,0 +1,143 @@
+package encryption
+
+import (
+	"backup-agent/internal/pkg/stream"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format version 2 encrypts the plaintext in chunks so files of any size can be
+// processed with constant memory. After the magic marker and version byte (and
+// the key derivation parameters of version 3, see kdf.go) the header holds:
+//
+//	algorithm    1 byte   algorithmAES256GCM
+//	chunk size   4 bytes  big-endian plaintext bytes per chunk
+//	nonce prefix 8 bytes  random, shared by all chunks of the file
+//
+// Every chunk is sealed with its own nonce, the prefix followed by the 4-byte
+// big-endian chunk counter. The header and a final-chunk flag are authenticated
+// as additional data, so reordered, truncated or extended files fail to decrypt.
+// The final chunk is always shorter than the chunk size and may be empty.
+const (
+	algorithmAES256GCM byte = 1
+
+	noncePrefixSize = 8
+	// chunkHeaderSize is the size of the version 2 header after the magic and version byte
+	chunkHeaderSize = 1 + 4 + noncePrefixSize
+	// maxChunkSize bounds the memory a crafted header can make decryption allocate
+	maxChunkSize = stream.MaxBufferSize
+)
+
+// ErrTruncatedBackup is returned when a chunked file ends before its final chunk
+var ErrTruncatedBackup = errors.New("encrypted backup is truncated")
+
+// chunkNonce returns the nonce of the chunk with the given index
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	return nonce
+}
+
+// chunkAdditionalData authenticates the file header and whether the chunk is the last one
+func chunkAdditionalData(header []byte, final bool) []byte {
+	ad := append([]byte{}, header...)
+	if final {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// encryptChunks writes the chunked header after prefix, the magic, version byte and any
+// key derivation parameters, followed by the encrypted chunks of src to dst
+func encryptChunks(aead cipher.AEAD, dst io.Writer, src io.Reader, chunkSize int, prefix []byte) error {
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, noncePrefix); err != nil {
+		return fmt.Errorf("error generating nonce: %v", err)
+	}
+
+	header := append(append([]byte{}, prefix...), algorithmAES256GCM)
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	header = append(header, noncePrefix...)
+	if _, err := dst.Write(header); err != nil {
+		return fmt.Errorf("error writing header: %v", err)
+	}
+
+	plaintext := make([]byte, chunkSize)
+	ciphertext := make([]byte, 0, chunkSize+aead.Overhead())
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(src, plaintext)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("error reading plaintext: %v", err)
+		}
+
+		ciphertext = aead.Seal(ciphertext[:0], chunkNonce(noncePrefix, index), plaintext[:n], chunkAdditionalData(header, final))
+		if _, err := dst.Write(ciphertext); err != nil {
+			return fmt.Errorf("error writing ciphertext: %v", err)
+		}
+
+		if final {
+			return nil
+		}
+		if index == math.MaxUint32 {
+			return fmt.Errorf("file is too large for chunk size %d", chunkSize)
+		}
+	}
+}
+
+// decryptChunks reads the rest of a chunked file from src, whose prefix (the magic,
+// version byte and any key derivation parameters) has already been consumed, and
+// writes the plaintext to dst
+func decryptChunks(aead cipher.AEAD, dst io.Writer, src io.Reader, prefix []byte) error {
+	header := make([]byte, len(prefix)+chunkHeaderSize)
+	copy(header, prefix)
+	if _, err := io.ReadFull(src, header[len(prefix):]); err != nil {
+		return ErrTruncatedBackup
+	}
+
+	fields := header[len(prefix):]
+	if fields[0] != algorithmAES256GCM {
+		return fmt.Errorf("unsupported encryption algorithm %d", fields[0])
+	}
+	chunkSize := int(binary.BigEndian.Uint32(fields[1:5]))
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	noncePrefix := fields[5:]
+
+	ciphertext := make([]byte, chunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, chunkSize)
+	for index := uint32(0); ; index++ {
+		n, err := io.ReadFull(src, ciphertext)
+		if err == io.EOF {
+			// The previous chunk was full, so it wasn't the final one
+			return ErrTruncatedBackup
+		}
+		final := err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("error reading ciphertext: %v", err)
+		}
+
+		// Open only fails when the tag doesn't match, a wrong key fails on the first chunk
+		plaintext, err = aead.Open(plaintext[:0], chunkNonce(noncePrefix, index), ciphertext[:n], chunkAdditionalData(header, final))
+		if err != nil {
+			return fmt.Errorf("%w (chunk %d)", ErrDecryptionAuthFailed, index)
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return fmt.Errorf("error writing plaintext: %v", err)
+		}
+
+		if final {
+			return nil
+		}
+		if index == math.MaxUint32 {
+			return fmt.Errorf("encrypted backup has too many chunks")
+		}
+	}
+}
@@ -1,9 +1,32 @@
 package encryption
 
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
 // Config holds the encryption configuration
 type Config struct {
-	Enabled bool   `koanf:"enabled"`
-	Key     string `koanf:"key"` // Base64 encoded 32-byte key for AES-256
+	Enabled bool `koanf:"enabled"`
+	// Type selects the encryption provider: aes (default), age or gpg
+	Type string `koanf:"type"`
+	Key  string `koanf:"key"` // Base64 encoded 32-byte key for AES-256
+	// KeyFile is the path of a file holding the base64 encoded key
+	KeyFile string `koanf:"key_file"`
+	// KeyEnv is the name of an environment variable holding the base64 encoded key
+	KeyEnv string `koanf:"key_env"`
+	// Passphrase derives the key with scrypt and a random salt per file instead
+	// of using a key. Exactly one of key, key_file, key_env and passphrase must be set.
+	Passphrase string `koanf:"passphrase"`
+	// Recipients are the age public keys or GPG key IDs to encrypt to
+	Recipients []string `koanf:"recipients"`
+	// IdentityFile is the age identity file holding the private keys to decrypt with
+	IdentityFile string `koanf:"identity_file"`
+	// KeepLocalPlaintext keeps the unencrypted backup on local disk next to the
+	// encrypted one for fast local restores. Only the encrypted file is uploaded,
+	// but anyone with access to the backup directory can read the plaintext dump.
+	KeepLocalPlaintext bool `koanf:"keep_local_plaintext"`
 }
 
 // NewConfig creates a new encryption configuration
@@ -12,4 +35,40 @@ func NewConfig(enabled bool, key string) *Config {
 		Enabled: enabled,
 		Key:     key,
 	}
-} 
\ No newline at end of file
+}
+
+// sourceCount returns how many of the key sources are set
+func (c *Config) sourceCount() int {
+	count := 0
+	for _, source := range []string{c.Key, c.KeyFile, c.KeyEnv, c.Passphrase} {
+		if source != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// resolveKey returns the base64 encoded key from the inline key,
+// the key_env environment variable or the key_file
+func (c *Config) resolveKey() (string, error) {
+	switch {
+	case c.KeyEnv != "":
+		key := strings.TrimSpace(os.Getenv(c.KeyEnv))
+		if key == "" {
+			return "", fmt.Errorf("environment variable %s is empty or not set", c.KeyEnv)
+		}
+		return key, nil
+	case c.KeyFile != "":
+		content, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading key file: %v", err)
+		}
+		key := strings.TrimSpace(string(content))
+		if key == "" {
+			return "", fmt.Errorf("key file %s is empty", c.KeyFile)
+		}
+		return key, nil
+	default:
+		return c.Key, nil
+	}
+}
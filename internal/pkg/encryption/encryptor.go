@@ -2,23 +2,52 @@ package encryption
 
 import (
 	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/stream"
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strings"
 
 	"go.uber.org/zap"
 )
 
+// Encrypted files start with a magic marker and a format version byte.
+// Version 1 is followed by the 12-byte nonce and the AES-256-GCM ciphertext,
+// version 2 by the chunked format described in chunked.go.
+// Legacy files written before the header was introduced start with the nonce.
+var fileMagic = []byte("GBAK")
+
+const (
+	// formatVersion1 is a single-shot AES-256-GCM payload
+	formatVersion1 byte = 1
+	// formatVersion2 is a chunked AES-256-GCM stream
+	formatVersion2 byte = 2
+	// formatVersion3 is a chunked AES-256-GCM stream with a passphrase-derived key
+	formatVersion3 byte = 3
+
+	nonceSize = 12
+)
+
+var (
+	// ErrNotEncryptedBackup is returned when a file lacks the encrypted backup header
+	ErrNotEncryptedBackup = errors.New("file does not appear to be an encrypted backup")
+	// ErrDecryptionAuthFailed is returned when the ciphertext fails authentication,
+	// either because the key is wrong or because the file was modified
+	ErrDecryptionAuthFailed = errors.New("decryption failed authentication: the key or passphrase may be wrong, or the file was corrupted or tampered with")
+)
+
 // Encryptor handles file encryption and decryption
 type Encryptor struct {
 	config *Config
-	key    []byte // Decoded key
+	key    []byte // Decoded key, nil when a passphrase is used
 	log    *zap.Logger
+	// passphrase derives a key per file, see kdf.go
+	passphrase string
+	// allowLegacy accepts headerless files written by older versions
+	allowLegacy bool
 }
 
 // NewEncryptor creates a new encryptor instance
@@ -34,8 +63,26 @@ func NewEncryptor(config *Config) (*Encryptor, error) {
 		}, nil
 	}
 
+	if sources := config.sourceCount(); sources != 1 {
+		return nil, fmt.Errorf("exactly one of key, key_file, key_env or passphrase must be set for encryption, got %d", sources)
+	}
+	if config.Passphrase != "" {
+		log.Debug("Encryptor initialized with a passphrase")
+		return &Encryptor{
+			config:     config,
+			log:        log,
+			passphrase: config.Passphrase,
+		}, nil
+	}
+
+	encodedKey, err := config.resolveKey()
+	if err != nil {
+		log.Error("Error loading encryption key", zap.Error(err))
+		return nil, fmt.Errorf("error loading encryption key: %v", err)
+	}
+
 	// Decode the base64 key
-	key, err := base64.StdEncoding.DecodeString(config.Key)
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
 	if err != nil {
 		log.Error("Error decoding encryption key", zap.Error(err))
 		return nil, fmt.Errorf("error decoding encryption key: %v", err)
@@ -57,120 +104,176 @@ func NewEncryptor(config *Config) (*Encryptor, error) {
 	}, nil
 }
 
-// EncryptFile encrypts a file using AES-256-GCM and returns the path to the encrypted file
+// WithLegacyFormat allows decrypting headerless files written by older versions
+func (e *Encryptor) WithLegacyFormat(allow bool) *Encryptor {
+	e.allowLegacy = allow
+	return e
+}
+
+// EncryptFile encrypts a file using AES-256-GCM and returns the path to the encrypted file.
+// The file is processed in chunks of the configured stream buffer size.
 func (e *Encryptor) EncryptFile(inputPath string) (string, error) {
 	if !e.config.Enabled {
 		return inputPath, nil
 	}
+	return encryptFile(e.log, inputPath, e.EncryptStream)
+}
 
-	// Read the input file
-	plaintext, err := os.ReadFile(inputPath)
-	if err != nil {
-		e.log.Error("Error reading file",
-			zap.String("file", inputPath),
-			zap.Error(err))
-		return "", fmt.Errorf("error reading file: %v", err)
+// EncryptStream encrypts everything read from r and writes the encrypted backup to w,
+// in chunks of the configured stream buffer size
+func (e *Encryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	if !e.config.Enabled {
+		return fmt.Errorf("encryption is disabled, no key to encrypt with")
 	}
 
-	// Generate a random nonce
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		e.log.Error("Error generating nonce", zap.Error(err))
-		return "", fmt.Errorf("error generating nonce: %v", err)
+	// A passphrase derives a fresh key for every file from a random salt
+	key := e.key
+	prefix := append(append([]byte{}, fileMagic...), formatVersion2)
+	if e.passphrase != "" {
+		params, err := newKDFParams()
+		if err != nil {
+			return err
+		}
+		if key, err = params.deriveKey(e.passphrase); err != nil {
+			return err
+		}
+		prefix = append(append(append([]byte{}, fileMagic...), formatVersion3), params.bytes()...)
 	}
 
-	// Create cipher block
-	block, err := aes.NewCipher(e.key)
+	aesGCM, err := e.newGCM(key)
 	if err != nil {
-		e.log.Error("Error creating cipher", zap.Error(err))
-		return "", fmt.Errorf("error creating cipher: %v", err)
+		return err
 	}
+	// Larger chunks couldn't be decrypted again
+	return encryptChunks(aesGCM, w, r, min(stream.BufferSize(), maxChunkSize), prefix)
+}
 
-	// Create GCM mode
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		e.log.Error("Error creating GCM", zap.Error(err))
-		return "", fmt.Errorf("error creating GCM: %v", err)
-	}
-
-	// Encrypt the data
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-
-	// Create output file path
-	outputPath := inputPath + ".enc"
-
-	// Write the encrypted data
-	if err := os.WriteFile(outputPath, ciphertext, 0644); err != nil {
-		e.log.Error("Error writing encrypted file",
-			zap.String("file", outputPath),
-			zap.Error(err))
-		return "", fmt.Errorf("error writing encrypted file: %v", err)
+// DecryptFile decrypts an encrypted file using AES-256-GCM. Chunked files are
+// streamed, single-shot and legacy files are still read into memory.
+func (e *Encryptor) DecryptFile(inputPath, outputPath string) (string, error) {
+	if !e.config.Enabled {
+		return inputPath, nil
 	}
-
-	e.log.Info("File encrypted successfully",
-		zap.String("output_file", outputPath))
-	return outputPath, nil
+	return decryptFile(e.log, inputPath, outputPath, e.DecryptStream)
 }
 
-// DecryptFile decrypts an encrypted file using AES-256-GCM
-func (e *Encryptor) DecryptFile(inputPath string) (string, error) {
+// DecryptStream decrypts an encrypted backup read from r and writes the plaintext to w.
+// Chunked files are decrypted with constant memory and only authenticated chunks are
+// written; single-shot and legacy files are read into memory first.
+func (e *Encryptor) DecryptStream(r io.Reader, w io.Writer) error {
 	if !e.config.Enabled {
-		return inputPath, nil
+		return fmt.Errorf("encryption is disabled, no key to decrypt with")
 	}
 
-	// Read the encrypted file
-	ciphertext, err := os.ReadFile(inputPath)
+	// Read the format header
+	version, payload, err := e.readHeader(r)
 	if err != nil {
-		e.log.Error("Error reading encrypted file",
-			zap.String("file", inputPath),
-			zap.Error(err))
-		return "", fmt.Errorf("error reading encrypted file: %v", err)
+		return err
 	}
 
-	// Extract nonce
-	if len(ciphertext) < 12 {
-		e.log.Error("Ciphertext too short",
-			zap.Int("length", len(ciphertext)),
-			zap.Int("minimum", 12))
-		return "", fmt.Errorf("ciphertext too short")
+	if version == formatVersion3 {
+		if e.passphrase == "" {
+			return fmt.Errorf("backup was encrypted with a passphrase, but no passphrase is configured")
+		}
+		params, err := readKDFParams(payload)
+		if err != nil {
+			return err
+		}
+		key, err := params.deriveKey(e.passphrase)
+		if err != nil {
+			return err
+		}
+		aesGCM, err := e.newGCM(key)
+		if err != nil {
+			return err
+		}
+		prefix := append(append(append([]byte{}, fileMagic...), formatVersion3), params.bytes()...)
+		return decryptChunks(aesGCM, w, payload, prefix)
 	}
-	nonce := ciphertext[:12]
-	ciphertext = ciphertext[12:]
 
+	if e.key == nil {
+		return fmt.Errorf("backup was encrypted with a key, but only a passphrase is configured")
+	}
+	aesGCM, err := e.newGCM(e.key)
+	if err != nil {
+		return err
+	}
+	if version == formatVersion2 {
+		return decryptChunks(aesGCM, w, payload, append(append([]byte{}, fileMagic...), formatVersion2))
+	}
+	return decryptSingleShot(aesGCM, w, payload)
+}
+
+// newGCM creates the AES-256-GCM cipher for the key
+func (e *Encryptor) newGCM(key []byte) (cipher.AEAD, error) {
 	// Create cipher block
-	block, err := aes.NewCipher(e.key)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		e.log.Error("Error creating cipher", zap.Error(err))
-		return "", fmt.Errorf("error creating cipher: %v", err)
+		return nil, fmt.Errorf("error creating cipher: %v", err)
 	}
 
 	// Create GCM mode
 	aesGCM, err := cipher.NewGCM(block)
 	if err != nil {
 		e.log.Error("Error creating GCM", zap.Error(err))
-		return "", fmt.Errorf("error creating GCM: %v", err)
+		return nil, fmt.Errorf("error creating GCM: %v", err)
 	}
+	return aesGCM, nil
+}
 
-	// Decrypt the data
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		e.log.Error("Error decrypting data", zap.Error(err))
-		return "", fmt.Errorf("error decrypting data: %v", err)
+// readHeader consumes the format header and returns the format version and the
+// reader of the payload after it. Legacy files report version 0 and keep their
+// first bytes in the payload.
+func (e *Encryptor) readHeader(r io.Reader) (byte, io.Reader, error) {
+	header := make([]byte, len(fileMagic)+1)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, nil, fmt.Errorf("error reading encrypted file: %v", err)
 	}
+	header = header[:n]
 
-	// Create output file path
-	outputPath := strings.TrimSuffix(inputPath, ".enc")
+	if !bytes.HasPrefix(header, fileMagic) {
+		if e.allowLegacy {
+			e.log.Warn("File has no encryption header, decrypting as legacy format")
+			return 0, io.MultiReader(bytes.NewReader(header), r), nil
+		}
+		return 0, nil, fmt.Errorf("%w (use the legacy format option for files encrypted by older versions)", ErrNotEncryptedBackup)
+	}
 
-	// Write the decrypted data
-	if err := os.WriteFile(outputPath, plaintext, 0644); err != nil {
-		e.log.Error("Error writing decrypted file",
-			zap.String("file", outputPath),
-			zap.Error(err))
-		return "", fmt.Errorf("error writing decrypted file: %v", err)
+	if len(header) < len(fileMagic)+1 {
+		return 0, nil, ErrNotEncryptedBackup
 	}
+	version := header[len(fileMagic)]
+	if version != formatVersion1 && version != formatVersion2 && version != formatVersion3 {
+		return 0, nil, fmt.Errorf("unsupported encrypted backup format version %d", version)
+	}
+
+	return version, r, nil
+}
+
+// decryptSingleShot decrypts a version 1 or legacy payload, the nonce followed by the ciphertext
+func decryptSingleShot(aead cipher.AEAD, dst io.Writer, src io.Reader) error {
+	ciphertext, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("error reading encrypted file: %v", err)
+	}
+
+	// Extract nonce
+	if len(ciphertext) < nonceSize {
+		return fmt.Errorf("ciphertext too short")
+	}
+	nonce := ciphertext[:nonceSize]
+	ciphertext = ciphertext[nonceSize:]
 
-	e.log.Info("File decrypted successfully",
-		zap.String("input_file", inputPath),
-		zap.String("output_file", outputPath))
-	return outputPath, nil
-} 
\ No newline at end of file
+	// Decrypt the data
+	// Open only fails when the tag doesn't match
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return ErrDecryptionAuthFailed
+	}
+	if _, err := dst.Write(plaintext); err != nil {
+		return fmt.Errorf("error writing decrypted file: %v", err)
+	}
+	return nil
+}
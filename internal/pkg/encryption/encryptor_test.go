@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"backup-agent/internal/pkg/stream"
+)
+
+// encryptForTest encrypts plaintext with the provider and returns the ciphertext
+func encryptForTest(t *testing.T, provider Provider, plaintext []byte) []byte {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	if err := provider.EncryptStream(bytes.NewReader(plaintext), &ciphertext); err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+	return ciphertext.Bytes()
+}
+
+func TestDecryptRejectsFlippedByte(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	// Several chunks of the default stream buffer size and a short final one
+	plaintext := make([]byte, 3*stream.DefaultBufferSize+100)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{name: "key", config: &Config{Enabled: true, Key: base64.StdEncoding.EncodeToString(key)}},
+		{name: "passphrase", config: &Config{Enabled: true, Passphrase: "correct horse battery staple"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := New(tt.config)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			ciphertext := encryptForTest(t, provider, plaintext)
+
+			var decrypted bytes.Buffer
+			if err := provider.DecryptStream(bytes.NewReader(ciphertext), &decrypted); err != nil {
+				t.Fatalf("DecryptStream() of the intact ciphertext error = %v", err)
+			}
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				t.Fatal("decrypted plaintext differs from the original")
+			}
+
+			// The header, the first, middle and final chunks and the last tag byte
+			positions := []int{0, len(fileMagic), len(fileMagic) + 1, len(fileMagic) + chunkHeaderSize,
+				len(ciphertext) / 2, len(ciphertext) - 17, len(ciphertext) - 1}
+			for _, pos := range positions {
+				corrupted := append([]byte{}, ciphertext...)
+				corrupted[pos] ^= 0x01
+				if err := provider.DecryptStream(bytes.NewReader(corrupted), &bytes.Buffer{}); err == nil {
+					t.Errorf("DecryptStream() accepted a ciphertext with byte %d of %d flipped", pos, len(ciphertext))
+				}
+			}
+		})
+	}
+}
+
+func TestChunkSizeBoundaryRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := New(&Config{Enabled: true, Key: base64.StdEncoding.EncodeToString(key)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// A full chunk and a short final one
+	plaintext := make([]byte, maxChunkSize+100)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.SetBufferSize(0) })
+
+	for _, size := range []int{maxChunkSize, maxChunkSize + 1, 2 * maxChunkSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			stream.SetBufferSize(size)
+			ciphertext := encryptForTest(t, provider, plaintext)
+
+			var decrypted bytes.Buffer
+			if err := provider.DecryptStream(bytes.NewReader(ciphertext), &decrypted); err != nil {
+				t.Fatalf("DecryptStream() with a buffer size of %d error = %v", size, err)
+			}
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				t.Fatal("decrypted plaintext differs from the original")
+			}
+		})
+	}
+}
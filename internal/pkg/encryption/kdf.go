@@ -0,0 +1,86 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Format version 3 is the chunked format of version 2 encrypted with a key
+// derived from a passphrase. Between the version byte and the chunked header
+// it holds the key derivation parameters:
+//
+//	kdf    1 byte    kdfScrypt
+//	log2 N 1 byte    scrypt CPU/memory cost
+//	r      1 byte    scrypt block size
+//	p      1 byte    scrypt parallelization
+//	salt   16 bytes  random, per file
+//
+// The parameters are authenticated as part of the header like the rest of it.
+const (
+	kdfScrypt byte = 1
+
+	saltSize      = 16
+	kdfHeaderSize = 4 + saltSize
+
+	// Defaults for new files, about 100ms and 32MiB per derivation
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// Limits for reading files, so a crafted header can't make decryption hang
+	maxScryptLogN = 20
+	maxScryptR    = 32
+	maxScryptP    = 16
+)
+
+// kdfParams are the key derivation parameters stored in a version 3 header
+type kdfParams struct {
+	logN byte
+	r    byte
+	p    byte
+	salt []byte
+}
+
+// newKDFParams returns the default parameters with a fresh random salt
+func newKDFParams() (kdfParams, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return kdfParams{}, fmt.Errorf("error generating salt: %v", err)
+	}
+	return kdfParams{logN: scryptLogN, r: scryptR, p: scryptP, salt: salt}, nil
+}
+
+// readKDFParams reads and checks the key derivation parameters of a version 3 file
+func readKDFParams(r io.Reader) (kdfParams, error) {
+	buf := make([]byte, kdfHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return kdfParams{}, ErrTruncatedBackup
+	}
+	if buf[0] != kdfScrypt {
+		return kdfParams{}, fmt.Errorf("unsupported key derivation function %d", buf[0])
+	}
+
+	params := kdfParams{logN: buf[1], r: buf[2], p: buf[3], salt: buf[4:]}
+	if params.logN == 0 || params.logN > maxScryptLogN || params.r == 0 || params.r > maxScryptR ||
+		params.p == 0 || params.p > maxScryptP {
+		return kdfParams{}, fmt.Errorf("invalid key derivation parameters N=2^%d r=%d p=%d", params.logN, params.r, params.p)
+	}
+	return params, nil
+}
+
+// bytes returns the parameters as stored in the header
+func (k kdfParams) bytes() []byte {
+	return append([]byte{kdfScrypt, k.logN, k.r, k.p}, k.salt...)
+}
+
+// deriveKey derives the AES-256 key from the passphrase
+func (k kdfParams) deriveKey(passphrase string) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), k.salt, 1<<k.logN, int(k.r), int(k.p), 32)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"backup-agent/internal/pkg/stream"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// Encryption types selected by encryption.type
+const (
+	// TypeAES encrypts with a shared AES-256 key or passphrase
+	TypeAES = "aes"
+	// TypeAge encrypts to age public keys
+	TypeAge = "age"
+	// TypeGPG encrypts to GPG public keys with the gpg binary
+	TypeGPG = "gpg"
+)
+
+// workDir holds the temporary files written while encrypting or decrypting
+var workDir string
+
+// SetWorkDir sets the directory temporary files are written to while encrypting
+// or decrypting a file. An empty dir writes them next to the output file.
+func SetWorkDir(dir string) {
+	workDir = dir
+}
+
+// Provider encrypts and decrypts backup files. Encrypted files get the .enc
+// suffix whichever provider wrote them. With encryption disabled EncryptFile
+// and DecryptFile return the input path unchanged.
+type Provider interface {
+	// EncryptFile encrypts a file and returns the path to the encrypted file
+	EncryptFile(inputPath string) (string, error)
+	// DecryptFile decrypts a .enc file into outputPath, or next to it without the
+	// .enc suffix when outputPath is empty, and returns the path to the decrypted file
+	DecryptFile(inputPath, outputPath string) (string, error)
+	// EncryptStream encrypts everything read from r and writes it to w
+	EncryptStream(r io.Reader, w io.Writer) error
+	// DecryptStream decrypts an encrypted backup read from r and writes the plaintext to w
+	DecryptStream(r io.Reader, w io.Writer) error
+}
+
+// New creates the encryption provider selected by the configured type
+func New(config *Config) (Provider, error) {
+	if !config.Enabled {
+		return NewEncryptor(config)
+	}
+
+	switch config.Type {
+	case "", TypeAES:
+		if len(config.Recipients) > 0 || config.IdentityFile != "" {
+			return nil, fmt.Errorf("recipients and identity_file are only supported for encryption types %s and %s", TypeAge, TypeGPG)
+		}
+		encryptor, err := NewEncryptor(config)
+		if err != nil {
+			return nil, err
+		}
+		return encryptor, nil
+	case TypeAge, TypeGPG:
+		if config.sourceCount() > 0 {
+			return nil, fmt.Errorf("key, key_file, key_env and passphrase are only supported for encryption type %s", TypeAES)
+		}
+		if len(config.Recipients) == 0 {
+			return nil, fmt.Errorf("at least one recipient is required for encryption type %s", config.Type)
+		}
+		if config.Type == TypeAge {
+			return NewAgeEncryptor(config)
+		}
+		if config.IdentityFile != "" {
+			return nil, fmt.Errorf("identity_file is not supported for encryption type %s, the private key is taken from the GPG keyring", TypeGPG)
+		}
+		return NewGPGEncryptor(config)
+	default:
+		return nil, fmt.Errorf("unsupported encryption type %q: must be %s, %s or %s", config.Type, TypeAES, TypeAge, TypeGPG)
+	}
+}
+
+// encryptFile encrypts inputPath into inputPath.enc with encrypt and returns the new path
+func encryptFile(log *zap.Logger, inputPath string, encrypt func(r io.Reader, w io.Writer) error) (string, error) {
+	// Open the input file
+	input, err := os.Open(inputPath)
+	if err != nil {
+		log.Error("Error reading file",
+			zap.String("file", inputPath),
+			zap.Error(err))
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	defer input.Close()
+
+	// Create output file path
+	outputPath := inputPath + ".enc"
+
+	// Write the encrypted data
+	err = writeFile(outputPath, func(w io.Writer) error {
+		return encrypt(input, w)
+	})
+	if err != nil {
+		log.Error("Error writing encrypted file",
+			zap.String("file", outputPath),
+			zap.Error(err))
+		return "", fmt.Errorf("error writing encrypted file: %v", err)
+	}
+
+	log.Info("File encrypted successfully",
+		zap.String("output_file", outputPath))
+	return outputPath, nil
+}
+
+// decryptFile decrypts inputPath with decrypt into outputPath, by default the path
+// without the .enc suffix. Missing parent directories of outputPath are created.
+func decryptFile(log *zap.Logger, inputPath, outputPath string, decrypt func(r io.Reader, w io.Writer) error) (string, error) {
+	// Open the encrypted file
+	input, err := os.Open(inputPath)
+	if err != nil {
+		log.Error("Error reading encrypted file",
+			zap.String("file", inputPath),
+			zap.Error(err))
+		return "", fmt.Errorf("error reading encrypted file: %v", err)
+	}
+	defer input.Close()
+
+	// Create output file path
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(inputPath, ".enc")
+	} else if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		log.Error("Error creating output directory",
+			zap.String("file", outputPath),
+			zap.Error(err))
+		return "", fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	// Write the decrypted data
+	err = writeFile(outputPath, func(w io.Writer) error {
+		return decrypt(input, w)
+	})
+	if err != nil {
+		log.Error("Error decrypting file",
+			zap.String("file", inputPath),
+			zap.Error(err))
+		return "", err
+	}
+
+	log.Info("File decrypted successfully",
+		zap.String("input_file", inputPath),
+		zap.String("output_file", outputPath))
+	return outputPath, nil
+}
+
+// writeFile fills path with write through a temporary file in the work directory
+// that replaces path only once writing succeeded, so no partial output is left
+// behind and path may be the input
+func writeFile(path string, write func(w io.Writer) error) error {
+	dir := workDir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating work directory: %v", err)
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing file: %v", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("error setting file permissions: %v", err)
+	}
+	if err := moveFile(tmpPath, path); err != nil {
+		return fmt.Errorf("error renaming file: %v", err)
+	}
+	return nil
+}
+
+// moveFile renames src to dst. A work directory on another filesystem can't be
+// renamed across, the file is copied next to dst and renamed there instead.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	if _, err := stream.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
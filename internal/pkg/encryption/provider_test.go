@@ -0,0 +1,67 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileStagesInWorkDir(t *testing.T) {
+	work := t.TempDir()
+	SetWorkDir(work)
+	t.Cleanup(func() { SetWorkDir("") })
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := New(&Config{Enabled: true, Key: base64.StdEncoding.EncodeToString(key)})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "shop.sql")
+	if err := os.WriteFile(input, []byte("CREATE TABLE orders (id INT);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := provider.EncryptFile(input)
+	if err != nil {
+		t.Fatalf("EncryptFile() error = %v", err)
+	}
+	if encrypted != input+".enc" {
+		t.Errorf("EncryptFile() = %q, want %q", encrypted, input+".enc")
+	}
+	decrypted, err := provider.DecryptFile(encrypted, filepath.Join(dir, "restored", "shop.sql"))
+	if err != nil {
+		t.Fatalf("DecryptFile() error = %v", err)
+	}
+	if content, err := os.ReadFile(decrypted); err != nil || string(content) != "CREATE TABLE orders (id INT);\n" {
+		t.Errorf("decrypted %q, %v", content, err)
+	}
+
+	// A failed write leaves neither a partial output nor its temporary file
+	failed := filepath.Join(dir, "failed.sql")
+	err = writeFile(failed, func(w io.Writer) error {
+		if file, ok := w.(*os.File); !ok || filepath.Dir(file.Name()) != work {
+			t.Errorf("writeFile() staged the output outside the work directory %s", work)
+		}
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return errors.New("dump interrupted")
+	})
+	if err == nil {
+		t.Fatal("writeFile() succeeded with a failing writer")
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Errorf("failed write left %s behind", failed)
+	}
+	if entries, _ := os.ReadDir(work); len(entries) != 0 {
+		t.Errorf("work directory holds %d leftover files", len(entries))
+	}
+}
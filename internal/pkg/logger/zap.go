@@ -3,6 +3,7 @@ package logger
 import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // LogLevel represents the logging level
@@ -20,32 +21,120 @@ const (
 	ErrorLevel LogLevel = "error"
 )
 
+// Format is the encoding of the log output
+type Format string
+
+const (
+	// ConsoleFormat is human-readable, colored output. It is the default.
+	ConsoleFormat Format = "console"
+	// JSONFormat writes one JSON object per entry, for log aggregators.
+	JSONFormat Format = "json"
+)
+
+// Config controls the global logger
+type Config struct {
+	Level  LogLevel
+	Format Format
+	// File additionally writes the logs to this path, rotated by size
+	File string
+	// MaxSizeMB is the size a log file is rotated at, 100 when zero
+	MaxSizeMB int
+	// MaxBackups is how many rotated files are kept, all when zero
+	MaxBackups int
+	// MaxAgeDays removes rotated files older than this, never when zero
+	MaxAgeDays int
+}
+
 // NewDevelopment creates a new development logger that writes to stdout
 // with a human-readable format.
 func NewDevelopment(level LogLevel) (*zap.Logger, error) {
+	return newDevelopment(level, "stdout")
+}
+
+// newDevelopment creates a development logger that writes to the given output path
+func newDevelopment(level LogLevel, output string) (*zap.Logger, error) {
 	config := zap.NewDevelopmentConfig()
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.OutputPaths = []string{"stdout"}
+	config.OutputPaths = []string{output}
+	config.ErrorOutputPaths = []string{"stderr"}
+	config.Level = zap.NewAtomicLevelAt(zapLevel(level))
+
+	return config.Build()
+}
+
+// NewProduction creates a new production logger that writes JSON to stdout
+// without colors, suitable for log aggregators.
+func NewProduction(level LogLevel) (*zap.Logger, error) {
+	return newProduction(level, "stdout")
+}
+
+// newProduction creates a production logger that writes to the given output path
+func newProduction(level LogLevel, output string) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.OutputPaths = []string{output}
 	config.ErrorOutputPaths = []string{"stderr"}
+	config.Level = zap.NewAtomicLevelAt(zapLevel(level))
+	// Every entry of a backup run matters, don't drop repeated ones
+	config.Sampling = nil
+
+	return config.Build()
+}
 
-	// Set the log level
-	var zapLevel zapcore.Level
+// zapLevel converts the log level, unknown levels default to info
+func zapLevel(level LogLevel) zapcore.Level {
 	switch level {
 	case DebugLevel:
-		zapLevel = zapcore.DebugLevel
+		return zapcore.DebugLevel
 	case InfoLevel:
-		zapLevel = zapcore.InfoLevel
+		return zapcore.InfoLevel
 	case WarnLevel:
-		zapLevel = zapcore.WarnLevel
+		return zapcore.WarnLevel
 	case ErrorLevel:
-		zapLevel = zapcore.ErrorLevel
+		return zapcore.ErrorLevel
 	default:
-		zapLevel = zapcore.InfoLevel
+		return zapcore.InfoLevel
 	}
-	config.Level = zap.NewAtomicLevelAt(zapLevel)
+}
 
-	return config.Build()
+// newLogger creates a logger in the configured format writing to the given output
+// path and, when a log file is configured, to the rotated log file
+func newLogger(cfg Config, output string) (*zap.Logger, error) {
+	var logger *zap.Logger
+	var err error
+	if cfg.Format == JSONFormat {
+		logger, err = newProduction(cfg.Level, output)
+	} else {
+		logger, err = newDevelopment(cfg.Level, output)
+	}
+	if err != nil || cfg.File == "" {
+		return logger, err
+	}
+
+	fileCore := zapcore.NewCore(fileEncoder(cfg.Format), zapcore.AddSync(&lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+	}), zapLevel(cfg.Level))
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, fileCore)
+	})), nil
+}
+
+// fileEncoder returns the encoder of the log file, console output is written without colors
+func fileEncoder(format Format) zapcore.Encoder {
+	if format == JSONFormat {
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(config)
+	}
+	config := zap.NewDevelopmentEncoderConfig()
+	config.EncodeLevel = zapcore.CapitalLevelEncoder
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	return zapcore.NewConsoleEncoder(config)
 }
 
 // MustNewDevelopment creates a new development logger and panics if an error occurs.
@@ -67,9 +156,20 @@ var (
 	globalLogger *zap.Logger
 )
 
-// Init initializes the global logger with development configuration.
-func Init(level LogLevel) error {
-	logger, err := NewDevelopment(level)
+// Init initializes the global logger in the configured format.
+func Init(cfg Config) error {
+	logger, err := newLogger(cfg, "stdout")
+	if err != nil {
+		return err
+	}
+	globalLogger = logger
+	return nil
+}
+
+// InitStderr initializes the global logger writing to stderr, keeping stdout
+// free for machine-readable command output.
+func InitStderr(cfg Config) error {
+	logger, err := newLogger(cfg, "stderr")
 	if err != nil {
 		return err
 	}
@@ -78,8 +178,8 @@ func Init(level LogLevel) error {
 }
 
 // MustInit initializes the global logger and panics if an error occurs.
-func MustInit(level LogLevel) {
-	if err := Init(level); err != nil {
+func MustInit(cfg Config) {
+	if err := Init(cfg); err != nil {
 		panic("failed to initialize logger: " + err.Error())
 	}
 }
@@ -100,4 +200,4 @@ func Sync() error {
 		return globalLogger.Sync()
 	}
 	return nil
-} 
\ No newline at end of file
+}
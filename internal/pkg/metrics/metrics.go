@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	namespace   = "backup_agent"
+	defaultAddr = ":9464"
+)
+
+// Config holds the metrics endpoint configuration
+type Config struct {
+	Enabled bool `koanf:"enabled"`
+	// Addr is the listen address of the metrics server (default ":9464")
+	Addr string `koanf:"addr"`
+	// TextfilePath additionally writes the metrics to this file when a run ends,
+	// for the node_exporter textfile collector. The HTTP endpoint only lives as
+	// long as the process, so timer-driven runs should set this.
+	TextfilePath string `koanf:"textfile_path"`
+}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	backupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_total",
+		Help:      "Number of database backups by result.",
+	}, []string{"database", "status"})
+
+	backupDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_backup_duration_seconds",
+		Help:      "Duration of the last backup of the database.",
+	}, []string{"database"})
+
+	lastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful backup of the database.",
+	}, []string{"database"})
+
+	uploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes uploaded to S3.",
+	})
+
+	uploadDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_upload_duration_seconds",
+		Help:      "Duration of the last upload of a backup of the database.",
+	}, []string{"database"})
+)
+
+func init() {
+	registry.MustRegister(backupsTotal, backupDuration, lastSuccess, uploadedBytes, uploadDuration)
+}
+
+// Start serves the metrics on cfg.Addr when metrics are enabled and returns a
+// function that stops the server. The listener is opened before returning so
+// a busy address is reported right away.
+func Start(cfg Config) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	log := logger.L().With(zap.String("addr", listener.Addr().String()))
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Metrics server stopped", zap.Error(err))
+		}
+	}()
+	log.Info("Serving metrics")
+
+	return server.Shutdown, nil
+}
+
+// Flush writes the metrics to cfg.TextfilePath when metrics are enabled and a path is set
+func Flush(cfg Config) error {
+	if !cfg.Enabled || cfg.TextfilePath == "" {
+		return nil
+	}
+	if err := prometheus.WriteToTextfile(cfg.TextfilePath, registry); err != nil {
+		return fmt.Errorf("error writing metrics to %s: %v", cfg.TextfilePath, err)
+	}
+	return nil
+}
+
+// RecordBackup records the outcome and duration of a database backup
+func RecordBackup(database string, duration time.Duration, err error) {
+	backupDuration.WithLabelValues(database).Set(duration.Seconds())
+	if err != nil {
+		backupsTotal.WithLabelValues(database, "failed").Inc()
+		return
+	}
+	backupsTotal.WithLabelValues(database, "succeeded").Inc()
+	lastSuccess.WithLabelValues(database).SetToCurrentTime()
+}
+
+// AddUploadedBytes adds n bytes to the uploaded bytes counter
+func AddUploadedBytes(n int64) {
+	uploadedBytes.Add(float64(n))
+}
+
+// RecordUpload records the duration of the upload of a backup of the database
+func RecordUpload(database string, duration time.Duration) {
+	uploadDuration.WithLabelValues(database).Set(duration.Seconds())
+}
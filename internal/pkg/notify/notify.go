@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"backup-agent/internal/catalog"
+	"backup-agent/internal/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// NotifyAlways reports every run
+	NotifyAlways = "always"
+	// NotifyFailure only reports failed runs and recoveries
+	NotifyFailure = "failure"
+)
+
+// Statuses of a reported run
+const (
+	StatusSuccess   = "success"
+	StatusFailure   = "failure"
+	StatusRecovered = "recovered"
+)
+
+// Config holds the notification settings
+type Config struct {
+	// NotifyOn is "always" (default) or "failure"
+	NotifyOn string        `koanf:"notify_on"`
+	Webhook  WebhookConfig `koanf:"webhook"`
+	SMTP     SMTPConfig    `koanf:"smtp"`
+}
+
+// Validate checks the notification settings and fills in defaults
+func (c *Config) Validate() error {
+	switch c.NotifyOn {
+	case "":
+		c.NotifyOn = NotifyAlways
+	case NotifyAlways, NotifyFailure:
+	default:
+		return fmt.Errorf("invalid notifications.notify_on %q: must be %q or %q",
+			c.NotifyOn, NotifyAlways, NotifyFailure)
+	}
+
+	if c.Webhook.FailureThreshold < 0 {
+		return fmt.Errorf("invalid notifications.webhook.failure_threshold %d: must not be negative", c.Webhook.FailureThreshold)
+	}
+	return c.SMTP.validate()
+}
+
+// DatabaseStats describes what a run did for a single database
+type DatabaseStats struct {
+	Name     string
+	Files    int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// Event describes the outcome of a backup or delete run
+type Event struct {
+	// Command is the command that ran, "backup" or "delete"
+	Command string
+	Status  string
+	// Database is the database that failed, if the failure belongs to one
+	Database string
+	Error    string
+	// Output is the stderr of the failed database command, if any
+	Output    string
+	Duration  time.Duration
+	Bytes     int64
+	Databases []DatabaseStats
+}
+
+// Summary returns a one-line description of the event
+func (e Event) Summary() string {
+	switch e.Status {
+	case StatusFailure:
+		if e.Database != "" {
+			return fmt.Sprintf("%s of %s failed after %s: %s", e.Command, e.Database, e.Duration.Round(time.Second), e.Error)
+		}
+		return fmt.Sprintf("%s failed after %s: %s", e.Command, e.Duration.Round(time.Second), e.Error)
+	case StatusRecovered:
+		return fmt.Sprintf("%s recovered, completed in %s", e.Command, e.Duration.Round(time.Second))
+	default:
+		if len(e.Databases) == 0 {
+			return fmt.Sprintf("%s completed in %s", e.Command, e.Duration.Round(time.Second))
+		}
+		return fmt.Sprintf("%s completed in %s (%d database(s), %d bytes)", e.Command, e.Duration.Round(time.Second), len(e.Databases), e.Bytes)
+	}
+}
+
+// channel delivers events to one destination
+type channel interface {
+	name() string
+	// failureThreshold is the number of consecutive failures before one is reported
+	failureThreshold() int
+	send(ctx context.Context, event Event) error
+}
+
+// Notifier reports run outcomes to every configured channel. Consecutive
+// failures are counted per command and channel in the catalog, so a channel
+// is only told about a failure once its threshold is reached, and about the
+// recovery on the next successful run.
+type Notifier struct {
+	cfg         Config
+	catalogPath string
+	channels    []channel
+}
+
+// New creates a notifier for the configured channels, the failure counters are kept in the catalog at catalogPath
+func New(cfg Config, catalogPath string) *Notifier {
+	n := &Notifier{
+		cfg:         cfg,
+		catalogPath: catalogPath,
+	}
+	if cfg.Webhook.URL != "" {
+		n.channels = append(n.channels, newWebhook(cfg.Webhook))
+	}
+	if cfg.SMTP.Host != "" {
+		n.channels = append(n.channels, newMailer(cfg.SMTP))
+	}
+	return n
+}
+
+// Notify sends the event to the channels it is due for and returns an error
+// listing the channels that couldn't be reached
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	if len(n.channels) == 0 {
+		return nil
+	}
+	log := logger.L().With(
+		zap.String("command", event.Command),
+		zap.String("status", event.Status))
+
+	cat, err := catalog.Load(n.catalogPath)
+	if err != nil {
+		// Without the counters every failure is reported, which errs on the safe side
+		log.Warn("Error loading catalog, ignoring failure thresholds", zap.Error(err))
+		cat = nil
+	}
+
+	var errs []error
+	for _, ch := range n.channels {
+		due, ok := n.due(cat, ch, event)
+		if !ok {
+			log.Debug("Notification not due", zap.String("channel", ch.name()))
+			continue
+		}
+		if err := ch.send(ctx, due); err != nil {
+			log.Error("Error sending notification", zap.String("channel", ch.name()), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %v", ch.name(), err))
+			continue
+		}
+		log.Info("Notification sent", zap.String("channel", ch.name()), zap.String("sent_status", due.Status))
+	}
+
+	if cat != nil {
+		if err := cat.Save(); err != nil {
+			log.Warn("Error saving catalog", zap.Error(err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// due updates the channel's failure counter and returns the event to send, if any
+func (n *Notifier) due(cat *catalog.Catalog, ch channel, event Event) (Event, bool) {
+	threshold := ch.failureThreshold()
+	if threshold < 1 {
+		threshold = 1
+	}
+	if cat == nil {
+		return event, event.Status == StatusFailure || n.cfg.NotifyOn == NotifyAlways
+	}
+
+	key := event.Command + "/" + ch.name()
+	failures := cat.FailureCount(key)
+
+	if event.Status == StatusFailure {
+		failures++
+		cat.SetFailureCount(key, failures)
+		return event, failures >= threshold
+	}
+
+	cat.SetFailureCount(key, 0)
+	if failures >= threshold {
+		// The channel was told about the failure, so tell it about the recovery
+		event.Status = StatusRecovered
+		return event, true
+	}
+	return event, n.cfg.NotifyOn == NotifyAlways
+}
@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultSMTPPort = 587
+	// implicitTLSPort is the submission port speaking TLS from the first byte
+	implicitTLSPort = 465
+	smtpTimeout     = 30 * time.Second
+)
+
+// TLS modes of the email channel
+const (
+	// SMTPTLSStartTLS upgrades the connection with STARTTLS when the server offers it
+	SMTPTLSStartTLS = "starttls"
+	// SMTPTLSImplicit speaks TLS from the first byte, as on port 465
+	SMTPTLSImplicit = "implicit"
+)
+
+// SMTPConfig holds the settings of the email channel
+type SMTPConfig struct {
+	Host string `koanf:"host"`
+	// Port defaults to 587, or 465 with implicit TLS
+	Port int `koanf:"port"`
+	// TLS is starttls (the default, used whenever the server offers it) or
+	// implicit, which port 465 defaults to
+	TLS      string   `koanf:"tls"`
+	User     string   `koanf:"user"`
+	Password string   `koanf:"password"`
+	From     string   `koanf:"from"`
+	To       []string `koanf:"to"`
+	// FailureThreshold is the number of consecutive failed runs before a
+	// failure is reported (default 1)
+	FailureThreshold int `koanf:"failure_threshold"`
+}
+
+// validate checks that an enabled email channel has a sender and recipients
+func (c *SMTPConfig) validate() error {
+	if c.Host == "" {
+		return nil
+	}
+	if c.TLS == "" && c.Port == implicitTLSPort {
+		c.TLS = SMTPTLSImplicit
+	}
+	switch c.TLS {
+	case "", SMTPTLSStartTLS:
+		c.TLS = SMTPTLSStartTLS
+		if c.Port == 0 {
+			c.Port = defaultSMTPPort
+		}
+	case SMTPTLSImplicit:
+		if c.Port == 0 {
+			c.Port = implicitTLSPort
+		}
+	default:
+		return fmt.Errorf("invalid notifications.smtp.tls %q: must be %s or %s", c.TLS, SMTPTLSStartTLS, SMTPTLSImplicit)
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("notifications.smtp.from and notifications.smtp.to are required when notifications.smtp.host is set")
+	}
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("invalid notifications.smtp.failure_threshold %d: must not be negative", c.FailureThreshold)
+	}
+	return nil
+}
+
+// mailer sends events as plain-text summary emails
+type mailer struct {
+	cfg       SMTPConfig
+	tlsConfig *tls.Config
+}
+
+func newMailer(cfg SMTPConfig) *mailer {
+	return &mailer{cfg: cfg, tlsConfig: &tls.Config{ServerName: cfg.Host}}
+}
+
+func (m *mailer) name() string {
+	return "smtp"
+}
+
+func (m *mailer) failureThreshold() int {
+	return m.cfg.FailureThreshold
+}
+
+func (m *mailer) send(ctx context.Context, event Event) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS == SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: m.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %v", addr, err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("error setting deadline: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && m.cfg.TLS != SMTPTLSImplicit {
+		if err := client.StartTLS(m.tlsConfig); err != nil {
+			return fmt.Errorf("error starting TLS: %v", err)
+		}
+	}
+	if m.cfg.User != "" {
+		// PlainAuth refuses to send the password over an unencrypted connection to a remote host
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.User, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("error authenticating: %v", err)
+		}
+	}
+
+	if err := client.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("error setting sender: %v", err)
+	}
+	for _, to := range m.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %v", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message: %v", err)
+	}
+	if _, err := w.Write(m.message(event)); err != nil {
+		return fmt.Errorf("error writing message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending message: %v", err)
+	}
+	return client.Quit()
+}
+
+// message renders the event as an email with the per-database stats and,
+// for failed database commands, their stderr inlined
+func (m *mailer) message(event Event) []byte {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "%s\n\n", event.Summary())
+	fmt.Fprintf(&body, "Status:   %s\n", event.Status)
+	fmt.Fprintf(&body, "Duration: %s\n", event.Duration.Round(time.Second))
+	fmt.Fprintf(&body, "Bytes:    %d\n", event.Bytes)
+	if event.Database != "" {
+		fmt.Fprintf(&body, "Database: %s\n", event.Database)
+	}
+
+	if len(event.Databases) > 0 {
+		body.WriteString("\nDatabases:\n")
+		tw := tabwriter.NewWriter(&body, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tFILES\tBYTES\tDURATION")
+		for _, db := range event.Databases {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", db.Name, db.Files, db.Bytes, db.Duration.Round(time.Second))
+		}
+		tw.Flush()
+	}
+
+	if event.Error != "" {
+		fmt.Fprintf(&body, "\nError:\n%s\n", strings.TrimSpace(event.Error))
+	}
+	if event.Output != "" {
+		fmt.Fprintf(&body, "\nCommand output (stderr):\n%s\n", strings.TrimSpace(event.Output))
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [backup-agent] %s %s\r\n", event.Command, event.Status)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes()
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPS is an SMTP server speaking TLS from the first byte that accepts
+// any login and records the messages it receives
+func fakeSMTPS(t *testing.T) (addr string, roots *x509.CertPool, messages chan string) {
+	t.Helper()
+
+	// Borrow the self-signed certificate of httptest, valid for 127.0.0.1
+	certServer := httptest.NewTLSServer(nil)
+	t.Cleanup(certServer.Close)
+	roots = x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages = make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+			case "EHLO":
+				fmt.Fprint(conn, "250-localhost\r\n250 AUTH PLAIN\r\n")
+			case "AUTH":
+				fmt.Fprint(conn, "235 authenticated\r\n")
+			case "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				var msg strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				messages <- msg.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String(), roots, messages
+}
+
+func TestMailerImplicitTLS(t *testing.T) {
+	addr, roots, messages := fakeSMTPS(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, _ := strconv.Atoi(port)
+
+	cfg := SMTPConfig{
+		Host:     host,
+		Port:     portNumber,
+		TLS:      SMTPTLSImplicit,
+		User:     "backup",
+		Password: "secret",
+		From:     "backup-agent@example.com",
+		To:       []string{"ops@example.com"},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	m := newMailer(cfg)
+	m.tlsConfig.RootCAs = roots
+
+	if err := m.send(context.Background(), Event{Command: "backup", Status: StatusSuccess}); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if msg := <-messages; !strings.Contains(msg, "Subject: [backup-agent] backup success") {
+		t.Errorf("received message %q, want the backup summary", msg)
+	}
+}
+
+func TestSMTPConfigTLSDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      SMTPConfig
+		wantTLS  string
+		wantPort int
+		wantErr  bool
+	}{
+		{name: "default", cfg: SMTPConfig{}, wantTLS: SMTPTLSStartTLS, wantPort: 587},
+		{name: "port 465", cfg: SMTPConfig{Port: 465}, wantTLS: SMTPTLSImplicit, wantPort: 465},
+		{name: "implicit", cfg: SMTPConfig{TLS: SMTPTLSImplicit}, wantTLS: SMTPTLSImplicit, wantPort: 465},
+		{name: "implicit on another port", cfg: SMTPConfig{TLS: SMTPTLSImplicit, Port: 2465}, wantTLS: SMTPTLSImplicit, wantPort: 2465},
+		{name: "starttls", cfg: SMTPConfig{TLS: SMTPTLSStartTLS, Port: 25}, wantTLS: SMTPTLSStartTLS, wantPort: 25},
+		{name: "unknown", cfg: SMTPConfig{TLS: "ssl"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Host, tt.cfg.From, tt.cfg.To = "smtp.example.com", "backup-agent@example.com", []string{"ops@example.com"}
+			err := tt.cfg.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (tt.cfg.TLS != tt.wantTLS || tt.cfg.Port != tt.wantPort) {
+				t.Errorf("tls %q port %d, want %q and %d", tt.cfg.TLS, tt.cfg.Port, tt.wantTLS, tt.wantPort)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookConfig holds the settings of a Slack-compatible webhook
+type WebhookConfig struct {
+	URL string `koanf:"url"`
+	// FailureThreshold is the number of consecutive failed runs before a
+	// failure is reported (default 1)
+	FailureThreshold int `koanf:"failure_threshold"`
+}
+
+// webhook posts events as JSON to a Slack-compatible incoming webhook
+type webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+func newWebhook(cfg WebhookConfig) *webhook {
+	return &webhook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (w *webhook) name() string {
+	return "webhook"
+}
+
+func (w *webhook) failureThreshold() int {
+	return w.cfg.FailureThreshold
+}
+
+// webhookDatabase is the JSON form of DatabaseStats
+type webhookDatabase struct {
+	Name            string  `json:"name"`
+	Files           int     `json:"files"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// webhookPayload carries a "text" field for Slack next to the structured fields
+type webhookPayload struct {
+	Text            string            `json:"text"`
+	Command         string            `json:"command"`
+	Status          string            `json:"status"`
+	Database        string            `json:"database,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Bytes           int64             `json:"bytes"`
+	Databases       []webhookDatabase `json:"databases,omitempty"`
+}
+
+// redactURL strips the URL from the errors of the HTTP client, webhook URLs
+// embed their credentials
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+func (w *webhook) send(ctx context.Context, event Event) error {
+	payload := webhookPayload{
+		Text:            "backup-agent: " + event.Summary(),
+		Command:         event.Command,
+		Status:          event.Status,
+		Database:        event.Database,
+		Error:           event.Error,
+		DurationSeconds: event.Duration.Seconds(),
+		Bytes:           event.Bytes,
+	}
+	for _, db := range event.Databases {
+		payload.Databases = append(payload.Databases, webhookDatabase{
+			Name:            db.Name,
+			Files:           db.Files,
+			Bytes:           db.Bytes,
+			DurationSeconds: db.Duration.Seconds(),
+		})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", redactURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to webhook at %s: %v", req.URL.Host, redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestWebhookErrorsHideURL(t *testing.T) {
+	// A listener that is closed right away gives a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "unreachable", url: "http://" + addr + "/services/secret-token"},
+		{name: "malformed", url: "http://" + addr + "/services/secret-token\x7f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newWebhook(WebhookConfig{URL: tt.url}).send(context.Background(), Event{Command: "backup", Status: StatusSuccess})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if strings.Contains(err.Error(), "secret-token") {
+				t.Errorf("error leaks the webhook URL: %v", err)
+			}
+		})
+	}
+}
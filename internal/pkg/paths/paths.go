@@ -0,0 +1,43 @@
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolve expands environment variables such as $HOME and a leading "~" or
+// "~/" to the home directory of the current user. Other paths, including
+// relative ones, are returned unchanged.
+func Resolve(path string) (string, error) {
+	path = os.ExpandEnv(path)
+
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		if strings.HasPrefix(path, "~") {
+			return "", fmt.Errorf("could not resolve %s: only ~ of the current user is supported", path)
+		}
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve home directory: %v", err)
+	}
+	return filepath.Join(homeDir, path[1:]), nil
+}
+
+// ResolveAll resolves every non-empty path in place
+func ResolveAll(paths ...*string) error {
+	for _, path := range paths {
+		if *path == "" {
+			continue
+		}
+		resolved, err := Resolve(*path)
+		if err != nil {
+			return err
+		}
+		*path = resolved
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package paths
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("BACKUP_DIR", "/var/backups")
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "home", path: "~", want: home},
+		{name: "below home", path: "~/sub", want: filepath.Join(home, "sub")},
+		{name: "nested below home", path: "~/sub/dir/", want: filepath.Join(home, "sub", "dir")},
+		{name: "relative", path: "backups/shop", want: "backups/shop"},
+		{name: "dot relative", path: "./backups", want: "./backups"},
+		{name: "absolute", path: "/var/backups", want: "/var/backups"},
+		{name: "home variable", path: "$HOME/backups", want: home + "/backups"},
+		{name: "braced variable", path: "${BACKUP_DIR}/shop", want: "/var/backups/shop"},
+		{name: "unset variable", path: "$BACKUP_UNSET/shop", want: "/shop"},
+		{name: "tilde inside", path: "backups/~shop", want: "backups/~shop"},
+		{name: "other user", path: "~root/backups", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve(%q) error = %v, want error %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAllSkipsEmptyPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	logFile, keyFile := "~/backup.log", ""
+	if err := ResolveAll(&logFile, &keyFile); err != nil {
+		t.Fatalf("ResolveAll() error = %v", err)
+	}
+	if want := filepath.Join(home, "backup.log"); logFile != want {
+		t.Errorf("log file = %q, want %q", logFile, want)
+	}
+	if keyFile != "" {
+		t.Errorf("empty key file resolved to %q", keyFile)
+	}
+}
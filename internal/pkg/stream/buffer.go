@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"io"
+)
+
+const (
+	// DefaultBufferSize is the buffer size used by streaming operations unless configured
+	DefaultBufferSize = 32 * 1024
+	// MinBufferSize is the smallest buffer size accepted from configuration
+	MinBufferSize = 4 * 1024
+	// MaxBufferSize is the largest buffer size accepted from configuration, the
+	// buffer size is the chunk size of encrypted files and larger chunks are
+	// refused when decrypting
+	MaxBufferSize = 64 * 1024 * 1024
+)
+
+// Global buffer size used by streaming read/write loops
+var (
+	bufferSize = DefaultBufferSize
+)
+
+// SetBufferSize sets the buffer size used by streaming operations. The size is
+// validated with the configuration, a zero size resets it to DefaultBufferSize.
+func SetBufferSize(size int) {
+	if size == 0 {
+		size = DefaultBufferSize
+	}
+	bufferSize = size
+}
+
+// BufferSize returns the buffer size used by streaming operations.
+func BufferSize() int {
+	return bufferSize
+}
+
+// NewBuffer allocates a buffer of the configured size.
+func NewBuffer() []byte {
+	return make([]byte, bufferSize)
+}
+
+// Copy copies from src to dst using a buffer of the configured size.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return io.CopyBuffer(dst, src, NewBuffer())
+}
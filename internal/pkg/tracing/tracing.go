@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "backup-agent"
+	defaultServiceName = "backup-agent"
+)
+
+// Config holds the tracing configuration
+type Config struct {
+	Enabled bool `koanf:"enabled"`
+	// Endpoint is the host:port of the OTLP/HTTP collector, e.g. "localhost:4318"
+	Endpoint string `koanf:"endpoint"`
+	// Insecure sends spans over plain HTTP instead of HTTPS
+	Insecure bool `koanf:"insecure"`
+	// ServiceName is reported as service.name on every span (default "backup-agent")
+	ServiceName string `koanf:"service_name"`
+}
+
+// Validate checks that an enabled tracing configuration has an endpoint
+func (c Config) Validate() error {
+	if c.Enabled && c.Endpoint == "" {
+		return fmt.Errorf("tracing.endpoint is required when tracing is enabled")
+	}
+	return nil
+}
+
+// Init installs an OTLP exporter as the global tracer provider when tracing is
+// enabled and returns a function that flushes pending spans. While tracing is
+// disabled the global no-op provider stays in place, so spans cost next to nothing.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %v", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the agent's tracer as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End marks the span as failed if err is set and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,248 @@
+package restore
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/pkg/logger"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// Options controls how a dump is restored
+type Options struct {
+	// Tables restricts the restore to the given tables, MySQL and PostgreSQL only
+	Tables []string
+	// Binaries overrides the paths of the database client binaries
+	Binaries backup.Binaries
+}
+
+// Step is a single command of a restore
+type Step struct {
+	Cmd *exec.Cmd
+	// Input is the file piped into the command's stdin, empty if it reads none
+	Input string
+	// Output is the file the command's stdout is written to, empty if it writes none
+	Output string
+	// Cleanup steps run even if an earlier step failed
+	Cleanup bool
+}
+
+// String returns the command line of the step, secrets are passed through the
+// environment and are never part of it
+func (s Step) String() string {
+	line := s.Cmd.String()
+	if s.Input != "" {
+		line += " < " + s.Input
+	}
+	if s.Output != "" {
+		line += " > " + s.Output
+	}
+	return line
+}
+
+// Plan builds the commands that restore the dump at dumpPath into the database.
+// MySQL and PostgreSQL dumps are piped into the client, InfluxDB backups and
+// SQLite databases are passed by path and copied into the container first when
+// one is configured.
+func Plan(db backup.Config, dumpPath string, opts Options) ([]Step, error) {
+	if len(opts.Tables) > 0 && db.Type != backup.MySQL && db.Type != backup.PostgreSQL {
+		return nil, fmt.Errorf("table filtering is not supported for database type: %s", db.Type)
+	}
+
+	switch db.Type {
+	case backup.MySQL:
+		args := []string{"-u", db.User}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-P", strconv.Itoa(db.Port))
+		}
+		args = append(args, backup.MySQLSSLArgs(db)...)
+		// A dump of all databases selects each database itself
+		if !db.AllDatabases {
+			args = append(args, db.Name)
+		}
+		cmd := backup.ClientCommand(context.Background(), db.Container, true, []string{"MYSQL_PWD=" + db.Password},
+			backup.BinaryOrDefault(opts.Binaries.MySQL, "mysql"), args...)
+		return []Step{{Cmd: cmd, Input: dumpPath}}, nil
+
+	case backup.PostgreSQL:
+		args := []string{"-U", db.User, "-q", "-v", "ON_ERROR_STOP=1"}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-p", strconv.Itoa(db.Port))
+		}
+		args = append(args, "-d", db.Name)
+		cmd := backup.ClientCommand(context.Background(), db.Container, true, append([]string{"PGPASSWORD=" + db.Password}, backup.PostgresSSLEnv(db)...),
+			backup.BinaryOrDefault(opts.Binaries.Psql, "psql"), args...)
+		return []Step{{Cmd: cmd, Input: dumpPath}}, nil
+
+	case backup.InfluxDB:
+		if db.InfluxVersion == 1 {
+			return withContainerCopy(db.Container, dumpPath, func(path string) *exec.Cmd {
+				args := []string{"restore", "-portable",
+					"-host", fmt.Sprintf("%s:%d", db.Host, db.Port),
+				}
+				if db.Database != "" {
+					args = append(args, "-db", db.Database)
+				}
+				if db.Retention != "" {
+					args = append(args, "-rp", db.Retention)
+				}
+				args = append(args, path)
+				return backup.ClientCommand(context.Background(), db.Container, false, nil,
+					backup.BinaryOrDefault(opts.Binaries.Influxd, "influxd"), args...)
+			}), nil
+		}
+
+		token, err := backup.InfluxToken(db)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving InfluxDB token: %v", err)
+		}
+		return withContainerCopy(db.Container, dumpPath, func(path string) *exec.Cmd {
+			args := []string{"restore"}
+			if db.Host != "" {
+				host := "http://" + db.Host
+				if db.Port != 0 {
+					host += ":" + strconv.Itoa(db.Port)
+				}
+				args = append(args, "--host", host)
+			}
+			if db.User != "" {
+				args = append(args, "--org", db.User)
+			}
+			args = append(args, path)
+			return backup.ClientCommand(context.Background(), db.Container, false, []string{"INFLUX_TOKEN=" + token},
+				backup.BinaryOrDefault(opts.Binaries.Influx, "influx"), args...)
+		}), nil
+
+	case backup.SQLite:
+		return withContainerCopy(db.Container, dumpPath, func(path string) *exec.Cmd {
+			return backup.ClientCommand(context.Background(), db.Container, false, nil,
+				backup.BinaryOrDefault(opts.Binaries.SQLite3, "sqlite3"), db.DBPath, fmt.Sprintf(".restore '%s'", path))
+		}), nil
+
+	case backup.Redis:
+		return nil, fmt.Errorf("restoring Redis snapshots requires replacing the dump file of the stopped server and is not supported")
+
+	case backup.Command:
+		return nil, fmt.Errorf("backups of the %s type are written by a custom command and must be restored by hand", backup.Command)
+
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", db.Type)
+	}
+}
+
+// withContainerCopy returns the restore steps for a client that reads the backup by path.
+// Inside a container the backup is copied to /tmp first and removed afterwards.
+func withContainerCopy(container, path string, restoreCmd func(path string) *exec.Cmd) []Step {
+	if container == "" {
+		return []Step{{Cmd: restoreCmd(path)}}
+	}
+
+	containerPath := "/tmp/" + filepath.Base(path)
+	return []Step{
+		{Cmd: exec.Command("docker", "cp", path, container+":"+containerPath)},
+		{Cmd: restoreCmd(containerPath)},
+		{Cmd: exec.Command("docker", "exec", container, "rm", "-rf", containerPath), Cleanup: true},
+	}
+}
+
+// Restore restores the dump at dumpPath into the database
+func Restore(db backup.Config, dumpPath string, opts Options) error {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.String("type", db.Type),
+		zap.String("file", dumpPath),
+	)
+
+	steps, err := Plan(db, dumpPath, opts)
+	if err != nil {
+		log.Error("Error creating restore command", zap.Error(err))
+		return err
+	}
+
+	if err := runSteps(log, steps, db.Type, opts.Tables); err != nil {
+		return err
+	}
+
+	log.Info("Restore completed successfully")
+	return nil
+}
+
+// runSteps runs the restore commands in order, after a failure only the cleanup steps
+func runSteps(log *zap.Logger, steps []Step, dbType string, tables []string) error {
+	var restoreErr error
+	for _, step := range steps {
+		if restoreErr != nil && !step.Cleanup {
+			continue
+		}
+
+		log.Info("Executing restore command", zap.String("command", step.String()))
+		if err := runStep(step, dbType, tables); err != nil {
+			if step.Cleanup {
+				log.Warn("Error cleaning up after restore", zap.Error(err))
+				continue
+			}
+			log.Error("Error running restore command", zap.Error(err))
+			restoreErr = err
+		}
+	}
+	return restoreErr
+}
+
+// runStep runs a restore command, piping its input through the table filter if tables are given
+func runStep(step Step, dbType string, tables []string) error {
+	var stderr bytes.Buffer
+	step.Cmd.Stderr = &stderr
+
+	if step.Input != "" {
+		file, err := os.Open(step.Input)
+		if err != nil {
+			return fmt.Errorf("error opening backup file: %v", err)
+		}
+		defer file.Close()
+		step.Cmd.Stdin = file
+
+		if len(tables) > 0 {
+			pr, pw := io.Pipe()
+			// Closing the reader unblocks the filter if the command exits early
+			defer pr.Close()
+			go func() {
+				pw.CloseWithError(FilterTables(dbType, file, pw, tables))
+			}()
+			step.Cmd.Stdin = pr
+		}
+	}
+
+	if step.Output == "" {
+		if err := step.Cmd.Run(); err != nil {
+			return fmt.Errorf("error running restore command: %v, error message: %s", err, stderr.String())
+		}
+		return nil
+	}
+
+	file, err := os.Create(step.Output)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	step.Cmd.Stdout = file
+	if err := step.Cmd.Run(); err != nil {
+		file.Close()
+		return fmt.Errorf("error running restore command: %v, error message: %s", err, stderr.String())
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package restore
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/pkg/logger"
+	"backup-agent/internal/pkg/stream"
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Table filtering works on the plain SQL dumps produced by the backup command.
+//
+// Limitations per engine:
+//   - MySQL: sections are detected by the comment headers mysqldump writes
+//     ("Table structure for table", "Dumping data for table", view headers).
+//     Dumps made with --skip-comments can't be filtered. Routines, events and
+//     triggers defined outside a table section are dropped.
+//   - PostgreSQL: sections are detected by the "-- Name: ...; Type: ..." headers
+//     of pg_dump's plain format. Table definitions, data, defaults, constraints,
+//     foreign keys and triggers are kept, as are the sequences owned by a table
+//     (serial and identity columns) and their current values. Indexes and
+//     sequences that no table owns are named independently of their table and
+//     are therefore not restored.
+//   - InfluxDB: backups are not SQL and can't be filtered.
+
+var (
+	mysqlSectionRe = regexp.MustCompile("^-- (?:Table structure for table|Dumping data for table|Temporary view structure for view|Final view structure for view) `([^`]+)`")
+	mysqlOtherRe   = regexp.MustCompile(`^-- Dumping (?:events|routines) for database`)
+	mysqlSetRe     = regexp.MustCompile(`^/\*!\d+ SET `)
+	pgSectionRe    = regexp.MustCompile(`^-- (?:Data for )?Name: ([^;]+); Type: ([^;]+);`)
+	// pgOwnedByRe matches the owner column of a serial sequence, pgIdentityRe the table of an identity column
+	pgOwnedByRe  = regexp.MustCompile(`^ALTER SEQUENCE \S+ OWNED BY (\S+)\.[^.\s]+;`)
+	pgIdentityRe = regexp.MustCompile(`^ALTER TABLE (?:ONLY )?(\S+) ALTER COLUMN \S+ ADD GENERATED `)
+)
+
+// pgTableTypes are the pg_dump object types that belong to a table
+var pgTableTypes = map[string]bool{
+	"TABLE":         true,
+	"TABLE DATA":    true,
+	"DEFAULT":       true,
+	"CONSTRAINT":    true,
+	"FK CONSTRAINT": true,
+	"TRIGGER":       true,
+	"ROW SECURITY":  true,
+	"POLICY":        true,
+}
+
+// tableFilter keeps track of the section of a dump being read
+type tableFilter struct {
+	wanted map[string]bool
+	found  map[string]bool
+	// Everything before the first section is the dump preamble and is always kept
+	include bool
+}
+
+// enter starts the section of the given table, "" for sections of no table
+func (f *tableFilter) enter(table string) {
+	f.include = f.wanted[table]
+	if f.include {
+		f.found[table] = true
+	}
+}
+
+// mysqlFilter filters mysqldump output
+type mysqlFilter struct {
+	tableFilter
+}
+
+// filter returns the lines to write for a line of the dump
+func (f *mysqlFilter) filter(line string) []string {
+	if m := mysqlSectionRe.FindStringSubmatch(line); m != nil {
+		f.enter(m[1])
+	} else if mysqlOtherRe.MatchString(line) {
+		f.enter("")
+	}
+	// Session variable restores at the end of the dump must survive filtering
+	if f.include || mysqlSetRe.MatchString(line) {
+		return []string{line}
+	}
+	return nil
+}
+
+// flush returns the lines held back at the end of the dump
+func (f *mysqlFilter) flush() []string {
+	return nil
+}
+
+// pgFilter filters pg_dump plain format output. The table owning a sequence is
+// only named in the sequence's sections, so they are held back until it is known.
+type pgFilter struct {
+	tableFilter
+	// owners maps sequence names to the table owning them
+	owners  map[string]string
+	held    []string
+	heldSeq string
+}
+
+// filter returns the lines to write for a line of the dump, including held back ones
+func (f *pgFilter) filter(line string) []string {
+	m := pgSectionRe.FindStringSubmatch(line)
+	if m == nil {
+		if f.held != nil {
+			f.held = append(f.held, line)
+			if owner := pgSequenceOwner(line); owner != "" {
+				f.owners[f.heldSeq] = owner
+			}
+			return nil
+		}
+		if f.include {
+			return []string{line}
+		}
+		return nil
+	}
+
+	name, objectType := m[1], m[2]
+	var out []string
+	if objectType == "SEQUENCE" || objectType == "SEQUENCE OWNED BY" {
+		if name != f.heldSeq {
+			out = f.flush()
+		}
+		f.heldSeq = name
+		f.held = append(f.held, line)
+		return out
+	}
+
+	out = f.flush()
+	switch {
+	case objectType == "SEQUENCE SET":
+		f.include = f.wanted[f.owners[name]]
+	case pgTableTypes[objectType]:
+		// Constraints and triggers are named "<table> <object>"
+		f.enter(strings.Fields(name)[0])
+	default:
+		f.enter("")
+	}
+	if f.include {
+		out = append(out, line)
+	}
+	return out
+}
+
+// flush ends the held back sequence sections and returns them if their table is wanted
+func (f *pgFilter) flush() []string {
+	held, sequence := f.held, f.heldSeq
+	f.held, f.heldSeq = nil, ""
+	if !f.wanted[f.owners[sequence]] {
+		return nil
+	}
+	return held
+}
+
+// pgSequenceOwner returns the table owning a sequence if the line names it
+func pgSequenceOwner(line string) string {
+	m := pgOwnedByRe.FindStringSubmatch(line)
+	if m == nil {
+		m = pgIdentityRe.FindStringSubmatch(line)
+	}
+	if m == nil {
+		return ""
+	}
+	// Section headers name tables without their schema
+	qualified := strings.Split(m[1], ".")
+	return strings.Trim(qualified[len(qualified)-1], `"`)
+}
+
+// FilterTables copies the parts of a SQL dump that belong to the given tables from r to w
+func FilterTables(dbType string, r io.Reader, w io.Writer, tables []string) error {
+	log := logger.L().With(
+		zap.String("type", dbType),
+		zap.Strings("tables", tables),
+	)
+
+	if len(tables) == 0 {
+		_, err := stream.Copy(w, r)
+		return err
+	}
+
+	base := tableFilter{
+		wanted:  make(map[string]bool, len(tables)),
+		found:   make(map[string]bool),
+		include: true,
+	}
+	for _, table := range tables {
+		base.wanted[table] = true
+	}
+
+	var filter interface {
+		filter(line string) []string
+		flush() []string
+	}
+	switch dbType {
+	case backup.MySQL:
+		filter = &mysqlFilter{tableFilter: base}
+	case backup.PostgreSQL:
+		filter = &pgFilter{tableFilter: base, owners: make(map[string]string)}
+	default:
+		log.Error("Table filtering not supported for database type")
+		return fmt.Errorf("table filtering is not supported for database type: %s", dbType)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(stream.NewBuffer(), 64*1024*1024)
+	bw := bufio.NewWriterSize(w, stream.BufferSize())
+	write := func(lines []string) error {
+		for _, line := range lines {
+			if _, err := bw.WriteString(line + "\n"); err != nil {
+				return fmt.Errorf("error writing filtered dump: %v", err)
+			}
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		if err := write(filter.filter(scanner.Text())); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error("Error reading dump", zap.Error(err))
+		return fmt.Errorf("error reading dump: %v", err)
+	}
+	if err := write(filter.flush()); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing filtered dump: %v", err)
+	}
+
+	for _, table := range tables {
+		if !base.found[table] {
+			log.Error("Table not found in dump", zap.String("table", table))
+			return fmt.Errorf("table %s not found in dump", table)
+		}
+	}
+
+	log.Debug("Dump filtered to requested tables")
+	return nil
+}
@@ -0,0 +1,270 @@
+package restore
+
+import (
+	"backup-agent/internal/backup"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// pgDump is pg_dump plain format output of a table with a serial column, one with
+// an identity column and an unrelated table with a serial column
+const pgDump = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+
+--
+-- Name: audit; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.audit (
+    id integer NOT NULL,
+    entry text
+);
+
+--
+-- Name: audit_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.audit_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+--
+-- Name: audit_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.audit_id_seq OWNED BY public.audit.id;
+
+--
+-- Name: customers; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.customers (
+    id integer NOT NULL,
+    name text
+);
+
+--
+-- Name: customers_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+ALTER TABLE public.customers ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.customers_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+--
+-- Name: orders; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.orders (
+    id integer NOT NULL,
+    total numeric
+);
+
+--
+-- Name: orders_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.orders_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+--
+-- Name: orders_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;
+
+--
+-- Name: audit id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.audit ALTER COLUMN id SET DEFAULT nextval('public.audit_id_seq'::regclass);
+
+--
+-- Name: orders id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);
+
+--
+-- Data for Name: audit; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.audit (id, entry) FROM stdin;
+1	created
+\.
+
+--
+-- Data for Name: customers; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.customers (id, name) FROM stdin;
+1	Ada
+\.
+
+--
+-- Data for Name: orders; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.orders (id, total) FROM stdin;
+1	9.99
+2	19.99
+\.
+
+--
+-- Name: audit_id_seq; Type: SEQUENCE SET; Schema: public; Owner: postgres
+--
+
+SELECT pg_catalog.setval('public.audit_id_seq', 1, true);
+
+--
+-- Name: customers_id_seq; Type: SEQUENCE SET; Schema: public; Owner: postgres
+--
+
+SELECT pg_catalog.setval('public.customers_id_seq', 1, true);
+
+--
+-- Name: orders_id_seq; Type: SEQUENCE SET; Schema: public; Owner: postgres
+--
+
+SELECT pg_catalog.setval('public.orders_id_seq', 2, true);
+
+--
+-- Name: orders orders_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+func TestFilterTablesKeepsOwnedSequences(t *testing.T) {
+	tests := []struct {
+		name    string
+		tables  []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "serial column",
+			tables: []string{"orders"},
+			want: []string{
+				"SET client_encoding = 'UTF8';",
+				"CREATE TABLE public.orders (",
+				"CREATE SEQUENCE public.orders_id_seq",
+				"ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;",
+				"ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);",
+				"2\t19.99",
+				"SELECT pg_catalog.setval('public.orders_id_seq', 2, true);",
+				"ADD CONSTRAINT orders_pkey PRIMARY KEY (id);",
+			},
+			notWant: []string{"audit", "customers"},
+		},
+		{
+			name:   "identity column",
+			tables: []string{"customers"},
+			want: []string{
+				"CREATE TABLE public.customers (",
+				"ALTER TABLE public.customers ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (",
+				"    SEQUENCE NAME public.customers_id_seq",
+				"1\tAda",
+				"SELECT pg_catalog.setval('public.customers_id_seq', 1, true);",
+			},
+			notWant: []string{"audit", "orders"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := FilterTables(backup.PostgreSQL, strings.NewReader(pgDump), &out, tt.tables); err != nil {
+				t.Fatalf("FilterTables() error = %v", err)
+			}
+			filtered := out.String()
+
+			// Sequences have to be created before the defaults and values that use them
+			last := -1
+			for _, line := range tt.want {
+				i := strings.Index(filtered, line+"\n")
+				if i < 0 {
+					t.Errorf("filtered dump lacks %q", line)
+					continue
+				}
+				if i < last {
+					t.Errorf("filtered dump has %q out of order", line)
+				}
+				last = i
+			}
+			for _, table := range tt.notWant {
+				if strings.Contains(filtered, "public."+table) {
+					t.Errorf("filtered dump contains objects of %s:\n%s", table, filtered)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterTablesMySQL(t *testing.T) {
+	dump := strings.Join([]string{
+		"/*!40101 SET NAMES utf8mb4 */;",
+		"--",
+		"-- Table structure for table `audit`",
+		"--",
+		"CREATE TABLE `audit` (`id` int NOT NULL AUTO_INCREMENT);",
+		"--",
+		"-- Table structure for table `orders`",
+		"--",
+		"CREATE TABLE `orders` (`id` int NOT NULL AUTO_INCREMENT);",
+		"--",
+		"-- Dumping data for table `orders`",
+		"--",
+		"INSERT INTO `orders` VALUES (1),(2);",
+		"--",
+		"-- Dumping routines for database 'shop'",
+		"--",
+		"CREATE PROCEDURE `cleanup`() BEGIN END;",
+		"/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;",
+		"",
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := FilterTables(backup.MySQL, strings.NewReader(dump), &out, []string{"orders"}); err != nil {
+		t.Fatalf("FilterTables() error = %v", err)
+	}
+	filtered := out.String()
+	for _, line := range []string{"SET NAMES", "CREATE TABLE `orders`", "INSERT INTO `orders`", "SET SQL_MODE"} {
+		if !strings.Contains(filtered, line) {
+			t.Errorf("filtered dump lacks %q", line)
+		}
+	}
+	for _, line := range []string{"`audit`", "cleanup"} {
+		if strings.Contains(filtered, line) {
+			t.Errorf("filtered dump contains %q", line)
+		}
+	}
+
+	err := FilterTables(backup.MySQL, strings.NewReader(dump), &bytes.Buffer{}, []string{"missing"})
+	if err == nil || !strings.Contains(err.Error(), "table missing not found") {
+		t.Errorf("FilterTables() error = %v, want the missing table reported", err)
+	}
+}
@@ -0,0 +1,94 @@
+package restore
+
+import (
+	"backup-agent/internal/backup"
+	"backup-agent/internal/pkg/logger"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// NewVerifyQueryCommand builds the command that runs a SQL query against a database
+// with its configured client and prints the result without headers or alignment
+func NewVerifyQueryCommand(db backup.Config, query string, bins backup.Binaries) (*exec.Cmd, error) {
+	var name, passwordEnv string
+	var args, env []string
+
+	switch db.Type {
+	case backup.MySQL:
+		name, passwordEnv = backup.BinaryOrDefault(bins.MySQL, "mysql"), "MYSQL_PWD"
+		args = []string{"-u", db.User, "-N", "-B"}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-P", strconv.Itoa(db.Port))
+		}
+		args = append(args, backup.MySQLSSLArgs(db)...)
+		args = append(args, "-e", query)
+		if !db.AllDatabases {
+			args = append(args, db.Name)
+		}
+	case backup.PostgreSQL:
+		name, passwordEnv = backup.BinaryOrDefault(bins.Psql, "psql"), "PGPASSWORD"
+		args = []string{"-U", db.User, "-t", "-A"}
+		if db.Host != "" {
+			args = append(args, "-h", db.Host)
+		}
+		if db.Port != 0 {
+			args = append(args, "-p", strconv.Itoa(db.Port))
+		}
+		args = append(args, "-d", db.Name, "-c", query)
+		env = backup.PostgresSSLEnv(db)
+	default:
+		return nil, fmt.Errorf("verification queries are not supported for database type: %s", db.Type)
+	}
+
+	// The password is passed through the environment so it never shows up in the process list
+	env = append(env, passwordEnv+"="+db.Password)
+	return backup.ClientCommand(context.Background(), db.Container, false, env, name, args...), nil
+}
+
+// VerifyQuery runs query against the database and returns its trimmed output.
+// If expect is not empty the output must match it exactly.
+func VerifyQuery(db backup.Config, query, expect string, bins backup.Binaries) (string, error) {
+	log := logger.L().With(
+		zap.String("database", db.Name),
+		zap.String("type", db.Type),
+		zap.String("query", query),
+	)
+
+	cmd, err := NewVerifyQueryCommand(db, query, bins)
+	if err != nil {
+		log.Error("Error creating verification command", zap.Error(err))
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Info("Running verification query")
+	if err := cmd.Run(); err != nil {
+		log.Error("Error running verification query",
+			zap.Error(err),
+			zap.String("stderr", stderr.String()))
+		return "", fmt.Errorf("error running verification query: %v, error message: %s", err, stderr.String())
+	}
+
+	result := strings.TrimSpace(stdout.String())
+	if expect != "" && result != expect {
+		log.Error("Verification query result mismatch",
+			zap.String("expected", expect),
+			zap.String("got", result))
+		return result, fmt.Errorf("verification failed: expected %q, got %q", expect, result)
+	}
+
+	log.Info("Verification query succeeded", zap.String("result", result))
+	return result, nil
+}
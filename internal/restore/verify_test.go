@@ -0,0 +1,60 @@
+package restore
+
+import (
+	"backup-agent/internal/backup"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeClient writes a database client script to dir that prints the given output
+func fakeClient(t *testing.T, dir, name, output string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho '" + output + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("error writing fake client: %v", err)
+	}
+	return path
+}
+
+func TestVerifyQuery(t *testing.T) {
+	dir := t.TempDir()
+	bins := backup.Binaries{
+		MySQL: fakeClient(t, dir, "mysql", "1042"),
+		Psql:  fakeClient(t, dir, "psql", " 1042 "),
+	}
+
+	tests := []struct {
+		name    string
+		dbType  string
+		expect  string
+		wantErr string
+	}{
+		{name: "mysql", dbType: backup.MySQL},
+		{name: "mysql expected", dbType: backup.MySQL, expect: "1042"},
+		{name: "postgresql expected", dbType: backup.PostgreSQL, expect: "1042"},
+		{name: "postgresql mismatch", dbType: backup.PostgreSQL, expect: "7", wantErr: `expected "7", got "1042"`},
+		{name: "influxdb", dbType: backup.InfluxDB, wantErr: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := backup.Config{Name: "shop", Type: tt.dbType, User: "restore"}
+			result, err := VerifyQuery(db, "SELECT COUNT(*) FROM orders", tt.expect, bins)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("VerifyQuery() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyQuery() error = %v", err)
+			}
+			if result != "1042" {
+				t.Errorf("VerifyQuery() = %q, want the trimmed output of the configured client", result)
+			}
+		})
+	}
+}